@@ -0,0 +1,223 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// bucketStart aligns t to the start of its horizon bucket in loc. Days
+// start at local midnight, weeks on Monday and months on the first.
+func bucketStart(t time.Time, horizon ChartHorizon, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch {
+	case horizon == Horizon1Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case horizon == Horizon1Week:
+		offset := (int(t.Weekday()) + 6) % 7
+		return midnight.AddDate(0, 0, -offset)
+	case horizon >= Horizon1Day:
+		return midnight
+	}
+	width := horizon.Duration()
+	return midnight.Add(t.Sub(midnight) / width * width)
+}
+
+func nextBucket(start time.Time, horizon ChartHorizon, loc *time.Location) time.Time {
+	switch {
+	case horizon == Horizon1Month:
+		return start.AddDate(0, 1, 0)
+	case horizon == Horizon1Week:
+		return start.AddDate(0, 0, 7)
+	case horizon >= Horizon1Day:
+		return start.AddDate(0, 0, int(horizon/Horizon1Day))
+	}
+	// a bucket can not run past midnight, which keeps daylight saving
+	// changes from shifting the grid
+	return bucketStart(start.Add(horizon.Duration()), horizon, loc)
+}
+
+// QuotePrice picks the side of a quote, returning false when that side
+// has no price.
+func QuotePrice(q SaxoQuote, side PriceSide) (float64, bool) {
+	switch side {
+	case PriceBid:
+		return q.BidPrice, q.BidPrice != 0
+	case PriceAsk:
+		return q.AskPrice, q.AskPrice != 0
+	}
+	if q.Mid != 0 {
+		return q.Mid, true
+	}
+	if q.BidPrice != 0 && q.AskPrice != 0 {
+		return (q.BidPrice + q.AskPrice) / 2, true
+	}
+	return 0, false
+}
+
+// BarAggregator builds bars from quote ticks. Buckets are aligned in
+// Location, normally the exchange time zone. Ticks carry no traded volume,
+// so a bar's Volume is its tick count. A Closed MarketState ends the open
+// bar and its ticks are dropped. With FillGaps set, buckets without ticks
+// between two open-market ticks are emitted flat at the previous close.
+type BarAggregator struct {
+	Horizon  ChartHorizon
+	Side     PriceSide
+	Location *time.Location
+	FillGaps bool
+
+	current  *Bar
+	end      time.Time
+	closed   bool
+	lastTick time.Time
+}
+
+func NewBarAggregator(horizon ChartHorizon, side PriceSide, loc *time.Location) (*BarAggregator, error) {
+	if !horizon.Valid() {
+		return nil, errors.New(fmt.Sprintf("Unsupported bar horizon %d", horizon))
+	}
+	if side == "" {
+		side = PriceMid
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &BarAggregator{Horizon: horizon, Side: side, Location: loc}, nil
+}
+
+// Add feeds one tick and returns any bars it completed. Ticks older than
+// the last one accepted are ignored.
+func (ba *BarAggregator) Add(t time.Time, q SaxoQuote) []Bar {
+	var done []Bar
+	if q.MarketState == "Closed" {
+		if b, ok := ba.Flush(); ok {
+			done = append(done, b)
+		}
+		ba.closed = true
+		return done
+	}
+	price, ok := QuotePrice(q, ba.Side)
+	if !ok || t.Before(ba.lastTick) {
+		return done
+	}
+	ba.lastTick = t
+	if ba.current != nil && !t.Before(ba.end) {
+		prev := *ba.current
+		done = append(done, prev)
+		ba.current = nil
+		if ba.FillGaps && !ba.closed {
+			start := ba.end
+			for {
+				end := nextBucket(start, ba.Horizon, ba.Location)
+				if end.After(t) {
+					break
+				}
+				done = append(done, Bar{Time: start, Open: prev.Close, High: prev.Close, Low: prev.Close, Close: prev.Close})
+				start = end
+			}
+		}
+	}
+	ba.closed = false
+	if ba.current == nil {
+		start := bucketStart(t, ba.Horizon, ba.Location)
+		ba.current = &Bar{Time: start, Open: price, High: price, Low: price}
+		ba.end = nextBucket(start, ba.Horizon, ba.Location)
+	}
+	b := ba.current
+	if price > b.High {
+		b.High = price
+	}
+	if price < b.Low {
+		b.Low = price
+	}
+	b.Close = price
+	b.Volume++
+	return done
+}
+
+// AddPrice feeds a price as returned by Prices or a price stream state.
+func (ba *BarAggregator) AddPrice(p SaxoPrice) ([]Bar, error) {
+	t, err := ParseSaxoDate(p.LastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	return ba.Add(t, p.Quote), nil
+}
+
+// Advance closes the open bar once now has passed its end, for quiet
+// markets where no further tick arrives.
+func (ba *BarAggregator) Advance(now time.Time) (Bar, bool) {
+	if ba.current == nil || now.Before(ba.end) {
+		return Bar{}, false
+	}
+	return ba.Flush()
+}
+
+// Current returns the bar still being built.
+func (ba *BarAggregator) Current() (Bar, bool) {
+	if ba.current == nil {
+		return Bar{}, false
+	}
+	return *ba.current, true
+}
+
+// Flush ends the open bar early and returns it.
+func (ba *BarAggregator) Flush() (Bar, bool) {
+	if ba.current == nil {
+		return Bar{}, false
+	}
+	b := *ba.current
+	ba.current = nil
+	return b, true
+}
+
+// Resample merges time ordered bars into the given horizon, aligned in loc.
+// Open is taken from the first bar of each bucket and Close from the last.
+func Resample(bars []Bar, horizon ChartHorizon, loc *time.Location) ([]Bar, error) {
+	if !horizon.Valid() {
+		return nil, errors.New(fmt.Sprintf("Unsupported bar horizon %d", horizon))
+	}
+	var out []Bar
+	var end time.Time
+	for _, b := range bars {
+		if len(out) > 0 && b.Time.Before(end) {
+			cur := &out[len(out)-1]
+			if b.Time.Before(cur.Time) {
+				return nil, errors.New("Bars are not in time order")
+			}
+			if b.High > cur.High {
+				cur.High = b.High
+			}
+			if b.Low < cur.Low {
+				cur.Low = b.Low
+			}
+			cur.Close = b.Close
+			cur.Volume += b.Volume
+			continue
+		}
+		start := bucketStart(b.Time, horizon, loc)
+		if len(out) > 0 && start.Before(out[len(out)-1].Time) {
+			return nil, errors.New("Bars are not in time order")
+		}
+		end = nextBucket(start, horizon, loc)
+		out = append(out, Bar{Time: start, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close, Volume: b.Volume})
+	}
+	return out, nil
+}
+
+// Resample returns the series at a higher horizon, which must be a whole
+// multiple of the current one.
+func (bs BarSeries) Resample(horizon ChartHorizon, loc *time.Location) (*BarSeries, error) {
+	if horizon < bs.Horizon || (bs.Horizon != 0 && horizon%bs.Horizon != 0) {
+		return nil, errors.New(fmt.Sprintf("Can not resample %s bars to %s", bs.Horizon, horizon))
+	}
+	bars, err := Resample(bs.Bars, horizon, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &BarSeries{Uic: bs.Uic, AssetType: bs.AssetType, Horizon: horizon, Side: bs.Side, Bars: bars}, nil
+}
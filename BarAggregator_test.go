@@ -0,0 +1,219 @@
+package saxotrader
+
+import (
+	"testing"
+	"time"
+)
+
+func at(hour, min, sec int) time.Time {
+	return time.Date(2024, 3, 6, hour, min, sec, 0, time.UTC)
+}
+
+func TestBucketStart(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name    string
+		t       time.Time
+		horizon ChartHorizon
+		loc     *time.Location
+		want    time.Time
+	}{
+		{"minute", at(10, 7, 31), Horizon1Minute, nil, at(10, 7, 0)},
+		{"five minutes", at(10, 7, 31), Horizon5Minutes, nil, at(10, 5, 0)},
+		{"four hours", at(10, 7, 31), Horizon4Hours, nil, at(8, 0, 0)},
+		{"day", at(10, 7, 31), Horizon1Day, nil, at(0, 0, 0)},
+		{"day in exchange time", at(3, 0, 0), Horizon1Day, ny, time.Date(2024, 3, 5, 0, 0, 0, 0, ny)},
+		{"week starts monday", at(10, 7, 31), Horizon1Week, nil, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"sunday belongs to the week before", time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC), Horizon1Week, nil, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"month", at(10, 7, 31), Horizon1Month, nil, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"hour after daylight saving starts", time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC), Horizon1Hour, ny, time.Date(2024, 3, 10, 11, 0, 0, 0, ny)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bucketStart(tt.t, tt.horizon, tt.loc); !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBarAggregator(t *testing.T) {
+	type tick struct {
+		t     time.Time
+		quote SaxoQuote
+	}
+	mid := func(t time.Time, p float64) tick { return tick{t, SaxoQuote{Mid: p}} }
+	tests := []struct {
+		name     string
+		side     PriceSide
+		fillGaps bool
+		ticks    []tick
+		want     []Bar
+		current  *Bar
+	}{
+		{
+			name:    "one bar",
+			ticks:   []tick{mid(at(10, 0, 1), 5), mid(at(10, 0, 20), 7), mid(at(10, 0, 40), 4), mid(at(10, 0, 59), 6)},
+			current: &Bar{Time: at(10, 0, 0), Open: 5, High: 7, Low: 4, Close: 6, Volume: 4},
+		},
+		{
+			name:    "tick at the bucket end starts the next bar",
+			ticks:   []tick{mid(at(10, 0, 1), 5), mid(at(10, 1, 0), 6)},
+			want:    []Bar{{Time: at(10, 0, 0), Open: 5, High: 5, Low: 5, Close: 5, Volume: 1}},
+			current: &Bar{Time: at(10, 1, 0), Open: 6, High: 6, Low: 6, Close: 6, Volume: 1},
+		},
+		{
+			name:    "gaps are skipped",
+			ticks:   []tick{mid(at(10, 0, 1), 5), mid(at(10, 3, 0), 6)},
+			want:    []Bar{{Time: at(10, 0, 0), Open: 5, High: 5, Low: 5, Close: 5, Volume: 1}},
+			current: &Bar{Time: at(10, 3, 0), Open: 6, High: 6, Low: 6, Close: 6, Volume: 1},
+		},
+		{
+			name:     "gaps are filled flat",
+			fillGaps: true,
+			ticks:    []tick{mid(at(10, 0, 1), 5), mid(at(10, 3, 0), 6)},
+			want: []Bar{
+				{Time: at(10, 0, 0), Open: 5, High: 5, Low: 5, Close: 5, Volume: 1},
+				{Time: at(10, 1, 0), Open: 5, High: 5, Low: 5, Close: 5},
+				{Time: at(10, 2, 0), Open: 5, High: 5, Low: 5, Close: 5},
+			},
+			current: &Bar{Time: at(10, 3, 0), Open: 6, High: 6, Low: 6, Close: 6, Volume: 1},
+		},
+		{
+			name:     "no filling across a closed market",
+			fillGaps: true,
+			ticks:    []tick{mid(at(10, 0, 1), 5), {at(10, 0, 30), SaxoQuote{MarketState: "Closed", Mid: 9}}, mid(at(10, 3, 0), 6)},
+			want:     []Bar{{Time: at(10, 0, 0), Open: 5, High: 5, Low: 5, Close: 5, Volume: 1}},
+			current:  &Bar{Time: at(10, 3, 0), Open: 6, High: 6, Low: 6, Close: 6, Volume: 1},
+		},
+		{
+			name:    "old ticks and ticks without the side are ignored",
+			side:    PriceBid,
+			ticks:   []tick{{at(10, 0, 30), SaxoQuote{BidPrice: 5, AskPrice: 6}}, {at(10, 0, 10), SaxoQuote{BidPrice: 1, AskPrice: 2}}, {at(10, 0, 40), SaxoQuote{AskPrice: 9}}},
+			current: &Bar{Time: at(10, 0, 0), Open: 5, High: 5, Low: 5, Close: 5, Volume: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ba, err := NewBarAggregator(Horizon1Minute, tt.side, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ba.FillGaps = tt.fillGaps
+			var got []Bar
+			for _, tk := range tt.ticks {
+				got = append(got, ba.Add(tk.t, tk.quote)...)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got bars %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("bar %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			cur, ok := ba.Current()
+			if ok != (tt.current != nil) || (ok && cur != *tt.current) {
+				t.Errorf("current bar = %+v, want %+v", cur, tt.current)
+			}
+		})
+	}
+}
+
+func TestBarAggregatorAdvance(t *testing.T) {
+	ba, err := NewBarAggregator(Horizon5Minutes, PriceMid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba.Add(at(10, 1, 0), SaxoQuote{BidPrice: 1, AskPrice: 3})
+	if _, ok := ba.Advance(at(10, 4, 59)); ok {
+		t.Error("bar closed before its end")
+	}
+	b, ok := ba.Advance(at(10, 5, 0))
+	want := Bar{Time: at(10, 0, 0), Open: 2, High: 2, Low: 2, Close: 2, Volume: 1}
+	if !ok || b != want {
+		t.Errorf("Advance = %+v %v, want %+v", b, ok, want)
+	}
+	if _, ok := ba.Current(); ok {
+		t.Error("bar still open after Advance")
+	}
+}
+
+func TestNewBarAggregatorRejectsHorizon(t *testing.T) {
+	if _, err := NewBarAggregator(7, PriceMid, nil); err == nil {
+		t.Error("unsupported horizon did not fail")
+	}
+}
+
+func TestResample(t *testing.T) {
+	minute := func(min int, o, h, l, c, v float64) Bar {
+		return Bar{Time: at(10, min, 0), Open: o, High: h, Low: l, Close: c, Volume: v}
+	}
+	tests := []struct {
+		name    string
+		bars    []Bar
+		horizon ChartHorizon
+		want    []Bar
+		wantErr bool
+	}{
+		{
+			name:    "five minutes",
+			bars:    []Bar{minute(0, 1, 2, 0.5, 1.5, 10), minute(1, 1.5, 3, 1, 2, 20), minute(4, 2, 2.5, 0.2, 1, 5), minute(5, 1, 1, 1, 1, 1)},
+			horizon: Horizon5Minutes,
+			want: []Bar{
+				{Time: at(10, 0, 0), Open: 1, High: 3, Low: 0.2, Close: 1, Volume: 35},
+				{Time: at(10, 5, 0), Open: 1, High: 1, Low: 1, Close: 1, Volume: 1},
+			},
+		},
+		{
+			name:    "bucket starts where the first bar falls",
+			bars:    []Bar{minute(7, 1, 1, 1, 1, 1), minute(21, 2, 2, 2, 2, 2)},
+			horizon: Horizon15Minutes,
+			want: []Bar{
+				{Time: at(10, 0, 0), Open: 1, High: 1, Low: 1, Close: 1, Volume: 1},
+				{Time: at(10, 15, 0), Open: 2, High: 2, Low: 2, Close: 2, Volume: 2},
+			},
+		},
+		{
+			name:    "out of order",
+			bars:    []Bar{minute(6, 1, 1, 1, 1, 1), minute(1, 1, 1, 1, 1, 1)},
+			horizon: Horizon5Minutes,
+			wantErr: true,
+		},
+		{
+			name:    "unsupported horizon",
+			bars:    []Bar{minute(0, 1, 1, 1, 1, 1)},
+			horizon: 7,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resample(tt.bars, tt.horizon, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("bar %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBarSeriesResampleNeedsMultiple(t *testing.T) {
+	bs := BarSeries{Horizon: Horizon10Minutes}
+	if _, err := bs.Resample(Horizon15Minutes, nil); err == nil {
+		t.Error("resampling 10 minute bars to 15 minutes did not fail")
+	}
+	if _, err := bs.Resample(Horizon1Hour, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,324 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ChartHorizon is the bar length in minutes, as used by the chart endpoint.
+type ChartHorizon int
+
+const (
+	Horizon1Minute   ChartHorizon = 1
+	Horizon5Minutes  ChartHorizon = 5
+	Horizon10Minutes ChartHorizon = 10
+	Horizon15Minutes ChartHorizon = 15
+	Horizon30Minutes ChartHorizon = 30
+	Horizon1Hour     ChartHorizon = 60
+	Horizon2Hours    ChartHorizon = 120
+	Horizon4Hours    ChartHorizon = 240
+	Horizon6Hours    ChartHorizon = 360
+	Horizon8Hours    ChartHorizon = 480
+	Horizon1Day      ChartHorizon = 1440
+	Horizon1Week     ChartHorizon = 10080
+	Horizon1Month    ChartHorizon = 43200
+)
+
+var chartHorizons = []ChartHorizon{
+	Horizon1Minute, Horizon5Minutes, Horizon10Minutes, Horizon15Minutes, Horizon30Minutes,
+	Horizon1Hour, Horizon2Hours, Horizon4Hours, Horizon6Hours, Horizon8Hours,
+	Horizon1Day, Horizon1Week, Horizon1Month,
+}
+
+func (h ChartHorizon) Valid() bool {
+	for _, v := range chartHorizons {
+		if v == h {
+			return true
+		}
+	}
+	return false
+}
+
+func (h ChartHorizon) Duration() time.Duration {
+	return time.Duration(h) * time.Minute
+}
+
+func (h ChartHorizon) String() string {
+	switch {
+	case h >= Horizon1Month && h%Horizon1Month == 0:
+		return fmt.Sprintf("%dmo", h/Horizon1Month)
+	case h >= Horizon1Week && h%Horizon1Week == 0:
+		return fmt.Sprintf("%dw", h/Horizon1Week)
+	case h >= Horizon1Day && h%Horizon1Day == 0:
+		return fmt.Sprintf("%dd", h/Horizon1Day)
+	case h >= Horizon1Hour && h%Horizon1Hour == 0:
+		return fmt.Sprintf("%dh", h/Horizon1Hour)
+	}
+	return fmt.Sprintf("%dm", int(h))
+}
+
+// ParseChartHorizon accepts minutes ("60") or the String form ("1h").
+func ParseChartHorizon(val string) (ChartHorizon, error) {
+	if n, err := strconv.Atoi(val); err == nil {
+		h := ChartHorizon(n)
+		if !h.Valid() {
+			return 0, errors.New(fmt.Sprintf("Unsupported chart horizon %s", val))
+		}
+		return h, nil
+	}
+	for _, h := range chartHorizons {
+		if h.String() == val {
+			return h, nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("Unsupported chart horizon %s", val))
+}
+
+type ChartMode string
+
+const (
+	ChartModeFrom ChartMode = "From"
+	ChartModeUpTo ChartMode = "UpTo"
+)
+
+// PriceSide picks which price of a two sided sample or quote is used.
+type PriceSide string
+
+const (
+	PriceMid PriceSide = "Mid"
+	PriceBid PriceSide = "Bid"
+	PriceAsk PriceSide = "Ask"
+)
+
+// SaxoChartSample is one OHLC sample. Instruments quoted two ways (FX,
+// CFDs) fill the Bid/Ask variants instead of Open/High/Low/Close.
+type SaxoChartSample struct {
+	Time     string
+	Open     float64
+	High     float64
+	Low      float64
+	Close    float64
+	Volume   float64
+	Interest float64
+	OpenBid  float64
+	OpenAsk  float64
+	HighBid  float64
+	HighAsk  float64
+	LowBid   float64
+	LowAsk   float64
+	CloseBid float64
+	CloseAsk float64
+}
+
+type SaxoChartInfo struct {
+	DelayedByMinutes int
+	ExchangeId       string
+	FirstSampleTime  string
+	Horizon          int
+}
+
+type SaxoChart struct {
+	ChartInfo        SaxoChartInfo
+	Data             []SaxoChartSample
+	DataVersion      int
+	DisplayAndFormat SaxoFormat
+}
+
+type Bar struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume float64
+}
+
+type BarSeries struct {
+	Uic       int
+	AssetType string
+	Horizon   ChartHorizon
+	Side      PriceSide
+	Bars      []Bar
+}
+
+func (s SaxoChartSample) TwoSided() bool {
+	return s.Open == 0 && s.Close == 0 && (s.CloseBid != 0 || s.CloseAsk != 0)
+}
+
+// Bar converts the sample, using side for two sided samples.
+func (s SaxoChartSample) Bar(side PriceSide) (Bar, error) {
+	t, err := ParseSaxoDate(s.Time)
+	if err != nil {
+		return Bar{}, err
+	}
+	b := Bar{Time: t, Volume: s.Volume}
+	if !s.TwoSided() {
+		b.Open, b.High, b.Low, b.Close = s.Open, s.High, s.Low, s.Close
+		return b, nil
+	}
+	switch side {
+	case PriceBid:
+		b.Open, b.High, b.Low, b.Close = s.OpenBid, s.HighBid, s.LowBid, s.CloseBid
+	case PriceAsk:
+		b.Open, b.High, b.Low, b.Close = s.OpenAsk, s.HighAsk, s.LowAsk, s.CloseAsk
+	default:
+		b.Open = (s.OpenBid + s.OpenAsk) / 2
+		b.High = (s.HighBid + s.HighAsk) / 2
+		b.Low = (s.LowBid + s.LowAsk) / 2
+		b.Close = (s.CloseBid + s.CloseAsk) / 2
+	}
+	return b, nil
+}
+
+func SamplesToBars(samples []SaxoChartSample, side PriceSide) ([]Bar, error) {
+	bars := make([]Bar, 0, len(samples))
+	for _, s := range samples {
+		b, err := s.Bar(side)
+		if err != nil {
+			return nil, err
+		}
+		bars = append(bars, b)
+	}
+	return bars, nil
+}
+
+// Chart fetches up to count samples starting from (ChartModeFrom) or ending
+// at (ChartModeUpTo) t. A zero t returns the most recent samples.
+func (api *SaxoAPI) Chart(uic int, assetType string, horizon ChartHorizon, count int, t time.Time, mode ChartMode) (*SaxoChart, error) {
+	if !horizon.Valid() {
+		return nil, errors.New(fmt.Sprintf("Unsupported chart horizon %d", horizon))
+	}
+	if count <= 0 || count > 1200 {
+		count = 1200
+	}
+	api.Params = map[string]string{
+		"Uic":         strconv.Itoa(uic),
+		"AssetType":   assetType,
+		"Horizon":     strconv.Itoa(int(horizon)),
+		"Count":       strconv.Itoa(count),
+		"FieldGroups": "ChartInfo,Data,DisplayAndFormat",
+	}
+	if !t.IsZero() {
+		if mode == "" {
+			mode = ChartModeUpTo
+		}
+		api.Params["Time"] = t.UTC().Format(time.RFC3339)
+		api.Params["Mode"] = string(mode)
+	}
+	data, err := api.Call("chart")
+	if err != nil {
+		return nil, err
+	}
+	var chart SaxoChart
+	err = json.Unmarshal(data, &chart)
+	if err != nil {
+		return nil, err
+	}
+	return &chart, nil
+}
+
+// ChartHistory pages backwards from to until from is reached, returning the
+// samples in time order without duplicates.
+func (api *SaxoAPI) ChartHistory(uic int, assetType string, horizon ChartHorizon, from, to time.Time) ([]SaxoChartSample, error) {
+	seen := make(map[string]bool)
+	var samples []SaxoChartSample
+	upTo := to
+	for {
+		chart, err := api.Chart(uic, assetType, horizon, 1200, upTo, ChartModeUpTo)
+		if err != nil {
+			return samples, err
+		}
+		if len(chart.Data) == 0 {
+			break
+		}
+		earliest := upTo
+		added := 0
+		for _, s := range chart.Data {
+			t, err := ParseSaxoDate(s.Time)
+			if err != nil {
+				return samples, err
+			}
+			if t.Before(earliest) {
+				earliest = t
+			}
+			if t.Before(from) || t.After(to) || seen[s.Time] {
+				continue
+			}
+			seen[s.Time] = true
+			samples = append(samples, s)
+			added++
+		}
+		if added == 0 || !earliest.After(from) {
+			break
+		}
+		upTo = earliest.Add(-time.Second)
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		ti, _ := ParseSaxoDate(samples[i].Time)
+		tj, _ := ParseSaxoDate(samples[j].Time)
+		return ti.Before(tj)
+	})
+	return samples, nil
+}
+
+// BarSeries fetches history between from and to as plain bars.
+func (api *SaxoAPI) BarSeries(uic int, assetType string, horizon ChartHorizon, side PriceSide, from, to time.Time) (*BarSeries, error) {
+	samples, err := api.ChartHistory(uic, assetType, horizon, from, to)
+	if err != nil {
+		return nil, err
+	}
+	bars, err := SamplesToBars(samples, side)
+	if err != nil {
+		return nil, err
+	}
+	return &BarSeries{Uic: uic, AssetType: assetType, Horizon: horizon, Side: side, Bars: bars}, nil
+}
+
+// VolumeProfile sums bar volume into slices of the intraday window
+// starting at start (offset from midnight in loc) and lasting duration,
+// over every day of the series. Only the proportions matter when the
+// result is used as a VWAPSchedule profile; with no volume the slices are
+// weighted equally.
+func (bs BarSeries) VolumeProfile(loc *time.Location, start, duration time.Duration, slices int) []float64 {
+	if slices <= 0 {
+		return nil
+	}
+	profile := make([]float64, slices)
+	width := duration / time.Duration(slices)
+	if width <= 0 {
+		// the window is too short to slice, weight the slices equally
+		for i := range profile {
+			profile[i] = 1
+		}
+		return profile
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	var total float64
+	for _, b := range bs.Bars {
+		t := b.Time.In(loc)
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		offset := t.Sub(midnight) - start
+		if offset < 0 || offset >= duration {
+			continue
+		}
+		i := int(offset / width)
+		if i >= slices {
+			// duration does not divide evenly, the remainder joins the last slice
+			i = slices - 1
+		}
+		profile[i] += b.Volume
+		total += b.Volume
+	}
+	if total == 0 {
+		for i := range profile {
+			profile[i] = 1
+		}
+	}
+	return profile
+}
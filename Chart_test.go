@@ -0,0 +1,148 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestChartSampleBar(t *testing.T) {
+	oneSided := SaxoChartSample{Time: "2024-03-04T14:30:00Z", Open: 10, High: 12, Low: 9, Close: 11, Volume: 500}
+	twoSided := SaxoChartSample{Time: "2024-03-04T14:30:00Z",
+		OpenBid: 1.0998, OpenAsk: 1.1000, HighBid: 1.1010, HighAsk: 1.1012,
+		LowBid: 1.0990, LowAsk: 1.0992, CloseBid: 1.1004, CloseAsk: 1.1006}
+	tests := []struct {
+		name   string
+		sample SaxoChartSample
+		side   PriceSide
+		want   [4]float64
+	}{
+		{"one sided ignores the side", oneSided, PriceBid, [4]float64{10, 12, 9, 11}},
+		{"bid", twoSided, PriceBid, [4]float64{1.0998, 1.1010, 1.0990, 1.1004}},
+		{"ask", twoSided, PriceAsk, [4]float64{1.1000, 1.1012, 1.0992, 1.1006}},
+		{"mid", twoSided, PriceMid, [4]float64{1.0999, 1.1011, 1.0991, 1.1005}},
+		{"no side is mid", twoSided, "", [4]float64{1.0999, 1.1011, 1.0991, 1.1005}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.sample.Bar(tt.side)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameValues([]float64{b.Open, b.High, b.Low, b.Close}, tt.want[:]) {
+				t.Errorf("bar = %+v, want OHLC %v", b, tt.want)
+			}
+			if !b.Time.Equal(time.Date(2024, 3, 4, 14, 30, 0, 0, time.UTC)) || b.Volume != tt.sample.Volume {
+				t.Errorf("bar time and volume = %v, %g", b.Time, b.Volume)
+			}
+		})
+	}
+	if _, err := SamplesToBars([]SaxoChartSample{oneSided, {Time: "soon"}}, PriceMid); err == nil {
+		t.Error("SamplesToBars with a bad time did not fail")
+	}
+}
+
+func TestParseChartHorizon(t *testing.T) {
+	for _, tt := range []struct {
+		val  string
+		want ChartHorizon
+	}{
+		{"1", Horizon1Minute},
+		{"60", Horizon1Hour},
+		{"1h", Horizon1Hour},
+		{"4h", Horizon4Hours},
+		{"1d", Horizon1Day},
+		{"1w", Horizon1Week},
+		{"1mo", Horizon1Month},
+		{"7", 0},
+		{"3d", 0},
+	} {
+		h, err := ParseChartHorizon(tt.val)
+		if tt.want == 0 {
+			if err == nil {
+				t.Errorf("ParseChartHorizon(%s) = %v, want an error", tt.val, h)
+			}
+			continue
+		}
+		if err != nil || h != tt.want {
+			t.Errorf("ParseChartHorizon(%s) = %v, %v, want %v", tt.val, h, err, tt.want)
+		}
+	}
+}
+
+func TestBarSeriesPagesBack(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+	var all []SaxoChartSample
+	for i := 0; i < 3000; i++ {
+		c := float64(i)
+		all = append(all, SaxoChartSample{Time: start.Add(time.Duration(i) * time.Minute).Format(time.RFC3339), Open: c, High: c, Low: c, Close: c})
+	}
+	// each page holds the samples at or before Time, overlapping by one
+	fake.handle("GET chart/v1/charts", func(r fakeRequest) (int, string) {
+		upTo, _ := time.Parse(time.RFC3339, r.Query.Get("Time"))
+		var page []SaxoChartSample
+		for _, s := range all {
+			if t, _ := time.Parse(time.RFC3339, s.Time); !t.After(upTo.Add(time.Minute)) {
+				page = append(page, s)
+			}
+		}
+		if len(page) > 1200 {
+			page = page[len(page)-1200:]
+		}
+		ba, _ := json.Marshal(SaxoChart{Data: page})
+		return http.StatusOK, string(ba)
+	})
+	from, to := start.Add(100*time.Minute), start.Add(2899*time.Minute)
+	series, err := api.BarSeries(21, "Stock", Horizon1Minute, PriceMid, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series.Bars) != 2800 {
+		t.Fatalf("%d bars, want 2800", len(series.Bars))
+	}
+	for i, b := range series.Bars {
+		if b.Close != float64(100+i) {
+			t.Fatalf("bar %d closes at %g, want %d", i, b.Close, 100+i)
+		}
+	}
+	if n := len(fake.calls("GET chart/v1/charts")); n != 3 {
+		t.Errorf("%d chart requests, want 3", n)
+	}
+	q := fake.calls("GET chart/v1/charts")[0].Query
+	if q.Get("Mode") != "UpTo" || q.Get("Horizon") != "1" || q.Get("Count") != "1200" || q.Get("Uic") != "21" {
+		t.Errorf("first chart request = %v", q)
+	}
+}
+
+func TestVolumeProfile(t *testing.T) {
+	ny, _ := time.LoadLocation("America/New_York")
+	var bars []Bar
+	for day := 4; day <= 5; day++ {
+		for _, b := range []struct {
+			hour, min int
+			volume    float64
+		}{
+			{9, 0, 1000}, // before the window
+			{9, 30, 300},
+			{10, 0, 100},
+			{10, 59, 100},
+			{11, 0, 1000}, // after the window
+		} {
+			bars = append(bars, Bar{Time: time.Date(2024, 3, day, b.hour, b.min, 0, 0, ny).UTC(), Volume: b.volume})
+		}
+	}
+	bs := BarSeries{Bars: bars}
+	profile := bs.VolumeProfile(ny, 9*time.Hour+30*time.Minute, 90*time.Minute, 3)
+	if !sameValues(profile, []float64{600, 200, 200}) {
+		t.Errorf("profile = %v, want the volume summed over both days", profile)
+	}
+	// an uneven split puts the remainder in the last slice
+	if profile := bs.VolumeProfile(ny, 9*time.Hour+30*time.Minute, 90*time.Minute, 4); !sameValues(profile, []float64{600, 200, 0, 200}) {
+		t.Errorf("uneven profile = %v", profile)
+	}
+	if profile := bs.VolumeProfile(ny, 12*time.Hour, time.Hour, 2); !sameValues(profile, []float64{1, 1}) {
+		t.Errorf("profile without volume = %v", profile)
+	}
+}
@@ -0,0 +1,137 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CloseResult reports what was done for one net position by ClosePosition,
+// ClosePartial or FlattenAccount.
+type CloseResult struct {
+	NetPositionId string
+	Uic           int
+	AssetType     string
+	BuySell       string
+	Amount        float64
+	Orders        []SaxoOrder
+	Err           error
+}
+
+// asset types which need ToOpenClose set on closing orders
+var openCloseAssetTypes = map[string]bool{
+	"StockOption":      true,
+	"StockIndexOption": true,
+	"FuturesOption":    true,
+}
+
+func (api *SaxoAPI) findNetPosition(netPositionId string) (*SaxoNetPosition, error) {
+	positions, err := api.NetPositions(SaxoInstruction{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range positions {
+		if positions[i].NetPositionId == netPositionId {
+			return &positions[i], nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("No net position %s", netPositionId))
+}
+
+// positionAccount is the account holding a net position, falling back to
+// the api account.
+func positionAccount(api *SaxoAPI, np SaxoNetPosition) string {
+	if np.NetPositionBase.AccountKey != "" {
+		return np.NetPositionBase.AccountKey
+	}
+	return api.AccountKey
+}
+
+// CloseOrder builds the market order which reduces a net position by amount,
+// in the account holding the position.
+func (api *SaxoAPI) CloseOrder(np SaxoNetPosition, amount float64) (SaxoOrderInstruction, error) {
+	base := np.NetPositionBase
+	if !base.CanBeClosed {
+		reason := base.NonTradableReason
+		if reason == "" {
+			reason = "position cannot be closed"
+		}
+		return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("Cannot close %s: %s", np.NetPositionId, reason))
+	}
+	if base.Amount == 0 {
+		return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("Net position %s is already flat", np.NetPositionId))
+	}
+	if amount <= 0 || amount > math.Abs(base.Amount) {
+		return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("Close amount %g outside position size %g", amount, math.Abs(base.Amount)))
+	}
+	if !base.IsMarketOpen {
+		return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("Cannot close %s at market: market is closed", np.NetPositionId))
+	}
+	buysell := "Sell"
+	if base.Amount < 0 {
+		buysell = "Buy"
+	}
+	instr, err := makeOrder(positionAccount(api, np), amount, 0, base.Uic, base.AssetType, buysell, "DayOrder", "Market")
+	if err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	if openCloseAssetTypes[base.AssetType] {
+		instr.ToOpenClose = "ToClose"
+	}
+	return instr, nil
+}
+
+func (api *SaxoAPI) closeNetPosition(np SaxoNetPosition, amount float64) CloseResult {
+	result := CloseResult{NetPositionId: np.NetPositionId, Uic: np.NetPositionBase.Uic, AssetType: np.NetPositionBase.AssetType, Amount: amount}
+	instr, err := api.CloseOrder(np, amount)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.BuySell = instr.BuySell
+	result.Orders, result.Err = api.PlaceOrder(instr)
+	return result
+}
+
+func (api *SaxoAPI) ClosePosition(netPositionId string) (*CloseResult, error) {
+	np, err := api.findNetPosition(netPositionId)
+	if err != nil {
+		return nil, err
+	}
+	result := api.closeNetPosition(*np, math.Abs(np.NetPositionBase.Amount))
+	return &result, result.Err
+}
+
+func (api *SaxoAPI) ClosePartial(netPositionId string, amount float64) (*CloseResult, error) {
+	np, err := api.findNetPosition(netPositionId)
+	if err != nil {
+		return nil, err
+	}
+	result := api.closeNetPosition(*np, amount)
+	return &result, result.Err
+}
+
+// FlattenAccount sends closing orders for every open net position held in
+// api.AccountKey, or every position of the paper book. Positions in the
+// client's other accounts are left alone. The error is only set when
+// positions could not be listed; per position failures are in the results.
+func (api *SaxoAPI) FlattenAccount() ([]CloseResult, error) {
+	if api.Paper == nil && api.AccountKey == "" {
+		return nil, errors.New("No account key set")
+	}
+	positions, err := api.NetPositions(SaxoInstruction{})
+	if err != nil {
+		return nil, err
+	}
+	var results []CloseResult
+	for _, np := range positions {
+		if np.NetPositionBase.Amount == 0 {
+			continue
+		}
+		if api.Paper == nil && positionAccount(api, np) != api.AccountKey {
+			continue
+		}
+		results = append(results, api.closeNetPosition(np, math.Abs(np.NetPositionBase.Amount)))
+	}
+	return results, nil
+}
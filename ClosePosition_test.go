@@ -0,0 +1,112 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func testNetPosition(id, account string, uic int, assetType string, amount float64) SaxoNetPosition {
+	var np SaxoNetPosition
+	np.NetPositionId = id
+	np.NetPositionBase.AccountKey = account
+	np.NetPositionBase.Uic = uic
+	np.NetPositionBase.AssetType = assetType
+	np.NetPositionBase.Amount = amount
+	np.NetPositionBase.CanBeClosed = true
+	np.NetPositionBase.IsMarketOpen = true
+	return np
+}
+
+func TestCloseOrder(t *testing.T) {
+	api := NewSaxoAPICall("token")
+	api.AccountKey = "account"
+	closed := testNetPosition("4", "account", 21, "Stock", 100)
+	closed.NetPositionBase.IsMarketOpen = false
+	locked := testNetPosition("5", "account", 21, "Stock", 100)
+	locked.NetPositionBase.CanBeClosed = false
+	tests := []struct {
+		name        string
+		np          SaxoNetPosition
+		amount      float64
+		buysell     string
+		account     string
+		toOpenClose string
+		wantErr     bool
+	}{
+		{name: "long closes with a sell", np: testNetPosition("1", "account", 21, "Stock", 100), amount: 100, buysell: "Sell", account: "account"},
+		{name: "short closes with a buy", np: testNetPosition("2", "account", 21, "Stock", -50), amount: 50, buysell: "Buy", account: "account"},
+		{name: "partial close", np: testNetPosition("1", "account", 21, "Stock", 100), amount: 30, buysell: "Sell", account: "account"},
+		{name: "position in another account", np: testNetPosition("3", "other", 21, "Stock", 10), amount: 10, buysell: "Sell", account: "other"},
+		{name: "position without an account", np: testNetPosition("3", "", 21, "Stock", 10), amount: 10, buysell: "Sell", account: "account"},
+		{name: "option closes to close", np: testNetPosition("6", "account", 31, "StockOption", -2), amount: 2, buysell: "Buy", account: "account", toOpenClose: "ToClose"},
+		{name: "more than the position", np: testNetPosition("1", "account", 21, "Stock", 100), amount: 101, wantErr: true},
+		{name: "zero amount", np: testNetPosition("1", "account", 21, "Stock", 100), wantErr: true},
+		{name: "flat position", np: testNetPosition("1", "account", 21, "Stock", 0), amount: 1, wantErr: true},
+		{name: "market closed", np: closed, amount: 100, wantErr: true},
+		{name: "cannot be closed", np: locked, amount: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instr, err := api.CloseOrder(tt.np, tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if instr.BuySell != tt.buysell || instr.Amount != tt.amount || instr.AccountKey != tt.account || instr.ToOpenClose != tt.toOpenClose {
+				t.Errorf("order %s %g in %s %q, want %s %g in %s %q", instr.BuySell, instr.Amount, instr.AccountKey, instr.ToOpenClose, tt.buysell, tt.amount, tt.account, tt.toOpenClose)
+			}
+			if instr.OrderType != "Market" || instr.Uic != tt.np.NetPositionBase.Uic || instr.AssetType != tt.np.NetPositionBase.AssetType {
+				t.Errorf("order %+v", instr)
+			}
+		})
+	}
+}
+
+func TestFlattenAccount(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	positions := []SaxoNetPosition{
+		testNetPosition("1", "account", 21, "Stock", 100),
+		testNetPosition("2", "account", 22, "Stock", -40),
+		testNetPosition("3", "other", 23, "Stock", 10),
+		testNetPosition("4", "account", 24, "Stock", 0),
+	}
+	ba, _ := json.Marshal(SaxoData[SaxoNetPosition]{Data: positions})
+	fake.reply("GET port/v1/netpositions/me", string(ba))
+	fake.reply("POST trade/v2/orders", `{"OrderId":"9"}`)
+	results, err := api.FlattenAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].NetPositionId != "1" || results[1].NetPositionId != "2" {
+		t.Fatalf("results %+v, want positions 1 and 2 closed", results)
+	}
+	want := []struct {
+		uic     int
+		buysell string
+		amount  float64
+	}{{21, "Sell", 100}, {22, "Buy", 40}}
+	posts := fake.calls("POST trade/v2/orders")
+	if len(posts) != len(want) {
+		t.Fatalf("%d orders sent, want %d", len(posts), len(want))
+	}
+	for i, p := range posts {
+		var instr SaxoOrderInstruction
+		if err := json.Unmarshal([]byte(p.Body), &instr); err != nil {
+			t.Fatal(err)
+		}
+		w := want[i]
+		if instr.Uic != w.uic || instr.BuySell != w.buysell || instr.Amount != w.amount || instr.AccountKey != "account" {
+			t.Errorf("order %d = %+v, want %s %g of %d", i, instr, w.buysell, w.amount, w.uic)
+		}
+		if results[i].Err != nil || len(results[i].Orders) != 1 || results[i].Orders[0].OrderId != "9" {
+			t.Errorf("result %d = %+v", i, results[i])
+		}
+	}
+
+	api.AccountKey = ""
+	if _, err := api.FlattenAccount(); err == nil {
+		t.Error("flattened without an account key")
+	}
+}
@@ -0,0 +1,421 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SaxoExchangeSession struct {
+	StartTime string
+	EndTime   string
+	State     string
+}
+
+type SaxoExchange struct {
+	AllDay               bool
+	CountryCode          string
+	Currency             string
+	ExchangeId           string
+	ExchangeSessions     []SaxoExchangeSession
+	Mic                  string
+	Name                 string
+	PriceSourceName      string
+	TimeZone             int
+	TimeZoneAbbreviation string
+	TimeZoneId           string
+	TimeZoneOffset       string
+}
+
+// Session states in which orders are matched.
+var openSessionStates = map[string]bool{
+	"AutomatedTrading":   true,
+	"CallAuctionTrading": true,
+	"TradingAtLast":      true,
+}
+
+type TradingSession struct {
+	Start time.Time
+	End   time.Time
+	State string
+}
+
+func (s TradingSession) Open() bool {
+	return openSessionStates[s.State]
+}
+
+func (api *SaxoAPI) Exchanges() ([]SaxoExchange, error) {
+	api.Params = map[string]string{"$top": "1000"}
+	data, err := api.Call("exchanges")
+	if err != nil {
+		return nil, err
+	}
+	var exchanges SaxoData[SaxoExchange]
+	err = json.Unmarshal(data, &exchanges)
+	if err != nil {
+		return nil, err
+	}
+	return exchanges.Data, nil
+}
+
+func (api *SaxoAPI) Exchange(exchangeId string) (*SaxoExchange, error) {
+	api.Params = map[string]string{"ExchangeId": exchangeId}
+	data, err := api.Call("exchange")
+	if err != nil {
+		return nil, err
+	}
+	var exchange SaxoExchange
+	err = json.Unmarshal(data, &exchange)
+	if err != nil {
+		return nil, err
+	}
+	return &exchange, nil
+}
+
+// Location returns the exchange time zone, falling back to the fixed
+// offset when the zone id is not known locally.
+func (e SaxoExchange) Location() (*time.Location, error) {
+	if e.TimeZoneId != "" {
+		if loc, err := time.LoadLocation(e.TimeZoneId); err == nil {
+			return loc, nil
+		}
+	}
+	if e.TimeZoneOffset == "" {
+		return time.UTC, nil
+	}
+	offset := e.TimeZoneOffset
+	sign := 1
+	if strings.HasPrefix(offset, "-") {
+		sign = -1
+	}
+	var h, m, sec int
+	if _, err := fmt.Sscanf(strings.TrimLeft(offset, "+-"), "%d:%d:%d", &h, &m, &sec); err != nil {
+		return nil, errors.New(fmt.Sprintf("Bad time zone offset %s", e.TimeZoneOffset))
+	}
+	name := e.TimeZoneAbbreviation
+	if name == "" {
+		name = e.TimeZoneOffset
+	}
+	return time.FixedZone(name, sign*(h*3600+m*60+sec)), nil
+}
+
+// Sessions returns the published sessions in time order.
+func (e SaxoExchange) Sessions() ([]TradingSession, error) {
+	sessions := make([]TradingSession, 0, len(e.ExchangeSessions))
+	for _, s := range e.ExchangeSessions {
+		start, err := ParseSaxoDate(s.StartTime)
+		if err != nil {
+			return nil, err
+		}
+		end, err := ParseSaxoDate(s.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, TradingSession{Start: start, End: end, State: s.State})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Start.Before(sessions[j].Start) })
+	return sessions, nil
+}
+
+// openIntervals merges back to back open sessions, such as an auction
+// followed by continuous trading.
+func openIntervals(sessions []TradingSession) []TradingSession {
+	var out []TradingSession
+	for _, s := range sessions {
+		if !s.Open() {
+			continue
+		}
+		if n := len(out); n > 0 && !s.Start.After(out[n-1].End) {
+			if s.End.After(out[n-1].End) {
+				out[n-1].End = s.End
+			}
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Holidays returns the weekdays inside the published session range on
+// which the exchange has no open session, as dates at UTC midnight.
+func (e SaxoExchange) Holidays() ([]time.Time, error) {
+	loc, err := e.Location()
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := e.Sessions()
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+	days := tradingDates(openIntervals(sessions), loc)
+	var holidays []time.Time
+	first := dateOnly(sessions[0].Start.In(loc))
+	last := dateOnly(sessions[len(sessions)-1].End.In(loc))
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		if weekday(d) && !days[d.Format("2006-01-02")] {
+			holidays = append(holidays, d)
+		}
+	}
+	return holidays, nil
+}
+
+func weekday(d time.Time) bool {
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+}
+
+// tradingDates returns the exchange dates touched by the open sessions; a
+// session ending at midnight does not touch the next date.
+func tradingDates(open []TradingSession, loc *time.Location) map[string]bool {
+	days := make(map[string]bool)
+	for _, s := range open {
+		last := dateOnly(s.End.Add(-time.Nanosecond).In(loc))
+		for d := dateOnly(s.Start.In(loc)); !d.After(last); d = d.AddDate(0, 0, 1) {
+			days[d.Format("2006-01-02")] = true
+		}
+	}
+	return days
+}
+
+type calendarCache struct {
+	Fetched   time.Time
+	Exchanges []SaxoExchange
+}
+
+// TradingCalendar answers session questions from exchange reference data,
+// cached in a local file and refreshed once older than TTL. Saxo only
+// publishes sessions for the coming days; beyond them TradingDays counts
+// weekdays that are not in Holidays, which is keyed by ExchangeId.
+type TradingCalendar struct {
+	Path     string
+	TTL      time.Duration
+	Holidays map[string][]time.Time
+
+	api   *SaxoAPI
+	mu    sync.Mutex
+	cache calendarCache
+	index map[string]*SaxoExchange
+}
+
+func NewTradingCalendar(api *SaxoAPI, path string, ttl time.Duration) (*TradingCalendar, error) {
+	cal := &TradingCalendar{Path: path, TTL: ttl, Holidays: make(map[string][]time.Time), api: api}
+	if path == "" {
+		return cal, nil
+	}
+	ba, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cal, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(ba, &cal.cache); err != nil {
+		return nil, err
+	}
+	cal.reindex()
+	return cal, nil
+}
+
+func (cal *TradingCalendar) reindex() {
+	cal.index = make(map[string]*SaxoExchange, len(cal.cache.Exchanges))
+	for i := range cal.cache.Exchanges {
+		e := &cal.cache.Exchanges[i]
+		cal.index[e.ExchangeId] = e
+		if e.Mic != "" {
+			cal.index[e.Mic] = e
+		}
+	}
+}
+
+// Refresh refetches all exchanges and writes the cache file.
+func (cal *TradingCalendar) Refresh() error {
+	cal.mu.Lock()
+	defer cal.mu.Unlock()
+	return cal.refresh()
+}
+
+func (cal *TradingCalendar) refresh() error {
+	if cal.api == nil {
+		return errors.New("Trading calendar has no API to refresh from")
+	}
+	exchanges, err := cal.api.Exchanges()
+	if err != nil {
+		return err
+	}
+	cal.cache = calendarCache{Fetched: time.Now(), Exchanges: exchanges}
+	cal.reindex()
+	if cal.Path == "" {
+		return nil
+	}
+	ba, err := json.Marshal(cal.cache)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cal.Path, ba)
+}
+
+// Exchange looks an exchange up by ExchangeId or MIC, refreshing the cache
+// when it is stale or the exchange is missing. It returns a copy of the
+// cached exchange.
+func (cal *TradingCalendar) Exchange(id string) (*SaxoExchange, error) {
+	cal.mu.Lock()
+	defer cal.mu.Unlock()
+	e, err := cal.lookup(id)
+	if err != nil {
+		return nil, err
+	}
+	c := *e
+	c.ExchangeSessions = append([]SaxoExchangeSession(nil), e.ExchangeSessions...)
+	return &c, nil
+}
+
+// lookup must be called with cal.mu held
+func (cal *TradingCalendar) lookup(id string) (*SaxoExchange, error) {
+	stale := cal.index == nil || (cal.TTL > 0 && time.Since(cal.cache.Fetched) > cal.TTL)
+	if e, ok := cal.index[id]; ok && !stale {
+		return e, nil
+	}
+	if err := cal.refresh(); err != nil {
+		// a stale entry is better than none
+		if e, ok := cal.index[id]; ok {
+			return e, nil
+		}
+		return nil, err
+	}
+	if e, ok := cal.index[id]; ok {
+		return e, nil
+	}
+	return nil, errors.New(fmt.Sprintf("Unknown exchange %s", id))
+}
+
+// AddHoliday records a closed date for the exchange given by ExchangeId
+// or MIC.
+func (cal *TradingCalendar) AddHoliday(id string, day time.Time) error {
+	cal.mu.Lock()
+	defer cal.mu.Unlock()
+	e, err := cal.lookup(id)
+	if err != nil {
+		return err
+	}
+	cal.Holidays[e.ExchangeId] = append(cal.Holidays[e.ExchangeId], day)
+	return nil
+}
+
+// open returns the merged open sessions and the exchange time zone.
+func (e *SaxoExchange) open() ([]TradingSession, *time.Location, error) {
+	loc, err := e.Location()
+	if err != nil {
+		return nil, nil, err
+	}
+	sessions, err := e.Sessions()
+	if err != nil {
+		return nil, nil, err
+	}
+	return openIntervals(sessions), loc, nil
+}
+
+// IsOpen reports whether the exchange is in an open session at t.
+func (cal *TradingCalendar) IsOpen(id string, t time.Time) (bool, error) {
+	e, err := cal.Exchange(id)
+	if err != nil {
+		return false, err
+	}
+	if e.AllDay {
+		return true, nil
+	}
+	open, _, err := e.open()
+	if err != nil {
+		return false, err
+	}
+	for _, s := range open {
+		if !t.Before(s.Start) && t.Before(s.End) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NextOpen returns the start of the first open session after t, or t
+// itself for an exchange that trades all day.
+func (cal *TradingCalendar) NextOpen(id string, t time.Time) (time.Time, error) {
+	e, err := cal.Exchange(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if e.AllDay {
+		return t, nil
+	}
+	open, _, err := e.open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, s := range open {
+		if s.Start.After(t) {
+			return s.Start, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("No published session of %s opens after %s", id, t.Format(time.RFC3339)))
+}
+
+// NextClose returns the end of the open session containing t, or of the
+// next one.
+func (cal *TradingCalendar) NextClose(id string, t time.Time) (time.Time, error) {
+	e, err := cal.Exchange(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	open, _, err := e.open()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, s := range open {
+		if s.End.After(t) {
+			return s.End, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("No published session of %s closes after %s", id, t.Format(time.RFC3339)))
+}
+
+// TradingDays returns the exchange dates from from to to inclusive on
+// which the exchange trades, as dates at UTC midnight. The calendar dates
+// of from and to are used as they are, without converting them to the
+// exchange time zone.
+func (cal *TradingCalendar) TradingDays(id string, from, to time.Time) ([]time.Time, error) {
+	e, err := cal.Exchange(id)
+	if err != nil {
+		return nil, err
+	}
+	open, loc, err := e.open()
+	if err != nil {
+		return nil, err
+	}
+	cal.mu.Lock()
+	holidays := make(map[string]bool)
+	for _, h := range cal.Holidays[e.ExchangeId] {
+		holidays[h.Format("2006-01-02")] = true
+	}
+	cal.mu.Unlock()
+	published := tradingDates(open, loc)
+	var first, last time.Time
+	if len(open) > 0 {
+		first, last = dateOnly(open[0].Start.In(loc)), dateOnly(open[len(open)-1].End.In(loc))
+	}
+	var days []time.Time
+	for d := dateOnly(from); !d.After(dateOnly(to)); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		if len(open) > 0 && !d.Before(first) && !d.After(last) {
+			if published[key] {
+				days = append(days, d)
+			}
+			continue
+		}
+		if weekday(d) && !holidays[key] {
+			days = append(days, d)
+		}
+	}
+	return days, nil
+}
@@ -0,0 +1,204 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// testExchanges returns a New York exchange with a pre-open auction and a
+// holiday on Wednesday 6 March 2024, a Tokyo exchange whose sessions start
+// on the previous UTC date and an all day FX venue.
+func testExchanges(t *testing.T) string {
+	ny, _ := time.LoadLocation("America/New_York")
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	session := func(loc *time.Location, day, from, to int, state string) SaxoExchangeSession {
+		d := time.Date(2024, 3, day, 0, 0, 0, 0, loc)
+		return SaxoExchangeSession{
+			StartTime: d.Add(time.Duration(from) * time.Minute).UTC().Format(time.RFC3339),
+			EndTime:   d.Add(time.Duration(to) * time.Minute).UTC().Format(time.RFC3339),
+			State:     state,
+		}
+	}
+	nasdaq := SaxoExchange{ExchangeId: "NASDAQ", Mic: "XNAS", TimeZoneId: "America/New_York"}
+	for day := 4; day <= 8; day++ {
+		if day == 6 {
+			nasdaq.ExchangeSessions = append(nasdaq.ExchangeSessions, session(ny, day, 0, 24*60, "Closed"))
+			continue
+		}
+		nasdaq.ExchangeSessions = append(nasdaq.ExchangeSessions,
+			session(ny, day, 0, 9*60+28, "Closed"),
+			session(ny, day, 16*60, 24*60, "Closed"),
+			// listed out of order on purpose
+			session(ny, day, 9*60+30, 16*60, "AutomatedTrading"),
+			session(ny, day, 9*60+28, 9*60+30, "CallAuctionTrading"),
+		)
+	}
+	tse := SaxoExchange{ExchangeId: "TSE", Mic: "XTKS", TimeZoneId: "Asia/Tokyo"}
+	for day := 4; day <= 5; day++ {
+		tse.ExchangeSessions = append(tse.ExchangeSessions, session(tokyo, day, 8*60, 15*60, "AutomatedTrading"))
+	}
+	fx := SaxoExchange{ExchangeId: "SBFX", AllDay: true}
+	ba, err := json.Marshal(SaxoData[SaxoExchange]{Data: []SaxoExchange{nasdaq, tse, fx}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ba)
+}
+
+func testCalendar(t *testing.T) *TradingCalendar {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET ref/v1/exchanges", testExchanges(t))
+	cal, err := NewTradingCalendar(api, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cal
+}
+
+func TestExchangeLocation(t *testing.T) {
+	tests := []struct {
+		name   string
+		e      SaxoExchange
+		offset int
+		fails  bool
+	}{
+		{"zone id", SaxoExchange{TimeZoneId: "Asia/Tokyo", TimeZoneOffset: "-01:00:00"}, 9 * 3600, false},
+		{"unknown zone id falls back to the offset", SaxoExchange{TimeZoneId: "Nowhere/Else", TimeZoneOffset: "-05:30:00"}, -(5*3600 + 1800), false},
+		{"positive offset", SaxoExchange{TimeZoneOffset: "+02:00:00"}, 2 * 3600, false},
+		{"no zone", SaxoExchange{}, 0, false},
+		{"bad offset", SaxoExchange{TimeZoneOffset: "two hours"}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := tt.e.Location()
+			if tt.fails {
+				if err == nil {
+					t.Errorf("Location = %v, want an error", loc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// January avoids daylight saving time
+			if _, offset := time.Date(2024, 1, 15, 12, 0, 0, 0, loc).Zone(); offset != tt.offset {
+				t.Errorf("offset = %d, want %d", offset, tt.offset)
+			}
+		})
+	}
+}
+
+func TestTradingCalendarSessions(t *testing.T) {
+	cal := testCalendar(t)
+	ny, _ := time.LoadLocation("America/New_York")
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, ny) }
+
+	for _, tt := range []struct {
+		t    time.Time
+		open bool
+	}{
+		{at(4, 9, 0), false},
+		{at(4, 9, 28), true},
+		{at(4, 12, 0), true},
+		{at(4, 16, 0), false},
+		{at(6, 12, 0), false},
+	} {
+		open, err := cal.IsOpen("XNAS", tt.t)
+		if err != nil || open != tt.open {
+			t.Errorf("IsOpen(%v) = %v, %v, want %v", tt.t, open, err, tt.open)
+		}
+	}
+
+	// the auction and continuous trading merge into one open interval
+	if next, err := cal.NextOpen("NASDAQ", at(4, 9, 0)); err != nil || !next.Equal(at(4, 9, 28)) {
+		t.Errorf("NextOpen before the auction = %v, %v", next, err)
+	}
+	if next, err := cal.NextClose("NASDAQ", at(4, 9, 29)); err != nil || !next.Equal(at(4, 16, 0)) {
+		t.Errorf("NextClose in the auction = %v, %v", next, err)
+	}
+	// the holiday is skipped
+	if next, err := cal.NextOpen("NASDAQ", at(5, 17, 0)); err != nil || !next.Equal(at(7, 9, 28)) {
+		t.Errorf("NextOpen over the holiday = %v, %v", next, err)
+	}
+	if _, err := cal.NextOpen("NASDAQ", at(8, 17, 0)); err == nil {
+		t.Error("NextOpen after the published sessions did not fail")
+	}
+
+	now := at(9, 3, 0)
+	if open, err := cal.IsOpen("SBFX", now); err != nil || !open {
+		t.Errorf("IsOpen all day = %v, %v", open, err)
+	}
+	if next, err := cal.NextOpen("SBFX", now); err != nil || !next.Equal(now) {
+		t.Errorf("NextOpen all day = %v, %v", next, err)
+	}
+}
+
+func TestTradingCalendarHolidays(t *testing.T) {
+	cal := testCalendar(t)
+	date := func(day int) time.Time { return time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC) }
+	dates := func(days []time.Time) []string {
+		s := make([]string, len(days))
+		for i, d := range days {
+			s[i] = d.Format("01-02")
+		}
+		return s
+	}
+	same := func(got, want []string) bool {
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	e, err := cal.Exchange("XNAS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	holidays, err := e.Holidays()
+	if err != nil || !same(dates(holidays), []string{"03-06"}) {
+		t.Errorf("Holidays = %v, %v", dates(holidays), err)
+	}
+
+	// a holiday added by MIC applies when asking by ExchangeId
+	if err := cal.AddHoliday("XNAS", date(11)); err != nil {
+		t.Fatal(err)
+	}
+	days, err := cal.TradingDays("NASDAQ", date(4), date(15))
+	want := []string{"03-04", "03-05", "03-07", "03-08", "03-12", "03-13", "03-14", "03-15"}
+	if err != nil || !same(dates(days), want) {
+		t.Errorf("TradingDays = %v, %v, want %v", dates(days), err, want)
+	}
+	if err := cal.AddHoliday("XNYS", date(11)); err == nil {
+		t.Error("AddHoliday for an unknown exchange did not fail")
+	}
+
+	// Tokyo sessions start on the previous UTC date but count on the
+	// exchange date
+	days, err = cal.TradingDays("TSE", date(3), date(5))
+	if err != nil || !same(dates(days), []string{"03-04", "03-05"}) {
+		t.Errorf("Tokyo TradingDays = %v, %v", dates(days), err)
+	}
+}
+
+func TestTradingCalendarExchangeIsACopy(t *testing.T) {
+	cal := testCalendar(t)
+	e, err := cal.Exchange("NASDAQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.AllDay = true
+	e.ExchangeSessions[0].State = "AutomatedTrading"
+	again, err := cal.Exchange("NASDAQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.AllDay || again.ExchangeSessions[0].State != "Closed" {
+		t.Errorf("changing a returned exchange changed the cache: %+v", again.ExchangeSessions[0])
+	}
+}
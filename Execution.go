@@ -0,0 +1,519 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type ExecutionAlgo string
+
+const (
+	AlgoTWAP    ExecutionAlgo = "TWAP"
+	AlgoVWAP    ExecutionAlgo = "VWAP"
+	AlgoIceberg ExecutionAlgo = "Iceberg"
+)
+
+// ExecutionSchedule describes how a parent order is sliced. TWAP splits the
+// window into equal slices, VWAP weights the slices by Profile (typically
+// historical volume per slice) and Iceberg keeps a single child of at most
+// ClipSize working until the parent is filled.
+type ExecutionSchedule struct {
+	Algo     ExecutionAlgo
+	Start    time.Time
+	Duration time.Duration
+	Slices   int
+	Profile  []float64
+	ClipSize float64
+}
+
+func TWAPSchedule(start time.Time, duration time.Duration, slices int) ExecutionSchedule {
+	return ExecutionSchedule{Algo: AlgoTWAP, Start: start, Duration: duration, Slices: slices}
+}
+
+func VWAPSchedule(start time.Time, duration time.Duration, profile []float64) ExecutionSchedule {
+	return ExecutionSchedule{Algo: AlgoVWAP, Start: start, Duration: duration, Slices: len(profile), Profile: profile}
+}
+
+func IcebergSchedule(clipSize float64) ExecutionSchedule {
+	return ExecutionSchedule{Algo: AlgoIceberg, ClipSize: clipSize}
+}
+
+// weights returns the cumulative fraction of the parent due after each slice
+func (s ExecutionSchedule) weights() []float64 {
+	cum := make([]float64, s.Slices)
+	var total float64
+	for i := 0; i < s.Slices; i++ {
+		w := 1.0
+		if s.Algo == AlgoVWAP {
+			w = s.Profile[i]
+		}
+		total += w
+		cum[i] = total
+	}
+	for i := range cum {
+		cum[i] /= total
+	}
+	return cum
+}
+
+func (s ExecutionSchedule) validate() error {
+	switch s.Algo {
+	case AlgoTWAP, AlgoVWAP:
+		if s.Slices <= 0 || s.Duration <= 0 {
+			return errors.New(fmt.Sprintf("%s schedule needs a duration and at least one slice", s.Algo))
+		}
+		if s.Algo == AlgoVWAP {
+			if len(s.Profile) != s.Slices {
+				return errors.New("VWAP profile must have one weight per slice")
+			}
+			var total float64
+			for _, w := range s.Profile {
+				if w < 0 {
+					return errors.New("VWAP profile weights must not be negative")
+				}
+				total += w
+			}
+			if total == 0 {
+				return errors.New("VWAP profile is empty")
+			}
+		}
+	case AlgoIceberg:
+		if s.ClipSize <= 0 {
+			return errors.New("Iceberg schedule needs a positive clip size")
+		}
+	default:
+		return errors.New(fmt.Sprintf("Unknown execution algo %s", s.Algo))
+	}
+	return nil
+}
+
+// ParentOrder is the full order to be worked. LotSize, when set, rounds
+// child amounts down to a multiple of it.
+type ParentOrder struct {
+	Uic       int
+	AssetType string
+	BuySell   string
+	Amount    float64
+	OrderType string
+	Price     float64
+	Duration  string
+	LotSize   float64
+}
+
+type ChildOrder struct {
+	OrderId      string
+	Slice        int
+	Amount       float64
+	FilledAmount float64
+	AveragePrice float64
+	Status       string
+	Final        bool
+
+	cancelRequested bool
+}
+
+type ParentStatus struct {
+	Id           string
+	Parent       ParentOrder
+	FilledAmount float64
+	AveragePrice float64
+	Remaining    float64
+	Children     []ChildOrder
+	Cancelled    bool
+	Done         bool
+	Err          error
+}
+
+type ParentExecution struct {
+	Id       string
+	Parent   ParentOrder
+	Schedule ExecutionSchedule
+	Updates  chan ParentStatus
+
+	mu        sync.Mutex
+	children  []*ChildOrder
+	nextSlice int
+	due       bool
+	cancelled bool
+	done      bool
+	// err is the latest step's error until the execution is done, when
+	// it is the reason it stopped
+	err      error
+	failures int
+	retryAt  time.Time
+}
+
+func (pe *ParentExecution) Status() ParentStatus {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	return pe.status()
+}
+
+// status must be called with pe.mu held
+func (pe *ParentExecution) status() ParentStatus {
+	st := ParentStatus{Id: pe.Id, Parent: pe.Parent, Cancelled: pe.cancelled, Done: pe.done, Err: pe.err}
+	var value float64
+	for _, c := range pe.children {
+		st.Children = append(st.Children, *c)
+		st.FilledAmount += c.FilledAmount
+		value += c.FilledAmount * c.AveragePrice
+	}
+	if st.FilledAmount > 0 {
+		st.AveragePrice = value / st.FilledAmount
+	}
+	st.Remaining = pe.Parent.Amount - st.FilledAmount
+	return st
+}
+
+// publish must be called with pe.mu held
+func (pe *ParentExecution) publish() {
+	st := pe.status()
+	select {
+	case pe.Updates <- st:
+	default:
+		select {
+		case <-pe.Updates:
+		default:
+		}
+		pe.Updates <- st
+	}
+}
+
+// ExecutionEngine works parent orders by sending and managing child orders
+// through the api. All api traffic happens in Step, so the engine should own
+// its api while it runs. A child order that fails to place is sent again
+// after RetryDelay, doubling with each failure in a row, and the parent
+// stops with the error after MaxSendFailures failures in a row.
+type ExecutionEngine struct {
+	RetryDelay      time.Duration
+	MaxSendFailures int
+
+	api     *SaxoAPI
+	tracker *OrderTracker
+
+	mu         sync.Mutex
+	executions map[string]*ParentExecution
+	nextId     int
+	stop       chan struct{}
+	stopped    chan struct{}
+	now        func() time.Time
+}
+
+func NewExecutionEngine(api *SaxoAPI) *ExecutionEngine {
+	tracker := NewOrderTracker(api)
+	tracker.Events = nil
+	return &ExecutionEngine{
+		RetryDelay:      time.Second,
+		MaxSendFailures: 5,
+		api:             api,
+		tracker:         tracker,
+		executions:      make(map[string]*ParentExecution),
+		nextId:          1,
+		now:             time.Now,
+	}
+}
+
+func (e *ExecutionEngine) Submit(parent ParentOrder, schedule ExecutionSchedule) (*ParentExecution, error) {
+	if parent.Amount <= 0 {
+		return nil, errors.New("Parent order amount must be positive")
+	}
+	if parent.BuySell != "Buy" && parent.BuySell != "Sell" {
+		return nil, errors.New(fmt.Sprintf("Invalid BuySell %s", parent.BuySell))
+	}
+	if parent.OrderType == "" {
+		parent.OrderType = "Market"
+	}
+	if parent.OrderType != "Market" && parent.Price <= 0 {
+		return nil, errors.New(fmt.Sprintf("%s parent order needs a price", parent.OrderType))
+	}
+	if err := schedule.validate(); err != nil {
+		return nil, err
+	}
+	if schedule.Start.IsZero() {
+		schedule.Start = e.now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pe := &ParentExecution{
+		Id:       strconv.Itoa(e.nextId),
+		Parent:   parent,
+		Schedule: schedule,
+		Updates:  make(chan ParentStatus, 100),
+	}
+	e.nextId++
+	e.executions[pe.Id] = pe
+	return pe, nil
+}
+
+// Cancel stops a parent execution; working children are cancelled on the
+// next Step.
+func (e *ExecutionEngine) Cancel(id string) error {
+	e.mu.Lock()
+	pe, ok := e.executions[id]
+	e.mu.Unlock()
+	if !ok {
+		return errors.New(fmt.Sprintf("No execution %s", id))
+	}
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	pe.cancelled = true
+	return nil
+}
+
+func (e *ExecutionEngine) Executions() []*ParentExecution {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var list []*ParentExecution
+	for _, pe := range e.executions {
+		list = append(list, pe)
+	}
+	return list
+}
+
+// Step refreshes child order state and sends or cancels children as the
+// schedules require.
+func (e *ExecutionEngine) Step() error {
+	var pollErr error
+	if len(e.tracker.Open()) > 0 {
+		pollErr = e.tracker.Poll()
+	}
+	now := e.now()
+	for _, pe := range e.Executions() {
+		e.advance(pe, now)
+	}
+	return pollErr
+}
+
+func (e *ExecutionEngine) Start(interval time.Duration) {
+	e.mu.Lock()
+	if e.stop != nil {
+		e.mu.Unlock()
+		return
+	}
+	e.stop = make(chan struct{})
+	e.stopped = make(chan struct{})
+	stop, stopped := e.stop, e.stopped
+	e.mu.Unlock()
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				e.Step()
+			}
+		}
+	}()
+}
+
+func (e *ExecutionEngine) Stop() {
+	e.mu.Lock()
+	stop, stopped := e.stop, e.stopped
+	e.stop, e.stopped = nil, nil
+	e.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+func (e *ExecutionEngine) advance(pe *ParentExecution, now time.Time) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	if pe.done {
+		return
+	}
+	// errors from the last step are only kept while a failed child waits
+	// to be sent again
+	if pe.failures == 0 {
+		pe.err = nil
+	}
+	changed := e.refresh(pe)
+
+	var filled, working float64
+	var live []*ChildOrder
+	for _, c := range pe.children {
+		filled += c.FilledAmount
+		if !c.Final {
+			working += c.Amount - c.FilledAmount
+			live = append(live, c)
+		}
+	}
+
+	if pe.cancelled || filled >= pe.Parent.Amount {
+		for _, c := range live {
+			if c.cancelRequested {
+				continue
+			}
+			// a cancel usually fails because the child has just ended; it
+			// is retried until the tracker sees the final status
+			if err := e.api.CancelOrder(c.OrderId); err != nil {
+				pe.err = err
+				continue
+			}
+			c.cancelRequested = true
+		}
+		if len(live) == 0 {
+			pe.done = true
+			changed = true
+		}
+		if changed {
+			pe.publish()
+		}
+		return
+	}
+
+	remaining := pe.Parent.Amount - filled
+	switch pe.Schedule.Algo {
+	case AlgoIceberg:
+		if len(live) == 0 && !now.Before(pe.retryAt) {
+			changed = e.send(pe, now, 0, math.Min(pe.Schedule.ClipSize, remaining), remaining) || changed
+		}
+	case AlgoTWAP, AlgoVWAP:
+		if now.Before(pe.Schedule.Start) {
+			break
+		}
+		slice := int(now.Sub(pe.Schedule.Start) / (pe.Schedule.Duration / time.Duration(pe.Schedule.Slices)))
+		if slice >= pe.Schedule.Slices {
+			slice = pe.Schedule.Slices - 1
+		}
+		if slice >= pe.nextSlice {
+			for _, c := range live {
+				if c.cancelRequested {
+					continue
+				}
+				if err := e.api.CancelOrder(c.OrderId); err != nil {
+					pe.err = err
+					continue
+				}
+				c.cancelRequested = true
+			}
+			pe.nextSlice = slice + 1
+			pe.due = true
+		}
+		// unfilled parts of earlier slices roll into the current one once
+		// the tracker has their final fills, so late fills are counted
+		pending := false
+		for _, c := range live {
+			if c.cancelRequested {
+				pending = true
+			}
+		}
+		if pe.due && !pending && !now.Before(pe.retryAt) {
+			current := pe.nextSlice - 1
+			target := pe.Schedule.weights()[current] * pe.Parent.Amount
+			if current == pe.Schedule.Slices-1 {
+				target = pe.Parent.Amount
+			}
+			failures := pe.failures
+			if e.send(pe, now, current, target-filled-working, remaining-working) {
+				changed = true
+			}
+			// a failed slice is sent again after the retry delay
+			pe.due = pe.failures > failures
+		}
+		if !pe.done && !pe.due && pe.nextSlice >= pe.Schedule.Slices && !pe.working() {
+			// the last slice ended without filling the parent
+			pe.err = errors.New(fmt.Sprintf("%s schedule ended with %g of %g unfilled", pe.Schedule.Algo, remaining, pe.Parent.Amount))
+			pe.done = true
+			changed = true
+		}
+	}
+	if changed {
+		pe.publish()
+	}
+}
+
+// working must be called with pe.mu held
+func (pe *ParentExecution) working() bool {
+	for _, c := range pe.children {
+		if !c.Final {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh must be called with pe.mu held
+func (e *ExecutionEngine) refresh(pe *ParentExecution) bool {
+	changed := false
+	for _, c := range pe.children {
+		tracked, ok := e.tracker.Order(c.OrderId)
+		if !ok {
+			continue
+		}
+		if tracked.FilledAmount != c.FilledAmount || tracked.Final != c.Final {
+			changed = true
+		}
+		c.FilledAmount = tracked.FilledAmount
+		if tracked.AveragePrice != 0 {
+			c.AveragePrice = tracked.AveragePrice
+		} else if c.FilledAmount > 0 && c.AveragePrice == 0 {
+			c.AveragePrice = tracked.Order.MarketPrice
+		}
+		c.Status = tracked.Status
+		if tracked.Final {
+			c.Final = true
+			e.tracker.Untrack(c.OrderId)
+		}
+	}
+	return changed
+}
+
+// send must be called with pe.mu held. max caps the child at what is still
+// unallocated for the parent.
+func (e *ExecutionEngine) send(pe *ParentExecution, now time.Time, slice int, qty, max float64) bool {
+	if qty > max {
+		qty = max
+	}
+	if lot := pe.Parent.LotSize; lot > 0 {
+		qty = math.Floor(qty/lot+1e-9) * lot
+	}
+	if qty <= 0 {
+		return false
+	}
+	instr, err := e.api.MakeOrder(qty, pe.Parent.Price, pe.Parent.Uic, pe.Parent.AssetType, pe.Parent.BuySell, pe.Parent.Duration, pe.Parent.OrderType)
+	if err != nil {
+		e.sendFailed(pe, now, err)
+		return true
+	}
+	orders, err := e.api.PlaceOrder(instr)
+	if err == nil && len(orders) == 0 {
+		err = errors.New("Child order placement returned no order")
+	}
+	if err != nil {
+		e.sendFailed(pe, now, err)
+		return true
+	}
+	pe.failures = 0
+	child := &ChildOrder{OrderId: orders[0].OrderId, Slice: slice, Amount: qty, Status: orders[0].Status}
+	pe.children = append(pe.children, child)
+	e.tracker.Track(orders[0])
+	e.refresh(pe)
+	return true
+}
+
+// sendFailed must be called with pe.mu held
+func (e *ExecutionEngine) sendFailed(pe *ParentExecution, now time.Time, err error) {
+	pe.err = err
+	pe.failures++
+	if e.MaxSendFailures > 0 && pe.failures >= e.MaxSendFailures {
+		pe.err = errors.New(fmt.Sprintf("Giving up after %d failed child orders: %s", pe.failures, err.Error()))
+		pe.done = true
+		return
+	}
+	delay := e.RetryDelay
+	for i := 1; i < pe.failures && i < 10; i++ {
+		delay *= 2
+	}
+	pe.retryAt = now.Add(delay)
+}
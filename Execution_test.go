@@ -0,0 +1,210 @@
+package saxotrader
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// paperEngine works orders against a paper book quoting Uic 21 at 100/101
+// with no displayed size.
+func paperEngine(start time.Time) (*ExecutionEngine, *time.Time) {
+	api := NewSaxoAPICall("token")
+	api.AccountKey = "PAPER"
+	api.Paper = NewPaperBook("EUR", 1e6)
+	api.Paper.UpdatePrice(SaxoPrice{Uic: 21, AssetType: "Stock", Quote: SaxoQuote{BidPrice: 100, AskPrice: 101}})
+	e := NewExecutionEngine(api)
+	now := start
+	e.now = func() time.Time { return now }
+	return e, &now
+}
+
+func childAmounts(st ParentStatus) string {
+	var amounts []string
+	for _, c := range st.Children {
+		amounts = append(amounts, fmt.Sprintf("%d:%g", c.Slice, c.Amount))
+	}
+	return strings.Join(amounts, " ")
+}
+
+func TestExecutionSchedules(t *testing.T) {
+	start := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	parent := ParentOrder{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 100}
+	tests := []struct {
+		name     string
+		parent   ParentOrder
+		schedule ExecutionSchedule
+		steps    []time.Duration
+		children string
+		average  float64
+	}{
+		{
+			name:     "TWAP equal slices",
+			parent:   parent,
+			schedule: TWAPSchedule(start, 4*time.Minute, 4),
+			steps:    []time.Duration{0, 30 * time.Second, time.Minute, 2 * time.Minute, 3 * time.Minute, 3*time.Minute + time.Second},
+			children: "0:25 1:25 2:25 3:25",
+			average:  101,
+		},
+		{
+			name:     "TWAP catches up on missed slices",
+			parent:   parent,
+			schedule: TWAPSchedule(start, 4*time.Minute, 4),
+			steps:    []time.Duration{0, 2 * time.Minute, 3 * time.Minute, 3*time.Minute + time.Second},
+			children: "0:25 2:50 3:25",
+			average:  101,
+		},
+		{
+			name:     "VWAP weights slices by profile",
+			parent:   parent,
+			schedule: VWAPSchedule(start, 3*time.Minute, []float64{1, 2, 1}),
+			steps:    []time.Duration{0, time.Minute, 2 * time.Minute, 2*time.Minute + time.Second},
+			children: "0:25 1:50 2:25",
+			average:  101,
+		},
+		{
+			name:     "lot size rounds children down",
+			parent:   ParentOrder{Uic: 21, AssetType: "Stock", BuySell: "Sell", Amount: 100, LotSize: 10},
+			schedule: TWAPSchedule(start, 3*time.Minute, 3),
+			steps:    []time.Duration{0, time.Minute, 2 * time.Minute, 2*time.Minute + time.Second},
+			children: "0:30 1:30 2:40",
+			average:  100,
+		},
+		{
+			name:     "iceberg refills each clip",
+			parent:   ParentOrder{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 10, OrderType: "Limit", Price: 102},
+			schedule: IcebergSchedule(4),
+			steps:    []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second},
+			children: "0:4 0:4 0:2",
+			average:  101,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, now := paperEngine(start)
+			pe, err := e.Submit(tt.parent, tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range tt.steps {
+				*now = start.Add(d)
+				if err := e.Step(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			st := pe.Status()
+			if got := childAmounts(st); got != tt.children {
+				t.Errorf("children %s, want %s", got, tt.children)
+			}
+			if !st.Done || st.Err != nil || st.FilledAmount != tt.parent.Amount || st.AveragePrice != tt.average {
+				t.Errorf("status done %v err %v filled %g at %g, want done with %g at %g", st.Done, st.Err, st.FilledAmount, st.AveragePrice, tt.parent.Amount, tt.average)
+			}
+		})
+	}
+}
+
+func TestExecutionTWAPRollsUnfilledSlices(t *testing.T) {
+	start := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	e, now := paperEngine(start)
+	// bids below the ask never fill
+	pe, err := e.Submit(ParentOrder{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 100, OrderType: "Limit", Price: 99}, TWAPSchedule(start, 2*time.Minute, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []time.Duration{0, time.Minute, time.Minute + time.Second} {
+		*now = start.Add(d)
+		e.Step()
+	}
+	st := pe.Status()
+	if got := childAmounts(st); got != "0:50 1:100" {
+		t.Fatalf("children %s, want the unfilled first slice rolled into the second", got)
+	}
+	if !st.Children[0].Final || st.Children[0].Status != "Cancelled" || st.Children[1].Final {
+		t.Errorf("children %+v", st.Children)
+	}
+	e.Cancel(pe.Id)
+	for _, d := range []time.Duration{2 * time.Minute, 2*time.Minute + time.Second} {
+		*now = start.Add(d)
+		e.Step()
+	}
+	if st := pe.Status(); !st.Done || !st.Cancelled || st.FilledAmount != 0 || len(e.api.Paper.OrderList()) != 0 {
+		t.Errorf("cancelled parent %+v left orders %v", st, e.api.Paper.OrderList())
+	}
+}
+
+func TestExecutionCancelAfterFillIsNotFatal(t *testing.T) {
+	start := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	api, fake := newFakeSaxo(t)
+	fake.reply("POST trade/v2/orders", `{"OrderId":"1"}`)
+	working := `{"Data":[{"OrderId":"1","Amount":4,"Status":"Working"}]}`
+	fake.handle("GET port/v1/orders/me", func(fakeRequest) (int, string) { return http.StatusOK, working })
+	// the child fills just before the cancel reaches it
+	fake.handle("DELETE trade/v2/orders/1", func(fakeRequest) (int, string) {
+		working = `{"Data":[]}`
+		return http.StatusNotFound, `{"ErrorCode":"OrderNotFound"}`
+	})
+	serveActivities(fake, map[string][]SaxoOrderActivity{"1": {{Status: "FinalFill", Amount: 4, FilledAmount: 4, AveragePrice: 100}}})
+	e := NewExecutionEngine(api)
+	e.now = func() time.Time { return start }
+	pe, err := e.Submit(ParentOrder{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 10}, IcebergSchedule(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Step()
+	e.Cancel(pe.Id)
+	e.Step()
+	if st := pe.Status(); st.Err == nil || st.Done {
+		t.Fatalf("failed cancel: err %v done %v, want a reported error and a live parent", st.Err, st.Done)
+	}
+	e.Step()
+	st := pe.Status()
+	if !st.Done || st.Err != nil || st.FilledAmount != 4 {
+		t.Errorf("status done %v err %v filled %g, want done without error with 4 filled", st.Done, st.Err, st.FilledAmount)
+	}
+	if n := len(fake.calls("DELETE trade/v2/orders/1")); n != 1 {
+		t.Errorf("%d cancels sent for a filled child, want 1", n)
+	}
+}
+
+func TestExecutionRetryBackoff(t *testing.T) {
+	start := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	api, fake := newFakeSaxo(t)
+	fake.handle("POST trade/v2/orders", func(fakeRequest) (int, string) {
+		return http.StatusBadRequest, `{"ErrorCode":"InstrumentNotTradable"}`
+	})
+	e := NewExecutionEngine(api)
+	e.RetryDelay = time.Second
+	e.MaxSendFailures = 3
+	now := start
+	e.now = func() time.Time { return now }
+	pe, err := e.Submit(ParentOrder{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 10}, IcebergSchedule(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		at    time.Duration
+		sends int
+		done  bool
+	}{
+		{0, 1, false},
+		{500 * time.Millisecond, 1, false},
+		{time.Second, 2, false},
+		// the delay doubles after the second failure
+		{2 * time.Second, 2, false},
+		{3 * time.Second, 3, true},
+		{time.Minute, 3, true},
+	}
+	for _, s := range steps {
+		now = start.Add(s.at)
+		e.Step()
+		st := pe.Status()
+		if n := len(fake.calls("POST trade/v2/orders")); n != s.sends || st.Done != s.done || st.Err == nil {
+			t.Errorf("at %s: %d sends done %v err %v, want %d sends done %v", s.at, n, st.Done, st.Err, s.sends, s.done)
+		}
+	}
+	if err := pe.Status().Err; err == nil || !strings.Contains(err.Error(), "Giving up after 3") {
+		t.Errorf("final err = %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type FxForwardQuote struct {
+	Uic              int
+	ValueDate        string
+	SpotDate         string
+	SpotBid          float64
+	SpotAsk          float64
+	ForwardBid       float64
+	ForwardAsk       float64
+	ForwardPointsBid float64
+	ForwardPointsAsk float64
+}
+
+type FxSwapQuote struct {
+	Uic           int
+	NearDate      string
+	FarDate       string
+	SwapPointsBid float64
+	SwapPointsAsk float64
+}
+
+// ParseSaxoDate reads the date formats used by Saxo, either a plain date or
+// a full timestamp.
+func ParseSaxoDate(val string) (time.Time, error) {
+	if val == "" {
+		return time.Time{}, errors.New("Empty date")
+	}
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, nil
+	}
+	if len(val) >= 10 {
+		if t, err := time.Parse("2006-01-02", val[:10]); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprintf("Could not interpret %s as a date", val))
+}
+
+func fxDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// checkForwardDate validates a value date against the forward window of
+// FxForwards instrument details.
+func checkForwardDate(details SaxoAssetDetails, valueDate time.Time) error {
+	min, err := ParseSaxoDate(details.FxForwardMinForwardDate)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Uic %d has no forward date window", details.Uic))
+	}
+	max, err := ParseSaxoDate(details.FxForwardMaxForwardDate)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Uic %d has no forward date window", details.Uic))
+	}
+	d := dateOnly(valueDate)
+	if d.Before(dateOnly(min)) || d.After(dateOnly(max)) {
+		return errors.New(fmt.Sprintf("Value date %s outside forward window %s to %s", fxDate(d), fxDate(min), fxDate(max)))
+	}
+	return nil
+}
+
+// checkNearDate validates the near leg of a swap, which may settle on spot
+// and so before the forward window, but not in the past or after it.
+func checkNearDate(details SaxoAssetDetails, nearDate time.Time) error {
+	max, err := ParseSaxoDate(details.FxForwardMaxForwardDate)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Uic %d has no forward date window", details.Uic))
+	}
+	d := dateOnly(nearDate)
+	if d.Before(dateOnly(time.Now())) || d.After(dateOnly(max)) {
+		return errors.New(fmt.Sprintf("Near date %s outside swap window today to %s", fxDate(d), fxDate(max)))
+	}
+	return nil
+}
+
+// FxForwardDetails fetches the FxForwards instrument details, which carry
+// the allowed forward date window.
+func (api *SaxoAPI) FxForwardDetails(uic int) (*SaxoAssetDetails, error) {
+	details, err := api.InstrumentDetails(SaxoInstruction{Uic: uic, AssetTypes: []string{"FxForwards"}})
+	if err != nil {
+		return nil, err
+	}
+	if len(details) == 0 {
+		return nil, errors.New(fmt.Sprintf("No FxForwards details for Uic %d", uic))
+	}
+	return &details[0], nil
+}
+
+func (api *SaxoAPI) FxSpotOrder(uic int, buysell string, amount, price float64, orderType string) (SaxoOrderInstruction, error) {
+	return api.MakeOrder(amount, price, uic, "FxSpot", buysell, "DayOrder", orderType)
+}
+
+// FxForwardOrder builds an outright forward order for the value date, which
+// must lie in the forward window of details.
+func (api *SaxoAPI) FxForwardOrder(details SaxoAssetDetails, buysell string, amount, price float64, orderType string, valueDate time.Time) (SaxoOrderInstruction, error) {
+	if err := checkForwardDate(details, valueDate); err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	instr, err := api.MakeOrder(amount, price, details.Uic, "FxForwards", buysell, "DayOrder", orderType)
+	if err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	instr.ForwardDate = fxDate(valueDate)
+	return instr, nil
+}
+
+// FxSwapOrder builds a swap which buys (or sells) amount on the near date
+// and reverses it on the far date. The far date must lie in the forward
+// window of details and the near date between today and its end.
+func (api *SaxoAPI) FxSwapOrder(details SaxoAssetDetails, buysell string, amount float64, nearDate, farDate time.Time) (SaxoOrderInstruction, error) {
+	if !dateOnly(nearDate).Before(dateOnly(farDate)) {
+		return SaxoOrderInstruction{}, errors.New("Swap near leg must settle before the far leg")
+	}
+	if err := checkNearDate(details, nearDate); err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	if err := checkForwardDate(details, farDate); err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	instr, err := api.MakeOrder(amount, 0, details.Uic, "FxSwap", buysell, "DayOrder", "Market")
+	if err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	instr.ForwardDateNearLeg = fxDate(nearDate)
+	instr.ForwardDateFarLeg = fxDate(farDate)
+	return instr, nil
+}
+
+// FxForwardQuote prices an outright forward and reports the forward points
+// against the spot rate.
+func (api *SaxoAPI) FxForwardQuote(uic int, valueDate time.Time, amount float64) (*FxForwardQuote, error) {
+	price, err := api.Prices(SaxoInstruction{
+		Uic:         uic,
+		AssetTypes:  []string{"FxForwards"},
+		ForwardDate: fxDate(valueDate),
+		Amount:      amount,
+		FieldGroups: []string{"Quote", "InstrumentPriceDetails"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if price.Quote.ErrorCode != "" && !strings.EqualFold(price.Quote.ErrorCode, "None") {
+		return nil, errors.New(fmt.Sprintf("No forward price for Uic %d: %s", uic, price.Quote.ErrorCode))
+	}
+	if err := api.checkQuote(price); err != nil {
+		return nil, err
+	}
+	details := price.InstrumentPriceDetails
+	quote := &FxForwardQuote{
+		Uic:        uic,
+		ValueDate:  details.ValueDate,
+		SpotDate:   details.SpotDate,
+		SpotBid:    details.SpotBid,
+		SpotAsk:    details.SpotAsk,
+		ForwardBid: price.Quote.BidPrice,
+		ForwardAsk: price.Quote.AskPrice,
+	}
+	if quote.ValueDate == "" {
+		quote.ValueDate = fxDate(valueDate)
+	}
+	if quote.SpotBid != 0 && quote.SpotAsk != 0 {
+		quote.ForwardPointsBid = quote.ForwardBid - quote.SpotBid
+		quote.ForwardPointsAsk = quote.ForwardAsk - quote.SpotAsk
+	}
+	return quote, nil
+}
+
+// FxSwapQuote prices a swap between the two dates. Saxo quotes swaps in
+// swap points.
+func (api *SaxoAPI) FxSwapQuote(uic int, nearDate, farDate time.Time, amount float64) (*FxSwapQuote, error) {
+	price, err := api.Prices(SaxoInstruction{
+		Uic:                uic,
+		AssetTypes:         []string{"FxSwap"},
+		ForwardDateNearLeg: fxDate(nearDate),
+		ForwardDateFarLeg:  fxDate(farDate),
+		Amount:             amount,
+		FieldGroups:        []string{"Quote", "InstrumentPriceDetails"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if price.Quote.ErrorCode != "" && !strings.EqualFold(price.Quote.ErrorCode, "None") {
+		return nil, errors.New(fmt.Sprintf("No swap price for Uic %d: %s", uic, price.Quote.ErrorCode))
+	}
+	if err := api.checkQuote(price); err != nil {
+		return nil, err
+	}
+	return &FxSwapQuote{
+		Uic:           uic,
+		NearDate:      fxDate(nearDate),
+		FarDate:       fxDate(farDate),
+		SwapPointsBid: price.Quote.BidPrice,
+		SwapPointsAsk: price.Quote.AskPrice,
+	}, nil
+}
@@ -0,0 +1,150 @@
+package saxotrader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseSaxoDate(t *testing.T) {
+	for _, tt := range []struct {
+		val  string
+		want time.Time
+	}{
+		{"2024-03-15", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-15T00:00:00", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-15T14:30:05.123Z", time.Date(2024, 3, 15, 14, 30, 5, 123000000, time.UTC)},
+		{"2024-03-15T14:30:00+01:00", time.Date(2024, 3, 15, 13, 30, 0, 0, time.UTC)},
+	} {
+		got, err := ParseSaxoDate(tt.val)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseSaxoDate(%s) = %v, %v, want %v", tt.val, got, err, tt.want)
+		}
+	}
+	for _, val := range []string{"", "tomorrow", "2024-13-01"} {
+		if got, err := ParseSaxoDate(val); err == nil {
+			t.Errorf("ParseSaxoDate(%q) = %v, want an error", val, got)
+		}
+	}
+}
+
+// forwardDetails has a forward window from a week to a year out.
+func forwardDetails(today time.Time) SaxoAssetDetails {
+	return SaxoAssetDetails{
+		Uic:                     21,
+		AssetType:               "FxForwards",
+		FxForwardMinForwardDate: fxDate(today.AddDate(0, 0, 7)) + "T00:00:00Z",
+		FxForwardMaxForwardDate: fxDate(today.AddDate(1, 0, 0)) + "T00:00:00Z",
+	}
+}
+
+func TestFxForwardOrderWindow(t *testing.T) {
+	api, _ := newFakeSaxo(t)
+	today := dateOnly(time.Now())
+	details := forwardDetails(today)
+	tests := []struct {
+		name  string
+		date  time.Time
+		fails bool
+	}{
+		{"first day of the window", today.AddDate(0, 0, 7), false},
+		{"late in the day", today.AddDate(0, 3, 0).Add(23 * time.Hour), false},
+		{"last day of the window", today.AddDate(1, 0, 0), false},
+		{"before the window", today.AddDate(0, 0, 6), true},
+		{"after the window", today.AddDate(1, 0, 1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instr, err := api.FxForwardOrder(details, "Buy", 100000, 1.1, "Limit", tt.date)
+			if tt.fails {
+				if err == nil {
+					t.Errorf("FxForwardOrder = %+v, want an error", instr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if instr.AssetType != "FxForwards" || instr.ForwardDate != fxDate(tt.date) || instr.Uic != 21 {
+				t.Errorf("order = %+v", instr)
+			}
+		})
+	}
+	if _, err := api.FxForwardOrder(SaxoAssetDetails{Uic: 21}, "Buy", 100000, 1.1, "Limit", today.AddDate(0, 1, 0)); err == nil {
+		t.Error("FxForwardOrder without a forward window did not fail")
+	}
+}
+
+func TestFxSwapOrderDates(t *testing.T) {
+	api, _ := newFakeSaxo(t)
+	today := dateOnly(time.Now())
+	details := forwardDetails(today)
+	tests := []struct {
+		name      string
+		near, far time.Time
+		fails     bool
+	}{
+		{"spot near leg before the window", today.AddDate(0, 0, 2), today.AddDate(0, 1, 0), false},
+		{"both legs in the window", today.AddDate(0, 1, 0), today.AddDate(0, 6, 0), false},
+		{"near leg in the past", today.AddDate(0, 0, -1), today.AddDate(0, 1, 0), true},
+		{"near leg after the far leg", today.AddDate(0, 2, 0), today.AddDate(0, 1, 0), true},
+		{"legs on the same day", today.AddDate(0, 1, 0), today.AddDate(0, 1, 0), true},
+		{"far leg before the window", today.AddDate(0, 0, 1), today.AddDate(0, 0, 3), true},
+		{"far leg after the window", today.AddDate(0, 1, 0), today.AddDate(1, 1, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instr, err := api.FxSwapOrder(details, "Buy", 100000, tt.near, tt.far)
+			if tt.fails {
+				if err == nil {
+					t.Errorf("FxSwapOrder = %+v, want an error", instr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if instr.AssetType != "FxSwap" || instr.OrderType != "Market" || instr.ForwardDateNearLeg != fxDate(tt.near) || instr.ForwardDateFarLeg != fxDate(tt.far) {
+				t.Errorf("order = %+v", instr)
+			}
+		})
+	}
+}
+
+func TestFxForwardQuote(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET trade/v1/infoprices/list", `{"Data":[{"Uic":21,"AssetType":"FxForwards",
+		"Quote":{"BidPrice":1.1050,"AskPrice":1.1054},
+		"InstrumentPriceDetails":{"SpotBid":1.1000,"SpotAsk":1.1002,"SpotDate":"2024-03-06","ValueDate":"2024-06-06"}}]}`)
+	valueDate := time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC)
+	q, err := api.FxForwardQuote(21, valueDate, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(q.ForwardPointsBid-0.0050) > 1e-9 || math.Abs(q.ForwardPointsAsk-0.0052) > 1e-9 || q.ValueDate != "2024-06-06" {
+		t.Errorf("quote = %+v", q)
+	}
+	req := fake.calls("GET trade/v1/infoprices/list")[0].Query
+	if req.Get("AssetType") != "FxForwards" || req.Get("ForwardDate") != "2024-06-06" || req.Get("FieldGroups") != "Quote,InstrumentPriceDetails" {
+		t.Errorf("price request = %v", req)
+	}
+
+	fake.reply("GET trade/v1/infoprices/list", `{"Data":[{"Uic":21,"AssetType":"FxForwards","Quote":{"ErrorCode":"OutsideTradingHours"}}]}`)
+	if q, err := api.FxForwardQuote(21, valueDate, 100000); err == nil {
+		t.Errorf("quote with an error code = %+v, want an error", q)
+	}
+}
+
+func TestFxSwapQuote(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET trade/v1/infoprices/list", `{"Data":[{"Uic":21,"AssetType":"FxSwap","Quote":{"ErrorCode":"None","BidPrice":0.0021,"AskPrice":0.0024}}]}`)
+	near, far := time.Date(2024, 3, 6, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC)
+	q, err := api.FxSwapQuote(21, near, far, 100000)
+	if err != nil || q.SwapPointsBid != 0.0021 || q.SwapPointsAsk != 0.0024 || q.NearDate != "2024-03-06" || q.FarDate != "2024-06-06" {
+		t.Errorf("FxSwapQuote = %+v, %v", q, err)
+	}
+	req := fake.calls("GET trade/v1/infoprices/list")[0].Query
+	if req.Get("AssetType") != "FxSwap" || req.Get("ForwardDateNearLeg") != "2024-03-06" || req.Get("ForwardDateFarLeg") != "2024-06-06" {
+		t.Errorf("price request = %v", req)
+	}
+}
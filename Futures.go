@@ -0,0 +1,352 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type SaxoFuturesSpaceElement struct {
+	DaysToExpiry int
+	ExpiryDate   string
+	Symbol       string
+	Uic          int
+}
+
+type SaxoFuturesSpace struct {
+	BaseIdentifier string
+	Elements       []SaxoFuturesSpaceElement
+}
+
+type FuturesContract struct {
+	Uic    int
+	Symbol string
+	Expiry time.Time
+}
+
+// FuturesSpace lists every contract of the futures root behind a
+// ContinuousFutures Uic, nearest expiry first.
+func (api *SaxoAPI) FuturesSpace(continuousUic int) ([]FuturesContract, error) {
+	api.Params = map[string]string{"ContinuousFuturesUic": strconv.Itoa(continuousUic)}
+	data, err := api.Call("futures_space")
+	if err != nil {
+		return nil, err
+	}
+	var space SaxoFuturesSpace
+	err = json.Unmarshal(data, &space)
+	if err != nil {
+		return nil, err
+	}
+	contracts := make([]FuturesContract, 0, len(space.Elements))
+	for _, e := range space.Elements {
+		expiry, err := ParseSaxoDate(e.ExpiryDate)
+		if err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, FuturesContract{Uic: e.Uic, Symbol: e.Symbol, Expiry: expiry})
+	}
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Expiry.Before(contracts[j].Expiry) })
+	return contracts, nil
+}
+
+// FrontMonth picks the first contract expiring more than rollDays after t.
+func FrontMonth(contracts []FuturesContract, t time.Time, rollDays int) (FuturesContract, error) {
+	cutoff := t.AddDate(0, 0, rollDays)
+	for _, c := range contracts {
+		if c.Expiry.After(cutoff) {
+			return c, nil
+		}
+	}
+	return FuturesContract{}, errors.New(fmt.Sprintf("No contract expires after %s", fxDate(cutoff)))
+}
+
+func (api *SaxoAPI) FrontMonth(continuousUic int, rollDays int) (FuturesContract, error) {
+	contracts, err := api.FuturesSpace(continuousUic)
+	if err != nil {
+		return FuturesContract{}, err
+	}
+	return FrontMonth(contracts, time.Now(), rollDays)
+}
+
+type RollMethod string
+
+const (
+	// RollCalendar rolls DaysBefore days ahead of expiry.
+	RollCalendar RollMethod = "Calendar"
+	// RollVolume rolls on the first bar where the next contract trades
+	// more than the current one, falling back to the calendar rule.
+	RollVolume RollMethod = "Volume"
+)
+
+type BackAdjust string
+
+const (
+	AdjustNone       BackAdjust = "None"
+	AdjustDifference BackAdjust = "Difference"
+	AdjustRatio      BackAdjust = "Ratio"
+)
+
+type RollRule struct {
+	Method     RollMethod
+	DaysBefore int
+	Adjust     BackAdjust
+}
+
+// ContractBars is the history of one contract, bars in time order.
+type ContractBars struct {
+	Contract FuturesContract
+	Bars     []Bar
+}
+
+// FuturesRoll records where a continuous series moved to the next
+// contract. Gap is the next contract's close less the current one's at
+// the last shared bar before the roll, or their ratio for AdjustRatio.
+type FuturesRoll struct {
+	Time time.Time
+	From FuturesContract
+	To   FuturesContract
+	Gap  float64
+}
+
+type ContinuousSeries struct {
+	BarSeries
+	Rolls []FuturesRoll
+}
+
+func (rule RollRule) rollTime(cur, next ContractBars) time.Time {
+	calendar := dateOnly(cur.Contract.Expiry).AddDate(0, 0, -rule.DaysBefore)
+	if rule.Method != RollVolume {
+		return calendar
+	}
+	nextVol := make(map[int64]float64, len(next.Bars))
+	for _, b := range next.Bars {
+		nextVol[b.Time.UnixNano()] = b.Volume
+	}
+	for _, b := range cur.Bars {
+		if !b.Time.Before(cur.Contract.Expiry) {
+			break
+		}
+		if v, ok := nextVol[b.Time.UnixNano()]; ok && v > b.Volume {
+			return b.Time
+		}
+	}
+	return calendar
+}
+
+// rollGap compares the closes of both contracts at the last bar of cur
+// before the roll. It returns false without overlapping data.
+func rollGap(cur, next []Bar, roll time.Time, ratio bool) (float64, bool) {
+	i := sort.Search(len(cur), func(i int) bool { return !cur[i].Time.Before(roll) }) - 1
+	if i < 0 {
+		return 0, false
+	}
+	t := cur[i].Time
+	j := sort.Search(len(next), func(j int) bool { return next[j].Time.After(t) }) - 1
+	if j < 0 || cur[i].Close == 0 {
+		return 0, false
+	}
+	if ratio {
+		return next[j].Close / cur[i].Close, true
+	}
+	return next[j].Close - cur[i].Close, true
+}
+
+// StitchContinuous joins contract histories, ordered by expiry, into one
+// series. Each contract supplies bars until its roll, and with back
+// adjustment every bar before a roll is shifted (or scaled) by the gap so
+// the series has no jump at the roll. The contracts and their bars are
+// left unchanged.
+func StitchContinuous(contracts []ContractBars, rule RollRule) ([]Bar, []FuturesRoll, error) {
+	if len(contracts) == 0 {
+		return nil, nil, errors.New("No contracts to stitch")
+	}
+	contracts = append([]ContractBars(nil), contracts...)
+	sort.Slice(contracts, func(i, j int) bool { return contracts[i].Contract.Expiry.Before(contracts[j].Contract.Expiry) })
+	var rolls []FuturesRoll
+	var start time.Time
+	var segments [][]Bar
+	for i, c := range contracts {
+		end := time.Time{}
+		if i < len(contracts)-1 {
+			end = rule.rollTime(c, contracts[i+1])
+			if end.Before(start) {
+				end = start
+			}
+		}
+		var seg []Bar
+		for _, b := range c.Bars {
+			if b.Time.Before(start) || (!end.IsZero() && !b.Time.Before(end)) {
+				continue
+			}
+			seg = append(seg, b)
+		}
+		segments = append(segments, seg)
+		if !end.IsZero() {
+			roll := FuturesRoll{Time: end, From: c.Contract, To: contracts[i+1].Contract}
+			if rule.Adjust == AdjustRatio {
+				roll.Gap = 1
+			}
+			if rule.Adjust == AdjustDifference || rule.Adjust == AdjustRatio {
+				if gap, ok := rollGap(c.Bars, contracts[i+1].Bars, end, rule.Adjust == AdjustRatio); ok {
+					roll.Gap = gap
+				}
+			}
+			rolls = append(rolls, roll)
+			start = end
+		}
+	}
+	// walk back from the last contract, accumulating the adjustment
+	offset, factor := 0.0, 1.0
+	for i := len(segments) - 1; i >= 0; i-- {
+		if i < len(rolls) {
+			switch rule.Adjust {
+			case AdjustDifference:
+				offset += rolls[i].Gap
+			case AdjustRatio:
+				factor *= rolls[i].Gap
+			}
+		}
+		for k := range segments[i] {
+			b := &segments[i][k]
+			b.Open = b.Open*factor + offset
+			b.High = b.High*factor + offset
+			b.Low = b.Low*factor + offset
+			b.Close = b.Close*factor + offset
+		}
+	}
+	var bars []Bar
+	for _, seg := range segments {
+		bars = append(bars, seg...)
+	}
+	return bars, rolls, nil
+}
+
+// ContinuousFutures fetches the history of every contract of the root that
+// was live between from and to and stitches it with rule. Each contract is
+// only fetched while it can be in the series: from the expiry two
+// contracts back, when it becomes the next contract and its bars are
+// needed to place the roll into it, until its own expiry.
+func (api *SaxoAPI) ContinuousFutures(continuousUic int, horizon ChartHorizon, from, to time.Time, rule RollRule) (*ContinuousSeries, error) {
+	contracts, err := api.FuturesSpace(continuousUic)
+	if err != nil {
+		return nil, err
+	}
+	var histories []ContractBars
+	for i, c := range contracts {
+		if c.Expiry.Before(from) {
+			continue
+		}
+		start := from
+		if i >= 2 && contracts[i-2].Expiry.After(start) {
+			start = contracts[i-2].Expiry
+		}
+		end := to
+		if c.Expiry.Before(end) {
+			end = c.Expiry
+		}
+		bs, err := api.BarSeries(c.Uic, "ContractFutures", horizon, PriceMid, start, end)
+		if err != nil {
+			return nil, err
+		}
+		histories = append(histories, ContractBars{Contract: c, Bars: bs.Bars})
+		if c.Expiry.After(to) {
+			break
+		}
+	}
+	bars, rolls, err := StitchContinuous(histories, rule)
+	if err != nil {
+		return nil, err
+	}
+	return &ContinuousSeries{
+		BarSeries: BarSeries{Uic: continuousUic, AssetType: "ContinuousFutures", Horizon: horizon, Side: PriceMid, Bars: bars},
+		Rolls:     rolls,
+	}, nil
+}
+
+// FuturesRollPlan holds the orders that move a position from an expiring
+// contract into the next one.
+type FuturesRollPlan struct {
+	NetPositionId string
+	From          FuturesContract
+	To            FuturesContract
+	Close         SaxoOrderInstruction
+	Open          SaxoOrderInstruction
+}
+
+// RollOrders builds the market orders closing np and opening the same
+// exposure in next, both on the account holding np.
+func (api *SaxoAPI) RollOrders(np SaxoNetPosition, next FuturesContract) (FuturesRollPlan, error) {
+	amount := math.Abs(np.NetPositionBase.Amount)
+	closing, err := api.CloseOrder(np, amount)
+	if err != nil {
+		return FuturesRollPlan{}, err
+	}
+	opening, err := makeOrder(positionAccount(api, np), amount, 0, next.Uic, np.NetPositionBase.AssetType, oppositeSide(closing.BuySell), "DayOrder", "Market")
+	if err != nil {
+		return FuturesRollPlan{}, err
+	}
+	return FuturesRollPlan{
+		NetPositionId: np.NetPositionId,
+		From:          FuturesContract{Uic: np.NetPositionBase.Uic},
+		To:            next,
+		Close:         closing,
+		Open:          opening,
+	}, nil
+}
+
+// ExpiringRolls plans rolls for every net position in a contract of the
+// root that expires within days. Positions that cannot be rolled are
+// reported together in the error, alongside the plans for the rest.
+func (api *SaxoAPI) ExpiringRolls(continuousUic int, days int) ([]FuturesRollPlan, error) {
+	contracts, err := api.FuturesSpace(continuousUic)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := api.NetPositions(SaxoInstruction{})
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().AddDate(0, 0, days)
+	var plans []FuturesRollPlan
+	var errs []string
+	for _, np := range positions {
+		if np.NetPositionBase.AssetType != "ContractFutures" || np.NetPositionBase.Amount == 0 {
+			continue
+		}
+		for i, c := range contracts {
+			if c.Uic != np.NetPositionBase.Uic || c.Expiry.After(cutoff) {
+				continue
+			}
+			if i == len(contracts)-1 {
+				errs = append(errs, fmt.Sprintf("%s: no contract to roll into", c.Symbol))
+				continue
+			}
+			plan, err := api.RollOrders(np, contracts[i+1])
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %s", c.Symbol, err.Error()))
+				continue
+			}
+			plan.From = c
+			plans = append(plans, plan)
+		}
+	}
+	if len(errs) > 0 {
+		return plans, errors.New(fmt.Sprintf("Error planning rolls: %v", errs))
+	}
+	return plans, nil
+}
+
+// ExecuteRoll places the closing order and, once it is accepted, the
+// opening order.
+func (api *SaxoAPI) ExecuteRoll(plan FuturesRollPlan) ([]SaxoOrder, error) {
+	orders, err := api.PlaceOrder(plan.Close)
+	if err != nil {
+		return orders, err
+	}
+	opened, err := api.PlaceOrder(plan.Open)
+	return append(orders, opened...), err
+}
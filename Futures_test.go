@@ -0,0 +1,242 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(month time.Month, d int) time.Time {
+	return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// dailyBars returns one bar a day from start, with the given closes and
+// volumes.
+func dailyBars(start time.Time, closes, volumes []float64) []Bar {
+	bars := make([]Bar, len(closes))
+	for i, c := range closes {
+		bars[i] = Bar{Time: start.AddDate(0, 0, i), Open: c - 1, High: c + 1, Low: c - 2, Close: c, Volume: volumes[i]}
+	}
+	return bars
+}
+
+func TestStitchContinuous(t *testing.T) {
+	mar := FuturesContract{Uic: 1, Expiry: day(time.March, 20)}
+	jun := FuturesContract{Uic: 2, Expiry: day(time.June, 20)}
+	sep := FuturesContract{Uic: 3, Expiry: day(time.September, 20)}
+	twoContracts := []ContractBars{
+		{Contract: jun, Bars: dailyBars(day(time.March, 1), []float64{110, 111, 112, 113, 114, 115}, []float64{10, 20, 800, 900, 1000, 1100})},
+		{Contract: mar, Bars: dailyBars(day(time.March, 1), []float64{100, 101, 102, 103, 104, 105}, []float64{1000, 900, 700, 600, 500, 400})},
+	}
+	r := 113.0 / 103
+	tests := []struct {
+		name      string
+		contracts []ContractBars
+		rule      RollRule
+		closes    []float64
+		rolls     []FuturesRoll
+	}{
+		{
+			name:      "calendar without adjustment",
+			contracts: twoContracts,
+			rule:      RollRule{Method: RollCalendar, DaysBefore: 15, Adjust: AdjustNone},
+			closes:    []float64{100, 101, 102, 103, 114, 115},
+			rolls:     []FuturesRoll{{Time: day(time.March, 5), From: mar, To: jun}},
+		},
+		{
+			name:      "calendar difference",
+			contracts: twoContracts,
+			rule:      RollRule{Method: RollCalendar, DaysBefore: 15, Adjust: AdjustDifference},
+			closes:    []float64{110, 111, 112, 113, 114, 115},
+			rolls:     []FuturesRoll{{Time: day(time.March, 5), From: mar, To: jun, Gap: 10}},
+		},
+		{
+			name:      "calendar ratio",
+			contracts: twoContracts,
+			rule:      RollRule{Method: RollCalendar, DaysBefore: 15, Adjust: AdjustRatio},
+			closes:    []float64{100 * r, 101 * r, 102 * r, 103 * r, 114, 115},
+			rolls:     []FuturesRoll{{Time: day(time.March, 5), From: mar, To: jun, Gap: r}},
+		},
+		{
+			name:      "volume difference",
+			contracts: twoContracts,
+			rule:      RollRule{Method: RollVolume, DaysBefore: 15, Adjust: AdjustDifference},
+			closes:    []float64{110, 111, 112, 113, 114, 115},
+			rolls:     []FuturesRoll{{Time: day(time.March, 3), From: mar, To: jun, Gap: 10}},
+		},
+		{
+			name: "adjustments accumulate",
+			contracts: []ContractBars{
+				{Contract: mar, Bars: []Bar{{Time: day(time.March, 1), Close: 100}, {Time: day(time.March, 10), Close: 101}}},
+				{Contract: jun, Bars: []Bar{{Time: day(time.March, 1), Close: 105}, {Time: day(time.March, 10), Close: 106}, {Time: day(time.June, 1), Close: 120}, {Time: day(time.June, 10), Close: 121}}},
+				{Contract: sep, Bars: []Bar{{Time: day(time.June, 1), Close: 123}, {Time: day(time.June, 10), Close: 124}}},
+			},
+			rule:   RollRule{Method: RollCalendar, DaysBefore: 15, Adjust: AdjustDifference},
+			closes: []float64{108, 109, 123, 124},
+			rolls: []FuturesRoll{
+				{Time: day(time.March, 5), From: mar, To: jun, Gap: 5},
+				{Time: day(time.June, 5), From: jun, To: sep, Gap: 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := tt.contracts[0].Contract.Uic
+			bars, rolls, err := StitchContinuous(tt.contracts, tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contracts[0].Contract.Uic != first {
+				t.Errorf("the contracts passed in were reordered")
+			}
+			if len(bars) != len(tt.closes) {
+				t.Fatalf("got %d bars, want %d", len(bars), len(tt.closes))
+			}
+			for i, b := range bars {
+				if math.Abs(b.Close-tt.closes[i]) > 1e-9 {
+					t.Errorf("bar %d close = %g, want %g", i, b.Close, tt.closes[i])
+				}
+				if i > 0 && !bars[i-1].Time.Before(b.Time) {
+					t.Errorf("bar %d at %s is not after the one before", i, b.Time)
+				}
+			}
+			if len(rolls) != len(tt.rolls) {
+				t.Fatalf("got %d rolls, want %d", len(rolls), len(tt.rolls))
+			}
+			for i, roll := range rolls {
+				want := tt.rolls[i]
+				if !roll.Time.Equal(want.Time) || roll.From.Uic != want.From.Uic || roll.To.Uic != want.To.Uic || math.Abs(roll.Gap-want.Gap) > 1e-9 {
+					t.Errorf("roll %d = %+v, want %+v", i, roll, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStitchContinuousAdjustsEveryPrice(t *testing.T) {
+	mar := FuturesContract{Uic: 1, Expiry: day(time.March, 20)}
+	jun := FuturesContract{Uic: 2, Expiry: day(time.June, 20)}
+	contracts := []ContractBars{
+		{Contract: mar, Bars: dailyBars(day(time.March, 1), []float64{100, 101}, []float64{1, 1})},
+		{Contract: jun, Bars: dailyBars(day(time.March, 1), []float64{110, 111}, []float64{1, 1})},
+	}
+	bars, _, err := StitchContinuous(contracts, RollRule{Method: RollCalendar, DaysBefore: 18, Adjust: AdjustDifference})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Bar{Time: day(time.March, 1), Open: 109, High: 111, Low: 108, Close: 110, Volume: 1}
+	if bars[0] != want {
+		t.Errorf("first bar = %+v, want %+v", bars[0], want)
+	}
+	if contracts[0].Bars[0].Close != 100 {
+		t.Errorf("input bars were changed")
+	}
+}
+
+func TestStitchContinuousNoContracts(t *testing.T) {
+	if _, _, err := StitchContinuous(nil, RollRule{}); err == nil {
+		t.Error("stitching no contracts did not fail")
+	}
+}
+
+// futuresSpaceReply lists the contracts of a futures root.
+func futuresSpaceReply(contracts ...FuturesContract) string {
+	var space SaxoFuturesSpace
+	for _, c := range contracts {
+		space.Elements = append(space.Elements, SaxoFuturesSpaceElement{Uic: c.Uic, Symbol: c.Symbol, ExpiryDate: fxDate(c.Expiry)})
+	}
+	ba, _ := json.Marshal(space)
+	return string(ba)
+}
+
+func TestContinuousFuturesFetchWindows(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	contracts := []FuturesContract{
+		{Uic: 10, Symbol: "FDAXZ3", Expiry: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{Uic: 11, Symbol: "FDAXH4", Expiry: day(time.March, 15)},
+		{Uic: 12, Symbol: "FDAXM4", Expiry: day(time.June, 21)},
+		{Uic: 13, Symbol: "FDAXU4", Expiry: day(time.September, 20)},
+		{Uic: 14, Symbol: "FDAXZ4", Expiry: day(time.December, 20)},
+		{Uic: 15, Symbol: "FDAXH5", Expiry: time.Date(2025, 3, 21, 0, 0, 0, 0, time.UTC)},
+	}
+	expiries := make(map[string]time.Time)
+	for _, c := range contracts {
+		expiries[strconv.Itoa(c.Uic)] = c.Expiry
+	}
+	fake.reply("GET ref/v1/instruments/futuresspaces/99", futuresSpaceReply(contracts...))
+	// every contract trades hourly for a year up to its expiry
+	fake.handle("GET chart/v1/charts", func(r fakeRequest) (int, string) {
+		upTo, _ := time.Parse(time.RFC3339, r.Query.Get("Time"))
+		expiry := expiries[r.Query.Get("Uic")]
+		var page []SaxoChartSample
+		for ts := expiry.AddDate(-1, 0, 0); !ts.After(upTo) && ts.Before(expiry); ts = ts.Add(time.Hour) {
+			page = append(page, SaxoChartSample{Time: ts.Format(time.RFC3339), Open: 100, High: 100, Low: 100, Close: 100, Volume: 1})
+		}
+		if len(page) > 1200 {
+			page = page[len(page)-1200:]
+		}
+		ba, _ := json.Marshal(SaxoChart{Data: page})
+		return http.StatusOK, string(ba)
+	})
+
+	from, to := day(time.January, 1), day(time.December, 31)
+	series, err := api.ContinuousFutures(99, Horizon1Hour, from, to, RollRule{Method: RollCalendar, DaysBefore: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(series.Rolls) != 4 || len(series.Bars) == 0 || series.Bars[0].Time.Before(from) {
+		t.Fatalf("%d rolls, %d bars", len(series.Rolls), len(series.Bars))
+	}
+
+	// each contract is fetched back to two expiries before its own, and
+	// no further
+	earliest := make(map[string]time.Time)
+	for _, r := range fake.calls("GET chart/v1/charts") {
+		ts, _ := time.Parse(time.RFC3339, r.Query.Get("Time"))
+		uic := r.Query.Get("Uic")
+		if e, ok := earliest[uic]; !ok || ts.Before(e) {
+			earliest[uic] = ts
+		}
+	}
+	if _, ok := earliest["10"]; ok {
+		t.Error("the contract that expired before from was fetched")
+	}
+	for i := 1; i < len(contracts); i++ {
+		c := contracts[i]
+		start := from
+		if i >= 2 && contracts[i-2].Expiry.After(from) {
+			start = contracts[i-2].Expiry
+		}
+		if e := earliest[strconv.Itoa(c.Uic)]; e.Before(start) {
+			t.Errorf("%s fetched back to %s, before its window starting %s", c.Symbol, e, start)
+		}
+	}
+}
+
+func TestExpiringRollsCollectsErrors(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	now := time.Now().UTC()
+	front := FuturesContract{Uic: 1, Symbol: "FRONT", Expiry: now.AddDate(0, 0, 5)}
+	back := FuturesContract{Uic: 2, Symbol: "BACK", Expiry: now.AddDate(0, 3, 0)}
+	fake.reply("GET ref/v1/instruments/futuresspaces/99", futuresSpaceReply(front, back))
+	blocked := testNetPosition("n2", "account", 1, "ContractFutures", 1)
+	blocked.NetPositionBase.CanBeClosed = false
+	ba, _ := json.Marshal(SaxoData[SaxoNetPosition]{Data: []SaxoNetPosition{
+		testNetPosition("n1", "account", 1, "ContractFutures", 2),
+		blocked,
+		testNetPosition("n3", "account", 2, "ContractFutures", -1),
+	}})
+	fake.reply("GET port/v1/netpositions/me", string(ba))
+
+	plans, err := api.ExpiringRolls(99, 120)
+	if len(plans) != 1 || plans[0].NetPositionId != "n1" || plans[0].Open.Uic != 2 || plans[0].Open.Amount != 2 {
+		t.Errorf("plans = %+v", plans)
+	}
+	if err == nil || !strings.Contains(err.Error(), "FRONT: Cannot close n2") || !strings.Contains(err.Error(), "BACK: no contract to roll into") {
+		t.Errorf("err = %v, want both unrollable positions", err)
+	}
+}
@@ -0,0 +1,286 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FxRate is the price of one unit of Base in Quote.
+type FxRate struct {
+	Base  string
+	Quote string
+	Bid   float64
+	Ask   float64
+	Mid   float64
+	Time  time.Time
+	Via   string
+}
+
+func (r FxRate) Invert() FxRate {
+	inv := FxRate{Base: r.Quote, Quote: r.Base, Time: r.Time, Via: r.Via}
+	if r.Ask != 0 {
+		inv.Bid = 1 / r.Ask
+	}
+	if r.Bid != 0 {
+		inv.Ask = 1 / r.Bid
+	}
+	if r.Mid != 0 {
+		inv.Mid = 1 / r.Mid
+	}
+	return inv
+}
+
+// cross chains base/pivot with pivot/quote. The older timestamp is kept.
+func cross(a, b FxRate) FxRate {
+	r := FxRate{Base: a.Base, Quote: b.Quote, Bid: a.Bid * b.Bid, Ask: a.Ask * b.Ask, Mid: a.Mid * b.Mid, Time: a.Time, Via: a.Quote}
+	if b.Time.Before(r.Time) {
+		r.Time = b.Time
+	}
+	return r
+}
+
+// FxConverter converts amounts between currencies from FX spot quotes.
+// Rates are cached with their quote time and refetched with Prices once
+// older than MaxAge; Stream keeps them current from a price subscription
+// instead. Pairs Saxo does not list are triangulated through Pivots.
+type FxConverter struct {
+	MaxAge time.Duration
+	Pivots []string
+
+	api   *SaxoAPI
+	mu    sync.Mutex
+	uics  map[string]int
+	pairs map[int]string
+	rates map[string]FxRate
+}
+
+func NewFxConverter(api *SaxoAPI) *FxConverter {
+	return &FxConverter{
+		MaxAge: time.Minute,
+		Pivots: []string{"USD", "EUR"},
+		api:    api,
+		uics:   make(map[string]int),
+		pairs:  make(map[int]string),
+		rates:  make(map[string]FxRate),
+	}
+}
+
+// SetUic registers the FxSpot Uic of a pair such as EURUSD, saving the
+// instrument search.
+func (c *FxConverter) SetUic(pair string, uic int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pair = strings.ToUpper(pair)
+	c.uics[pair] = uic
+	c.pairs[uic] = pair
+}
+
+// UpdatePrice stores the rate of a priced FxSpot pair whose Uic is known.
+func (c *FxConverter) UpdatePrice(p SaxoPrice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pair, ok := c.pairs[p.Uic]
+	if !ok || len(pair) != 6 {
+		return
+	}
+	c.store(pair, p)
+}
+
+// store must be called with c.mu held
+func (c *FxConverter) store(pair string, p SaxoPrice) FxRate {
+	t, err := p.UpdatedAt()
+	if err != nil {
+		t = time.Now()
+	}
+	mid := p.Quote.Mid
+	if mid == 0 && p.Quote.BidPrice != 0 && p.Quote.AskPrice != 0 {
+		mid = (p.Quote.BidPrice + p.Quote.AskPrice) / 2
+	}
+	r := FxRate{Base: pair[:3], Quote: pair[3:], Bid: p.Quote.BidPrice, Ask: p.Quote.AskPrice, Mid: mid, Time: t}
+	c.rates[pair] = r
+	return r
+}
+
+// uic looks up the FxSpot Uic of a pair. A missing pair is remembered as 0.
+func (c *FxConverter) uic(pair string) (int, error) {
+	c.mu.Lock()
+	uic, ok := c.uics[pair]
+	c.mu.Unlock()
+	if ok || c.api == nil {
+		return uic, nil
+	}
+	instr, err := c.api.Instruments(SaxoInstruction{AssetTypes: []string{"FxSpot"}, Keywords: pair})
+	if err != nil {
+		return 0, err
+	}
+	for _, i := range instr {
+		if strings.EqualFold(i.Symbol, pair) {
+			uic = i.Identifier
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uics[pair] = uic
+	if uic != 0 {
+		c.pairs[uic] = pair
+	}
+	return uic, nil
+}
+
+// direct returns false when Saxo does not list the pair. The lock is only
+// held to read and update the cache, never across a request.
+func (c *FxConverter) direct(pair string) (FxRate, bool, error) {
+	c.mu.Lock()
+	r, cached := c.rates[pair]
+	c.mu.Unlock()
+	if cached && (c.MaxAge <= 0 || time.Since(r.Time) <= c.MaxAge) {
+		return r, true, nil
+	}
+	if c.api == nil {
+		// without an API a stream fed rate is all there is
+		return r, cached, nil
+	}
+	uic, err := c.uic(pair)
+	if err != nil || uic == 0 {
+		return FxRate{}, false, err
+	}
+	p, err := c.api.Prices(SaxoInstruction{Uic: uic, AssetTypes: []string{"FxSpot"}})
+	if err != nil {
+		return FxRate{}, false, err
+	}
+	if err := c.api.checkQuote(p); err != nil {
+		return FxRate{}, false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a streamed rate may have arrived while the price was fetched
+	if t, err := p.UpdatedAt(); err == nil {
+		if cur, ok := c.rates[pair]; ok && cur.Time.After(t) {
+			return cur, true, nil
+		}
+	}
+	return c.store(pair, *p), true, nil
+}
+
+// quoted tries the pair both ways round.
+func (c *FxConverter) quoted(from, to string) (FxRate, bool, error) {
+	r, ok, err := c.direct(from + to)
+	if ok || err != nil {
+		return r, ok, err
+	}
+	r, ok, err = c.direct(to + from)
+	if ok {
+		return r.Invert(), true, nil
+	}
+	return r, ok, err
+}
+
+// Rate returns the price of one unit of from in to.
+func (c *FxConverter) Rate(from, to string) (FxRate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if len(from) != 3 || len(to) != 3 {
+		return FxRate{}, errors.New(fmt.Sprintf("Bad currency pair %s/%s", from, to))
+	}
+	if from == to {
+		return FxRate{Base: from, Quote: to, Bid: 1, Ask: 1, Mid: 1, Time: time.Now()}, nil
+	}
+	r, ok, err := c.quoted(from, to)
+	if ok || err != nil {
+		return r, err
+	}
+	for _, pivot := range c.Pivots {
+		if pivot == from || pivot == to {
+			continue
+		}
+		a, ok, err := c.quoted(from, pivot)
+		if err != nil {
+			return FxRate{}, err
+		}
+		if !ok {
+			continue
+		}
+		b, ok, err := c.quoted(pivot, to)
+		if err != nil {
+			return FxRate{}, err
+		}
+		if ok {
+			return cross(a, b), nil
+		}
+	}
+	return FxRate{}, errors.New(fmt.Sprintf("No rate found for %s/%s", from, to))
+}
+
+// Convert converts amount of from into to at the mid rate.
+func (c *FxConverter) Convert(amount float64, from, to string) (float64, error) {
+	r, err := c.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * r.Mid, nil
+}
+
+// Stream subscribes to the given pairs and keeps their rates current. It
+// returns the subscription so the caller can unsubscribe.
+func (c *FxConverter) Stream(s *Streamer, pairs ...string) (*Subscription[SaxoPrice], error) {
+	var uics []int
+	for _, pair := range pairs {
+		uic, err := c.uic(strings.ToUpper(pair))
+		if err != nil {
+			return nil, err
+		}
+		if uic == 0 {
+			return nil, errors.New(fmt.Sprintf("No FxSpot instrument for %s", pair))
+		}
+		uics = append(uics, uic)
+	}
+	sub, err := s.SubscribePrices(uics, "FxSpot", []string{FieldGroupQuote}, 0)
+	if err != nil {
+		return nil, err
+	}
+	state := NewPriceState()
+	changes := state.Follow(sub, s.Errors)
+	go func() {
+		for change := range changes {
+			if !change.Deleted {
+				c.UpdatePrice(change.Value)
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// PositionExposure sums the exposure of the positions in base currency.
+func (c *FxConverter) PositionExposure(positions []SaxoPosition, base string) (float64, error) {
+	var total float64
+	for _, p := range positions {
+		v, err := c.Convert(p.PositionView.Exposure, p.PositionView.ExposureCurrency, base)
+		if err != nil {
+			return total, err
+		}
+		total += v
+	}
+	return total, nil
+}
+
+// PositionProfitLoss sums the open profit and loss of the positions in
+// base currency.
+func (c *FxConverter) PositionProfitLoss(positions []SaxoPosition, base string) (float64, error) {
+	var total float64
+	for _, p := range positions {
+		v, err := c.Convert(p.PositionView.ProfitLossOnTrade, p.PositionView.ExposureCurrency, base)
+		if err != nil {
+			return total, err
+		}
+		total += v
+	}
+	return total, nil
+}
+
+// BalanceValue returns the account total value in base currency.
+func (c *FxConverter) BalanceValue(b SaxoBalance, base string) (float64, error) {
+	return c.Convert(b.TotalValue, b.Currency, base)
+}
@@ -0,0 +1,140 @@
+package saxotrader
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testConverter(now time.Time) *FxConverter {
+	c := NewFxConverter(nil)
+	quotes := []struct {
+		pair     string
+		uic      int
+		bid, ask float64
+		age      time.Duration
+	}{
+		{"EURUSD", 21, 1.1000, 1.1002, 0},
+		{"USDJPY", 42, 150.00, 150.02, time.Minute},
+		{"GBPUSD", 31, 1.2500, 1.2502, 0},
+	}
+	for _, q := range quotes {
+		c.SetUic(q.pair, q.uic)
+		c.UpdatePrice(SaxoPrice{Uic: q.uic, LastUpdated: now.Add(-q.age).Format(time.RFC3339Nano), Quote: SaxoQuote{BidPrice: q.bid, AskPrice: q.ask}})
+	}
+	return c
+}
+
+func TestFxConverterRate(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		from, to      string
+		bid, ask, mid float64
+		via           string
+		time          time.Time
+		wantErr       bool
+	}{
+		{name: "direct", from: "EUR", to: "USD", bid: 1.1000, ask: 1.1002, mid: 1.1001, time: now},
+		{name: "inverted", from: "usd", to: "eur", bid: 1 / 1.1002, ask: 1 / 1.1000, mid: 1 / 1.1001, time: now},
+		{name: "through USD", from: "EUR", to: "JPY", bid: 1.1000 * 150.00, ask: 1.1002 * 150.02, mid: 1.1001 * 150.01, via: "USD", time: now.Add(-time.Minute)},
+		{name: "through USD both inverted", from: "JPY", to: "GBP", bid: 1 / 150.02 / 1.2502, ask: 1 / 150.00 / 1.2500, mid: 1 / 150.01 / 1.2501, via: "USD", time: now.Add(-time.Minute)},
+		{name: "cross of crosses is not found", from: "GBP", to: "CHF", wantErr: true},
+		{name: "same currency", from: "EUR", to: "EUR", bid: 1, ask: 1, mid: 1},
+		{name: "bad currency", from: "EU", to: "USD", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := testConverter(now).Rate(tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !sameValues([]float64{r.Bid, r.Ask, r.Mid}, []float64{tt.bid, tt.ask, tt.mid}) {
+				t.Errorf("rate = %g/%g mid %g, want %g/%g mid %g", r.Bid, r.Ask, r.Mid, tt.bid, tt.ask, tt.mid)
+			}
+			if r.Via != tt.via {
+				t.Errorf("Via = %q, want %q", r.Via, tt.via)
+			}
+			if !tt.time.IsZero() && !r.Time.Equal(tt.time) {
+				t.Errorf("Time = %s, want %s", r.Time, tt.time)
+			}
+		})
+	}
+}
+
+func TestFxConverterConvert(t *testing.T) {
+	now := time.Now().UTC()
+	c := testConverter(now)
+	got, err := c.Convert(1000, "GBP", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1000 * 1.2501 / 1.1001; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got %g, want %g", got, want)
+	}
+	positions := make([]SaxoPosition, 2)
+	positions[0].PositionView.Exposure, positions[0].PositionView.ExposureCurrency = 100, "USD"
+	positions[1].PositionView.Exposure, positions[1].PositionView.ExposureCurrency = -15000, "JPY"
+	total, err := c.PositionExposure(positions, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 100 - 15000/150.01; math.Abs(total-want) > 1e-9 {
+		t.Errorf("exposure = %g, want %g", total, want)
+	}
+}
+
+func TestFxConverterIgnoresUnknownUic(t *testing.T) {
+	c := testConverter(time.Now())
+	c.UpdatePrice(SaxoPrice{Uic: 99, Quote: SaxoQuote{Mid: 2}})
+	if _, err := c.Rate("CHF", "USD"); err == nil {
+		t.Error("rate found for an unregistered pair")
+	}
+}
+
+func TestFxConverterFetchesOutsideTheLock(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	c := NewFxConverter(api)
+	// the stream keeps updating while a rate is looked up and fetched
+	streams := func() bool {
+		done := make(chan struct{})
+		go func() {
+			c.UpdatePrice(SaxoPrice{Uic: 31, Quote: SaxoQuote{Mid: 1.25}})
+			close(done)
+		}()
+		select {
+		case <-done:
+			return true
+		case <-time.After(time.Second):
+			return false
+		}
+	}
+	var blocked []string
+	fake.handle("GET ref/v1/instruments", func(r fakeRequest) (int, string) {
+		if !streams() {
+			blocked = append(blocked, "instruments")
+		}
+		return http.StatusOK, `{"Data":[{"Symbol":"EURUSD","Identifier":21,"AssetType":"FxSpot"}]}`
+	})
+	fake.handle("GET trade/v1/infoprices/list", func(r fakeRequest) (int, string) {
+		if !streams() {
+			blocked = append(blocked, "prices")
+		}
+		return http.StatusOK, `{"Data":[{"Uic":21,"AssetType":"FxSpot","Quote":{"BidPrice":1.1,"AskPrice":1.1002}}]}`
+	})
+	c.SetUic("GBPUSD", 31)
+	r, err := c.Rate("EUR", "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocked) > 0 {
+		t.Errorf("price updates blocked during the %v requests", blocked)
+	}
+	if r.Mid != 1.1001 {
+		t.Errorf("rate = %+v", r)
+	}
+}
@@ -0,0 +1,491 @@
+package saxotrader
+
+import (
+	"math"
+	"time"
+)
+
+// Indicators are updated one bar at a time, so the same code runs over a
+// downloaded BarSeries and over bars from a BarAggregator. Values read
+// before Ready are not meaningful; the batch helpers return NaN for them.
+
+// BarIndicator is an indicator producing a single value per bar.
+type BarIndicator interface {
+	Update(b Bar) float64
+	Ready() bool
+}
+
+// Compute runs ind over bars and returns one value per bar.
+func Compute(ind BarIndicator, bars []Bar) []float64 {
+	out := make([]float64, len(bars))
+	for i, b := range bars {
+		v := ind.Update(b)
+		if !ind.Ready() {
+			v = math.NaN()
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// window is a fixed length ring of the latest values
+type window struct {
+	vals []float64
+	next int
+	n    int
+}
+
+func newWindow(size int) *window {
+	if size < 1 {
+		size = 1
+	}
+	return &window{vals: make([]float64, size)}
+}
+
+// push adds v and returns the value it replaced, if the window was full.
+func (w *window) push(v float64) (float64, bool) {
+	old, full := w.vals[w.next], w.n == len(w.vals)
+	w.vals[w.next] = v
+	w.next = (w.next + 1) % len(w.vals)
+	if !full {
+		w.n++
+	}
+	return old, full
+}
+
+func (w *window) full() bool {
+	return w.n == len(w.vals)
+}
+
+// at returns the i-th oldest value
+func (w *window) at(i int) float64 {
+	start := (w.next - w.n + len(w.vals)) % len(w.vals)
+	return w.vals[(start+i)%len(w.vals)]
+}
+
+type SMA struct {
+	Period int
+	w      *window
+	sum    float64
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{Period: period, w: newWindow(period)}
+}
+
+func (s *SMA) Add(v float64) float64 {
+	if old, full := s.w.push(v); full {
+		s.sum -= old
+	}
+	s.sum += v
+	return s.Value()
+}
+
+func (s *SMA) Update(b Bar) float64 { return s.Add(b.Close) }
+func (s *SMA) Ready() bool          { return s.w.full() }
+
+func (s *SMA) Value() float64 {
+	if s.w.n == 0 {
+		return 0
+	}
+	return s.sum / float64(s.w.n)
+}
+
+// EMA is seeded with the simple average of its first Period values.
+type EMA struct {
+	Period int
+	alpha  float64
+	seed   *SMA
+	value  float64
+	ready  bool
+}
+
+func NewEMA(period int) *EMA {
+	return &EMA{Period: period, alpha: 2 / float64(period+1), seed: NewSMA(period)}
+}
+
+func (e *EMA) Add(v float64) float64 {
+	if !e.ready {
+		e.value = e.seed.Add(v)
+		e.ready = e.seed.Ready()
+		return e.value
+	}
+	e.value += e.alpha * (v - e.value)
+	return e.value
+}
+
+func (e *EMA) Update(b Bar) float64 { return e.Add(b.Close) }
+func (e *EMA) Ready() bool          { return e.ready }
+func (e *EMA) Value() float64       { return e.value }
+
+// wilder is Wilder's smoothing, an EMA with alpha 1/period
+type wilder struct {
+	period int
+	count  int
+	value  float64
+}
+
+func (w *wilder) add(v float64) float64 {
+	if w.count < w.period {
+		w.count++
+		w.value += (v - w.value) / float64(w.count)
+		return w.value
+	}
+	w.value += (v - w.value) / float64(w.period)
+	return w.value
+}
+
+func (w *wilder) ready() bool {
+	return w.count >= w.period
+}
+
+type WMA struct {
+	Period int
+	w      *window
+}
+
+func NewWMA(period int) *WMA {
+	return &WMA{Period: period, w: newWindow(period)}
+}
+
+func (m *WMA) Add(v float64) float64 {
+	m.w.push(v)
+	return m.Value()
+}
+
+func (m *WMA) Update(b Bar) float64 { return m.Add(b.Close) }
+func (m *WMA) Ready() bool          { return m.w.full() }
+
+func (m *WMA) Value() float64 {
+	var sum, weights float64
+	for i := 0; i < m.w.n; i++ {
+		weight := float64(i + 1)
+		sum += weight * m.w.at(i)
+		weights += weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return sum / weights
+}
+
+// RSI uses Wilder's smoothing of gains and losses.
+type RSI struct {
+	Period int
+	gain   wilder
+	loss   wilder
+	prev   float64
+	seen   bool
+}
+
+func NewRSI(period int) *RSI {
+	return &RSI{Period: period, gain: wilder{period: period}, loss: wilder{period: period}}
+}
+
+func (r *RSI) Add(v float64) float64 {
+	if !r.seen {
+		r.prev, r.seen = v, true
+		return r.Value()
+	}
+	change := v - r.prev
+	r.prev = v
+	r.gain.add(math.Max(change, 0))
+	r.loss.add(math.Max(-change, 0))
+	return r.Value()
+}
+
+func (r *RSI) Update(b Bar) float64 { return r.Add(b.Close) }
+func (r *RSI) Ready() bool          { return r.gain.ready() }
+
+func (r *RSI) Value() float64 {
+	if r.loss.value == 0 {
+		if r.gain.value == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.gain.value/r.loss.value)
+}
+
+type MACDValue struct {
+	MACD      float64
+	Signal    float64
+	Histogram float64
+}
+
+type MACD struct {
+	fast   *EMA
+	slow   *EMA
+	signal *EMA
+	value  MACDValue
+}
+
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+func (m *MACD) Add(v float64) MACDValue {
+	f, s := m.fast.Add(v), m.slow.Add(v)
+	if !m.slow.Ready() {
+		return m.value
+	}
+	m.value.MACD = f - s
+	m.value.Signal = m.signal.Add(m.value.MACD)
+	m.value.Histogram = m.value.MACD - m.value.Signal
+	return m.value
+}
+
+func (m *MACD) Update(b Bar) MACDValue { return m.Add(b.Close) }
+func (m *MACD) Ready() bool            { return m.signal.Ready() }
+func (m *MACD) Value() MACDValue       { return m.value }
+
+type BollingerValue struct {
+	Middle float64
+	Upper  float64
+	Lower  float64
+}
+
+// Bollinger bands use the population standard deviation of the window.
+type Bollinger struct {
+	Period int
+	Width  float64
+	sma    *SMA
+	sumSq  float64
+}
+
+func NewBollinger(period int, width float64) *Bollinger {
+	return &Bollinger{Period: period, Width: width, sma: NewSMA(period)}
+}
+
+func (bb *Bollinger) Add(v float64) BollingerValue {
+	if bb.sma.w.full() {
+		old := bb.sma.w.at(0)
+		bb.sumSq -= old * old
+	}
+	bb.sumSq += v * v
+	bb.sma.Add(v)
+	return bb.Value()
+}
+
+func (bb *Bollinger) Update(b Bar) BollingerValue { return bb.Add(b.Close) }
+func (bb *Bollinger) Ready() bool                 { return bb.sma.Ready() }
+
+func (bb *Bollinger) Value() BollingerValue {
+	mean := bb.sma.Value()
+	n := float64(bb.sma.w.n)
+	if n == 0 {
+		return BollingerValue{}
+	}
+	sd := math.Sqrt(math.Max(bb.sumSq/n-mean*mean, 0))
+	return BollingerValue{Middle: mean, Upper: mean + bb.Width*sd, Lower: mean - bb.Width*sd}
+}
+
+func trueRange(b Bar, prevClose float64, havePrev bool) float64 {
+	if !havePrev {
+		return b.High - b.Low
+	}
+	return math.Max(b.High, prevClose) - math.Min(b.Low, prevClose)
+}
+
+// ATR is the Wilder smoothed average true range.
+type ATR struct {
+	Period    int
+	tr        wilder
+	prevClose float64
+	havePrev  bool
+}
+
+func NewATR(period int) *ATR {
+	return &ATR{Period: period, tr: wilder{period: period}}
+}
+
+func (a *ATR) Update(b Bar) float64 {
+	a.tr.add(trueRange(b, a.prevClose, a.havePrev))
+	a.prevClose, a.havePrev = b.Close, true
+	return a.tr.value
+}
+
+func (a *ATR) Ready() bool    { return a.tr.ready() }
+func (a *ATR) Value() float64 { return a.tr.value }
+
+type ADXValue struct {
+	ADX     float64
+	PlusDI  float64
+	MinusDI float64
+}
+
+type ADX struct {
+	Period int
+	tr     wilder
+	plus   wilder
+	minus  wilder
+	dx     wilder
+	prev   Bar
+	seen   bool
+	value  ADXValue
+}
+
+func NewADX(period int) *ADX {
+	return &ADX{Period: period, tr: wilder{period: period}, plus: wilder{period: period}, minus: wilder{period: period}, dx: wilder{period: period}}
+}
+
+func (a *ADX) Update(b Bar) ADXValue {
+	if !a.seen {
+		a.prev, a.seen = b, true
+		return a.value
+	}
+	up, down := b.High-a.prev.High, a.prev.Low-b.Low
+	var plusDM, minusDM float64
+	if up > down && up > 0 {
+		plusDM = up
+	}
+	if down > up && down > 0 {
+		minusDM = down
+	}
+	tr := a.tr.add(trueRange(b, a.prev.Close, true))
+	plus, minus := a.plus.add(plusDM), a.minus.add(minusDM)
+	a.prev = b
+	if !a.tr.ready() || tr == 0 {
+		return a.value
+	}
+	a.value.PlusDI = 100 * plus / tr
+	a.value.MinusDI = 100 * minus / tr
+	var dx float64
+	if sum := a.value.PlusDI + a.value.MinusDI; sum != 0 {
+		dx = 100 * math.Abs(a.value.PlusDI-a.value.MinusDI) / sum
+	}
+	a.value.ADX = a.dx.add(dx)
+	return a.value
+}
+
+func (a *ADX) Ready() bool     { return a.dx.ready() }
+func (a *ADX) Value() ADXValue { return a.value }
+
+// VWAP is the volume weighted typical price since the start of the
+// session, which resets at midnight in Location.
+type VWAP struct {
+	Location *time.Location
+	session  time.Time
+	pv       float64
+	volume   float64
+	value    float64
+}
+
+func NewVWAP(loc *time.Location) *VWAP {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &VWAP{Location: loc}
+}
+
+func (v *VWAP) Update(b Bar) float64 {
+	if session := bucketStart(b.Time, Horizon1Day, v.Location); !session.Equal(v.session) {
+		v.session, v.pv, v.volume = session, 0, 0
+	}
+	typical := (b.High + b.Low + b.Close) / 3
+	v.pv += typical * b.Volume
+	v.volume += b.Volume
+	if v.volume != 0 {
+		v.value = v.pv / v.volume
+	} else {
+		v.value = typical
+	}
+	return v.value
+}
+
+func (v *VWAP) Ready() bool    { return !v.session.IsZero() }
+func (v *VWAP) Value() float64 { return v.value }
+
+type DonchianValue struct {
+	Upper  float64
+	Lower  float64
+	Middle float64
+}
+
+type Donchian struct {
+	Period int
+	highs  *window
+	lows   *window
+}
+
+func NewDonchian(period int) *Donchian {
+	return &Donchian{Period: period, highs: newWindow(period), lows: newWindow(period)}
+}
+
+func (d *Donchian) Update(b Bar) DonchianValue {
+	d.highs.push(b.High)
+	d.lows.push(b.Low)
+	return d.Value()
+}
+
+func (d *Donchian) Ready() bool { return d.highs.full() }
+
+func (d *Donchian) Value() DonchianValue {
+	if d.highs.n == 0 {
+		return DonchianValue{}
+	}
+	v := DonchianValue{Upper: d.highs.at(0), Lower: d.lows.at(0)}
+	for i := 1; i < d.highs.n; i++ {
+		v.Upper = math.Max(v.Upper, d.highs.at(i))
+		v.Lower = math.Min(v.Lower, d.lows.at(i))
+	}
+	v.Middle = (v.Upper + v.Lower) / 2
+	return v
+}
+
+// Batch helpers over a BarSeries. Multi value indicators return the zero
+// value until they are ready.
+
+func (bs BarSeries) SMA(period int) []float64 { return Compute(NewSMA(period), bs.Bars) }
+func (bs BarSeries) EMA(period int) []float64 { return Compute(NewEMA(period), bs.Bars) }
+func (bs BarSeries) WMA(period int) []float64 { return Compute(NewWMA(period), bs.Bars) }
+func (bs BarSeries) RSI(period int) []float64 { return Compute(NewRSI(period), bs.Bars) }
+func (bs BarSeries) ATR(period int) []float64 { return Compute(NewATR(period), bs.Bars) }
+
+func (bs BarSeries) VWAP(loc *time.Location) []float64 {
+	return Compute(NewVWAP(loc), bs.Bars)
+}
+
+func (bs BarSeries) MACD(fast, slow, signal int) []MACDValue {
+	m := NewMACD(fast, slow, signal)
+	out := make([]MACDValue, len(bs.Bars))
+	for i, b := range bs.Bars {
+		if v := m.Update(b); m.Ready() {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func (bs BarSeries) Bollinger(period int, width float64) []BollingerValue {
+	bb := NewBollinger(period, width)
+	out := make([]BollingerValue, len(bs.Bars))
+	for i, b := range bs.Bars {
+		if v := bb.Update(b); bb.Ready() {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func (bs BarSeries) ADX(period int) []ADXValue {
+	a := NewADX(period)
+	out := make([]ADXValue, len(bs.Bars))
+	for i, b := range bs.Bars {
+		if v := a.Update(b); a.Ready() {
+			out[i] = v
+		}
+	}
+	return out
+}
+
+func (bs BarSeries) Donchian(period int) []DonchianValue {
+	d := NewDonchian(period)
+	out := make([]DonchianValue, len(bs.Bars))
+	for i, b := range bs.Bars {
+		if v := d.Update(b); d.Ready() {
+			out[i] = v
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package saxotrader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func closeBars(closes ...float64) []Bar {
+	bars := make([]Bar, len(closes))
+	for i, c := range closes {
+		bars[i] = Bar{Time: at(10, i, 0), Open: c, High: c, Low: c, Close: c, Volume: 1}
+	}
+	return bars
+}
+
+func sameValues(got, want []float64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if math.IsNaN(want[i]) {
+			if !math.IsNaN(got[i]) {
+				return false
+			}
+			continue
+		}
+		if math.Abs(got[i]-want[i]) > 1e-9 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCompute(t *testing.T) {
+	nan := math.NaN()
+	closes := closeBars(1, 2, 3, 4, 5, 4, 3)
+	ranges := []Bar{
+		{High: 3, Low: 1, Close: 2},
+		{High: 4, Low: 2, Close: 3},
+		{High: 6, Low: 5, Close: 5.5},
+		{High: 5, Low: 4, Close: 4},
+	}
+	day1 := time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	volumes := []Bar{
+		{Time: day1, High: 10, Low: 10, Close: 10, Volume: 1},
+		{Time: day1.Add(time.Hour), High: 20, Low: 20, Close: 20, Volume: 3},
+		{Time: day2, High: 30, Low: 30, Close: 30},
+		{Time: day2.Add(time.Hour), High: 40, Low: 40, Close: 40, Volume: 2},
+	}
+	tests := []struct {
+		name string
+		ind  BarIndicator
+		bars []Bar
+		want []float64
+	}{
+		{"SMA", NewSMA(3), closes, []float64{nan, nan, 2, 3, 4, 13.0 / 3, 4}},
+		{"EMA", NewEMA(3), closes, []float64{nan, nan, 2, 3, 4, 4, 3.5}},
+		{"WMA", NewWMA(3), closes, []float64{nan, nan, 14.0 / 6, 20.0 / 6, 26.0 / 6, 26.0 / 6, 22.0 / 6}},
+		{"RSI", NewRSI(2), closes, []float64{nan, nan, 100, 100, 100, 50, 25}},
+		{"RSI flat", NewRSI(2), closeBars(5, 5, 5), []float64{nan, nan, 50}},
+		{"ATR", NewATR(2), ranges, []float64{nan, 2, 2.5, 2}},
+		{"VWAP resets each session", NewVWAP(nil), volumes, []float64{10, 17.5, 30, 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compute(tt.ind, tt.bars); !sameValues(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	bs := BarSeries{Bars: closeBars(1, 2, 3, 4)}
+	got := bs.Bollinger(3, 2)
+	sd := math.Sqrt(2.0 / 3)
+	want := []BollingerValue{{}, {}, {Middle: 2, Upper: 2 + 2*sd, Lower: 2 - 2*sd}, {Middle: 3, Upper: 3 + 2*sd, Lower: 3 - 2*sd}}
+	for i := range want {
+		if !sameValues([]float64{got[i].Middle, got[i].Upper, got[i].Lower}, []float64{want[i].Middle, want[i].Upper, want[i].Lower}) {
+			t.Errorf("bar %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestMACD(t *testing.T) {
+	m := NewMACD(2, 3, 2)
+	for i, c := range []float64{1, 2, 3, 4, 5, 6} {
+		v := m.Add(c)
+		if ready := i >= 3; m.Ready() != ready {
+			t.Fatalf("bar %d ready = %v, want %v", i, m.Ready(), ready)
+		}
+		if m.Ready() && !sameValues([]float64{v.MACD, v.Signal, v.Histogram}, []float64{0.5, 0.5, 0}) {
+			t.Errorf("bar %d = %+v, want MACD 0.5, Signal 0.5", i, v)
+		}
+	}
+}
+
+func TestADXTrend(t *testing.T) {
+	a := NewADX(3)
+	for i := 0; i < 6; i++ {
+		c := float64(10 + i)
+		a.Update(Bar{High: c + 1, Low: c - 1, Close: c})
+	}
+	if !a.Ready() {
+		t.Fatal("ADX not ready after 2 periods")
+	}
+	if v := a.Value(); !sameValues([]float64{v.ADX, v.PlusDI, v.MinusDI}, []float64{100, 50, 0}) {
+		t.Errorf("got %+v, want ADX 100, +DI 50, -DI 0", v)
+	}
+}
+
+func TestDonchian(t *testing.T) {
+	d := NewDonchian(2)
+	bars := []Bar{{High: 3, Low: 1}, {High: 4, Low: 2}, {High: 6, Low: 5}, {High: 5, Low: 4}}
+	want := []DonchianValue{{Upper: 3, Lower: 1, Middle: 2}, {Upper: 4, Lower: 1, Middle: 2.5}, {Upper: 6, Lower: 2, Middle: 4}, {Upper: 6, Lower: 4, Middle: 5}}
+	for i, b := range bars {
+		if got := d.Update(b); got != want[i] {
+			t.Errorf("bar %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type cachedDetails struct {
+	Details SaxoAssetDetails
+	Fetched time.Time
+}
+
+type cachedSearch struct {
+	Results []SaxoAsset
+	Fetched time.Time
+}
+
+// InstrumentCache keeps instrument details by Uic and asset type, and
+// instrument search results by query, in memory and optionally in a JSON
+// file. Set it as SaxoAPI.RefCache and InstrumentDetails and Instruments
+// only call Saxo for entries that are missing or older than TTL. When a
+// refetch shows a new TradingStatus, searches returning the instrument are
+// dropped and OnStatusChange is called.
+type InstrumentCache struct {
+	Path           string
+	TTL            time.Duration
+	OnStatusChange func(old, new SaxoAssetDetails)
+
+	mu       sync.Mutex
+	details  map[string]cachedDetails
+	searches map[string]cachedSearch
+	// Uics whose details were fetched for every asset type, and when
+	complete map[int]time.Time
+}
+
+type instrumentCacheFile struct {
+	Details  map[string]cachedDetails
+	Searches map[string]cachedSearch
+	Complete map[int]time.Time
+}
+
+// OpenInstrumentCache loads the cache file at path if it exists. An empty
+// path keeps the cache in memory only.
+func OpenInstrumentCache(path string, ttl time.Duration) (*InstrumentCache, error) {
+	c := &InstrumentCache{Path: path, TTL: ttl, details: make(map[string]cachedDetails), searches: make(map[string]cachedSearch), complete: make(map[int]time.Time)}
+	if path == "" {
+		return c, nil
+	}
+	ba, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f instrumentCacheFile
+	if err := json.Unmarshal(ba, &f); err != nil {
+		return nil, err
+	}
+	if f.Details != nil {
+		c.details = f.Details
+	}
+	if f.Searches != nil {
+		c.searches = f.Searches
+	}
+	if f.Complete != nil {
+		c.complete = f.Complete
+	}
+	return c, nil
+}
+
+func searchKey(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + params[k]
+	}
+	return strings.Join(parts, "&")
+}
+
+func (c *InstrumentCache) fresh(t time.Time) bool {
+	return c.TTL <= 0 || time.Since(t) <= c.TTL
+}
+
+// Details returns the cached details of an instrument. An empty assetType
+// returns every asset type of the Uic, sorted by asset type, and only once
+// the Uic has been fetched without an asset type.
+func (c *InstrumentCache) Details(uic int, assetType string) ([]SaxoAssetDetails, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if assetType != "" {
+		e, ok := c.details[instrumentKey(uic, assetType)]
+		if !ok || !c.fresh(e.Fetched) {
+			return nil, false
+		}
+		return []SaxoAssetDetails{e.Details}, true
+	}
+	fetched, ok := c.complete[uic]
+	if !ok || !c.fresh(fetched) {
+		return nil, false
+	}
+	var list []SaxoAssetDetails
+	for _, e := range c.details {
+		if e.Details.Uic == uic {
+			list = append(list, e.Details)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AssetType < list[j].AssetType })
+	return list, true
+}
+
+// PutDetails stores fetched details and saves the cache.
+func (c *InstrumentCache) PutDetails(details []SaxoAssetDetails) error {
+	return c.putDetails(details, nil)
+}
+
+// putDetails also records the Uics in all as fetched for every asset
+// type, dropping asset types Saxo no longer returns for them.
+func (c *InstrumentCache) putDetails(details []SaxoAssetDetails, all []int) error {
+	c.mu.Lock()
+	now := time.Now()
+	previous := make(map[string]cachedDetails, len(details))
+	for _, d := range details {
+		key := instrumentKey(d.Uic, d.AssetType)
+		if e, ok := c.details[key]; ok {
+			previous[key] = e
+		}
+	}
+	for _, uic := range all {
+		c.complete[uic] = now
+		for k, e := range c.details {
+			if e.Details.Uic == uic {
+				delete(c.details, k)
+			}
+		}
+	}
+	var changed [][2]SaxoAssetDetails
+	for _, d := range details {
+		key := instrumentKey(d.Uic, d.AssetType)
+		if old, ok := previous[key]; ok && old.Details.TradingStatus != d.TradingStatus {
+			changed = append(changed, [2]SaxoAssetDetails{old.Details, d})
+			c.dropSearches(d.Uic)
+		}
+		c.details[key] = cachedDetails{Details: d, Fetched: now}
+	}
+	err := c.save()
+	c.mu.Unlock()
+	if c.OnStatusChange != nil {
+		for _, ch := range changed {
+			c.OnStatusChange(ch[0], ch[1])
+		}
+	}
+	return err
+}
+
+func (c *InstrumentCache) dropSearches(uic int) {
+	for k, s := range c.searches {
+		for _, a := range s.Results {
+			if a.Identifier == uic {
+				delete(c.searches, k)
+				break
+			}
+		}
+	}
+}
+
+func (c *InstrumentCache) Search(params map[string]string) ([]SaxoAsset, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.searches[searchKey(params)]
+	return s.Results, ok && c.fresh(s.Fetched)
+}
+
+func (c *InstrumentCache) PutSearch(params map[string]string, results []SaxoAsset) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.searches[searchKey(params)] = cachedSearch{Results: results, Fetched: time.Now()}
+	return c.save()
+}
+
+// Invalidate drops the details of an instrument and any search that
+// returned it. An empty assetType drops every asset type of the Uic.
+func (c *InstrumentCache) Invalidate(uic int, assetType string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.details {
+		if e.Details.Uic == uic && (assetType == "" || e.Details.AssetType == assetType) {
+			delete(c.details, k)
+		}
+	}
+	delete(c.complete, uic)
+	c.dropSearches(uic)
+	return c.save()
+}
+
+func (c *InstrumentCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.details = make(map[string]cachedDetails)
+	c.searches = make(map[string]cachedSearch)
+	c.complete = make(map[int]time.Time)
+	return c.save()
+}
+
+// Cached returns the details of every cached instrument.
+func (c *InstrumentCache) Cached() []SaxoAssetDetails {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]SaxoAssetDetails, 0, len(c.details))
+	for _, e := range c.details {
+		list = append(list, e.Details)
+	}
+	return list
+}
+
+// save must be called with c.mu held
+func (c *InstrumentCache) save() error {
+	if c.Path == "" {
+		return nil
+	}
+	ba, err := json.Marshal(instrumentCacheFile{Details: c.details, Searches: c.searches, Complete: c.complete})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.Path, ba)
+}
+
+// PrefetchInstruments loads the details of the Uics into the cache in
+// batches, skipping those already cached.
+func (api *SaxoAPI) PrefetchInstruments(uics []int, assetType string) error {
+	if api.RefCache == nil {
+		return errors.New("No instrument cache set")
+	}
+	var missing []int
+	for _, uic := range uics {
+		if _, ok := api.RefCache.Details(uic, assetType); !ok {
+			missing = append(missing, uic)
+		}
+	}
+	return api.fetchDetails(missing, assetType)
+}
+
+// RefreshInstruments refetches everything in the cache, which is how
+// TradingStatus changes are noticed before the TTL runs out.
+func (api *SaxoAPI) RefreshInstruments() error {
+	if api.RefCache == nil {
+		return errors.New("No instrument cache set")
+	}
+	byType := make(map[string][]int)
+	for _, d := range api.RefCache.Cached() {
+		byType[d.AssetType] = append(byType[d.AssetType], d.Uic)
+	}
+	for assetType, uics := range byType {
+		if err := api.fetchDetails(uics, assetType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (api *SaxoAPI) fetchDetails(uics []int, assetType string) error {
+	const batch = 100
+	for len(uics) > 0 {
+		n := batch
+		if n > len(uics) {
+			n = len(uics)
+		}
+		instr := SaxoInstruction{Uics: uics[:n]}
+		var all []int
+		if assetType != "" {
+			instr.AssetTypes = []string{assetType}
+		} else {
+			all = uics[:n]
+		}
+		details, err := api.instrumentDetails(instr)
+		if err != nil {
+			return err
+		}
+		if err := api.RefCache.putDetails(details, all); err != nil {
+			return err
+		}
+		uics = uics[n:]
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cacheFake serves details for any requested Uics, as a Stock and, when no
+// asset type is asked for, also as a CfdOnStock. status gives the
+// TradingStatus returned for each Uic.
+func cacheFake(t *testing.T) (*SaxoAPI, *fakeSaxo, map[int]string) {
+	api, fake := newFakeSaxo(t)
+	status := make(map[int]string)
+	fake.handle("GET ref/v1/instruments/details", func(r fakeRequest) (int, string) {
+		assetTypes := []string{"CfdOnStock", "Stock"}
+		if r.Query.Get("AssetTypes") != "" {
+			assetTypes = strings.Split(r.Query.Get("AssetTypes"), ",")
+		}
+		var details []SaxoAssetDetails
+		for _, s := range strings.Split(r.Query.Get("Uics"), ",") {
+			uic, _ := strconv.Atoi(s)
+			for _, at := range assetTypes {
+				details = append(details, SaxoAssetDetails{Uic: uic, AssetType: at, TradingStatus: status[uic]})
+			}
+		}
+		ba, _ := json.Marshal(SaxoAssetDetailsSet{Data: details})
+		return http.StatusOK, string(ba)
+	})
+	fake.reply("GET ref/v1/instruments", `{"Data":[{"Identifier":21,"AssetType":"Stock","Symbol":"ABC:xnas"}]}`)
+	return api, fake, status
+}
+
+// ageCache makes every entry of the cache older by d.
+func ageCache(c *InstrumentCache, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.details {
+		e.Fetched = e.Fetched.Add(-d)
+		c.details[k] = e
+	}
+	for k, s := range c.searches {
+		s.Fetched = s.Fetched.Add(-d)
+		c.searches[k] = s
+	}
+	for uic, t := range c.complete {
+		c.complete[uic] = t.Add(-d)
+	}
+}
+
+func requestedUics(fake *fakeSaxo) []string {
+	var uics []string
+	for _, r := range fake.calls("GET ref/v1/instruments/details") {
+		uics = append(uics, r.Query.Get("Uics"))
+	}
+	return uics
+}
+
+func TestInstrumentCacheDetails(t *testing.T) {
+	api, fake, _ := cacheFake(t)
+	path := filepath.Join(t.TempDir(), "instruments.json")
+	cache, err := OpenInstrumentCache(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.RefCache = cache
+	lookup := func(uics ...int) []SaxoAssetDetails {
+		details, err := api.InstrumentDetails(SaxoInstruction{Uics: uics, AssetTypes: []string{"Stock"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return details
+	}
+
+	// a miss fetches, a hit does not, and a partial hit only fetches the
+	// missing Uics
+	if d := lookup(21, 22); len(d) != 2 || d[0].Uic != 21 || d[1].Uic != 22 {
+		t.Errorf("first lookup = %+v", d)
+	}
+	lookup(21, 22)
+	lookup(21, 23)
+	if got := strings.Join(requestedUics(fake), " "); got != "21,22 23" {
+		t.Errorf("fetched Uics %q, want %q", got, "21,22 23")
+	}
+
+	// expired entries are fetched again
+	ageCache(cache, 2*time.Hour)
+	lookup(21)
+	if got := requestedUics(fake); len(got) != 3 || got[2] != "21" {
+		t.Errorf("fetched Uics after expiry %v", got)
+	}
+
+	// the file keeps what was cached
+	reopened, err := OpenInstrumentCache(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := reopened.Details(21, "Stock"); !ok || d[0].Uic != 21 {
+		t.Errorf("reopened cache Details = %+v, %v", d, ok)
+	}
+	if _, ok := reopened.Details(21, "FxSpot"); ok {
+		t.Error("reopened cache has an asset type never fetched")
+	}
+}
+
+func TestInstrumentCacheAllAssetTypes(t *testing.T) {
+	api, fake, _ := cacheFake(t)
+	api.RefCache, _ = OpenInstrumentCache("", time.Hour)
+
+	// a Uic fetched for one asset type is not complete
+	if _, err := api.InstrumentDetails(SaxoInstruction{Uic: 21, AssetTypes: []string{"Stock"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := api.RefCache.Details(21, ""); ok {
+		t.Error("Uic fetched for one asset type counts as complete")
+	}
+	details, err := api.InstrumentDetails(SaxoInstruction{Uic: 21})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(details) != 2 || details[0].AssetType != "CfdOnStock" || details[1].AssetType != "Stock" {
+		t.Errorf("all asset types = %+v", details)
+	}
+	if _, err := api.InstrumentDetails(SaxoInstruction{Uic: 21}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.calls("GET ref/v1/instruments/details")); n != 2 {
+		t.Errorf("%d detail requests, want 2", n)
+	}
+}
+
+func TestInstrumentCacheSearch(t *testing.T) {
+	api, fake, _ := cacheFake(t)
+	api.RefCache, _ = OpenInstrumentCache("", time.Hour)
+	search := func(keywords string) {
+		if _, err := api.Instruments(SaxoInstruction{Keywords: keywords, AssetTypes: []string{"Stock"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	search("abc")
+	search("abc")
+	search("xyz")
+	if n := len(fake.calls("GET ref/v1/instruments")); n != 2 {
+		t.Errorf("%d searches before expiry, want 2", n)
+	}
+	ageCache(api.RefCache, 2*time.Hour)
+	search("abc")
+	if n := len(fake.calls("GET ref/v1/instruments")); n != 3 {
+		t.Errorf("%d searches after expiry, want 3", n)
+	}
+}
+
+func TestInstrumentCacheStatusChange(t *testing.T) {
+	api, fake, status := cacheFake(t)
+	api.RefCache, _ = OpenInstrumentCache("", time.Hour)
+	var changes []string
+	api.RefCache.OnStatusChange = func(old, new SaxoAssetDetails) {
+		changes = append(changes, old.TradingStatus+">"+new.TradingStatus)
+	}
+	status[21] = "Tradable"
+	if _, err := api.InstrumentDetails(SaxoInstruction{Uic: 21, AssetTypes: []string{"Stock"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.Instruments(SaxoInstruction{Keywords: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	status[21] = "NotTradable"
+	if err := api.RefreshInstruments(); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0] != "Tradable>NotTradable" {
+		t.Errorf("status changes = %v", changes)
+	}
+	// the search returning the instrument is dropped
+	if _, err := api.Instruments(SaxoInstruction{Keywords: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.calls("GET ref/v1/instruments")); n != 2 {
+		t.Errorf("%d searches, want 2 after the status change", n)
+	}
+}
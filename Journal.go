@@ -0,0 +1,345 @@
+package saxotrader
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	JournalIntent   = "Intent"
+	JournalResponse = "Response"
+	JournalError    = "Error"
+	JournalCancel   = "Cancel"
+	JournalStatus   = "Status"
+)
+
+// JournalHashVersion is the hash scheme written to new records.
+const JournalHashVersion = 1
+
+// JournalRecord is one line of the order journal. Hash covers a fixed list
+// of fields, the scheme written as Version, so fields added later do not
+// change the hash of existing records, and PrevHash links it to the record
+// before, so any edit or removal breaks the chain.
+type JournalRecord struct {
+	Version   int `json:",omitempty"`
+	Seq       int64
+	Time      time.Time
+	Kind      string
+	Ref       int64           `json:",omitempty"`
+	OrderId   string          `json:",omitempty"`
+	Uic       int             `json:",omitempty"`
+	AssetType string          `json:",omitempty"`
+	BuySell   string          `json:",omitempty"`
+	Amount    float64         `json:",omitempty"`
+	Price     float64         `json:",omitempty"`
+	Status    string          `json:",omitempty"`
+	Request   json.RawMessage `json:",omitempty"`
+	Response  json.RawMessage `json:",omitempty"`
+	Error     string          `json:",omitempty"`
+	PrevHash  string
+	Hash      string
+}
+
+func (rec JournalRecord) computeHash() (string, error) {
+	if rec.Version != JournalHashVersion {
+		return "", errors.New(fmt.Sprintf("Unknown journal hash version %d", rec.Version))
+	}
+	ba, err := json.Marshal([]interface{}{
+		rec.Version, rec.Seq, rec.Time.UTC().Format(time.RFC3339Nano), rec.Kind, rec.Ref, rec.OrderId, rec.Uic,
+		rec.AssetType, rec.BuySell, rec.Amount, rec.Price, rec.Status, rawOrNull(rec.Request), rawOrNull(rec.Response),
+		rec.Error, rec.PrevHash,
+	})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(ba)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func rawOrNull(m json.RawMessage) json.RawMessage {
+	if len(m) == 0 {
+		return json.RawMessage("null")
+	}
+	return m
+}
+
+type JournalBreak struct {
+	Seq    int64
+	Line   int
+	Reason string
+}
+
+func (jb *JournalBreak) Error() string {
+	return fmt.Sprintf("Journal chain broken at line %d (seq %d): %s", jb.Line, jb.Seq, jb.Reason)
+}
+
+// OrderJournal is an append-only, hash-chained log of everything sent to
+// the order endpoints. Set it as SaxoAPI.Journal to record order placement,
+// cancellation and tracked status changes.
+type OrderJournal struct {
+	path     string
+	mu       sync.Mutex
+	f        *os.File
+	seq      int64
+	lastHash string
+}
+
+// OpenOrderJournal opens or creates the journal at path. An existing
+// journal is verified first and is not appended to if its chain is broken.
+// An incomplete last line, left by a crash during a write, is cut off.
+func OpenOrderJournal(path string) (*OrderJournal, error) {
+	j := &OrderJournal{path: path}
+	records, size, unterminated, err := readJournal(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := verifyRecords(records); err != nil {
+		return nil, err
+	}
+	if err == nil {
+		if err := os.Truncate(path, size); err != nil {
+			return nil, err
+		}
+	}
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		j.seq = last.Seq
+		j.lastHash = last.Hash
+	}
+	j.f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if unterminated {
+		if _, err := j.f.Write([]byte{'\n'}); err != nil {
+			j.f.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+func (j *OrderJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+func (j *OrderJournal) append(rec JournalRecord) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return 0, errors.New("Journal is closed")
+	}
+	rec.Version = JournalHashVersion
+	rec.Seq = j.seq + 1
+	rec.Time = time.Now().UTC()
+	rec.PrevHash = j.lastHash
+	hash, err := rec.computeHash()
+	if err != nil {
+		return 0, err
+	}
+	rec.Hash = hash
+	ba, err := json.Marshal(rec)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := j.f.Write(append(ba, '\n')); err != nil {
+		return 0, err
+	}
+	if err := j.f.Sync(); err != nil {
+		return 0, err
+	}
+	j.seq = rec.Seq
+	j.lastHash = rec.Hash
+	return rec.Seq, nil
+}
+
+// RecordIntent logs an order before it is sent and returns its sequence
+// number, which later records for the same order refer to.
+func (j *OrderJournal) RecordIntent(instr interface{}) (int64, error) {
+	ba, err := json.Marshal(instr)
+	if err != nil {
+		return 0, err
+	}
+	rec := JournalRecord{Kind: JournalIntent, Request: ba}
+	switch o := instr.(type) {
+	case SaxoOrderInstruction:
+		rec.Uic, rec.AssetType, rec.BuySell, rec.Amount, rec.Price = o.Uic, o.AssetType, o.BuySell, o.Amount, o.OrderPrice
+	case SaxoMultiLegOrderPost:
+		rec.BuySell, rec.Amount, rec.Price = o.BuySell, o.Amount, o.OrderPrice
+		if len(o.Legs) > 0 {
+			rec.Uic, rec.AssetType = o.Legs[0].Uic, o.Legs[0].AssetType
+		}
+	}
+	return j.append(rec)
+}
+
+// RecordResult logs the response or error for an earlier intent.
+func (j *OrderJournal) RecordResult(intent int64, orders []SaxoOrder, err error) error {
+	rec := JournalRecord{Kind: JournalResponse, Ref: intent}
+	if err != nil {
+		rec.Kind = JournalError
+		rec.Error = err.Error()
+	}
+	if len(orders) > 0 {
+		ba, merr := json.Marshal(orders)
+		if merr != nil {
+			return merr
+		}
+		rec.Response = ba
+		rec.OrderId = orders[0].OrderId
+		rec.Uic, rec.AssetType, rec.BuySell = orders[0].Uic, orders[0].AssetType, orders[0].BuySell
+		rec.Amount, rec.Price, rec.Status = orders[0].Amount, orders[0].Price, orders[0].Status
+	}
+	_, aerr := j.append(rec)
+	return aerr
+}
+
+func (j *OrderJournal) RecordCancel(orderId string, err error) error {
+	rec := JournalRecord{Kind: JournalCancel, OrderId: orderId}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	_, aerr := j.append(rec)
+	return aerr
+}
+
+func (j *OrderJournal) RecordEvent(ev OrderEvent) error {
+	_, err := j.append(JournalRecord{
+		Kind:      JournalStatus,
+		OrderId:   ev.OrderId,
+		Uic:       ev.Uic,
+		AssetType: ev.AssetType,
+		BuySell:   ev.BuySell,
+		Amount:    ev.FilledAmount,
+		Price:     ev.AveragePrice,
+		Status:    string(ev.Type),
+	})
+	return err
+}
+
+// ReadJournal reads every record of the journal, skipping an incomplete
+// last line.
+func ReadJournal(path string) ([]JournalRecord, error) {
+	records, _, _, err := readJournal(path)
+	return records, err
+}
+
+// readJournal also returns the length of the file up to the end of the
+// last complete record, and whether that record is missing its newline.
+func readJournal(path string) ([]JournalRecord, int64, bool, error) {
+	ba, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	var records []JournalRecord
+	var size int64
+	line := 0
+	for len(ba) > 0 {
+		line++
+		n := bytes.IndexByte(ba, '\n')
+		if n < 0 {
+			var rec JournalRecord
+			if json.Unmarshal(ba, &rec) != nil {
+				break
+			}
+			records = append(records, rec)
+			return records, size + int64(len(ba)), true, nil
+		}
+		text := ba[:n]
+		ba = ba[n+1:]
+		if len(bytes.TrimSpace(text)) > 0 {
+			var rec JournalRecord
+			if err := json.Unmarshal(text, &rec); err != nil {
+				return records, size, false, &JournalBreak{Line: line, Reason: err.Error()}
+			}
+			records = append(records, rec)
+		}
+		size += int64(n + 1)
+	}
+	return records, size, false, nil
+}
+
+func verifyRecords(records []JournalRecord) error {
+	prev := ""
+	for i, rec := range records {
+		if rec.Seq != int64(i+1) {
+			return &JournalBreak{Seq: rec.Seq, Line: i + 1, Reason: fmt.Sprintf("expected seq %d", i+1)}
+		}
+		if rec.PrevHash != prev {
+			return &JournalBreak{Seq: rec.Seq, Line: i + 1, Reason: "previous hash does not match"}
+		}
+		hash, err := rec.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != rec.Hash {
+			return &JournalBreak{Seq: rec.Seq, Line: i + 1, Reason: "record hash does not match"}
+		}
+		prev = rec.Hash
+	}
+	return nil
+}
+
+// VerifyJournal checks the whole chain and returns the number of records.
+func VerifyJournal(path string) (int, error) {
+	records, err := ReadJournal(path)
+	if err != nil {
+		return len(records), err
+	}
+	return len(records), verifyRecords(records)
+}
+
+// JournalQuery selects journal records. Zero fields match everything. An
+// OrderId match also returns the intent the order was placed from.
+type JournalQuery struct {
+	From    time.Time
+	To      time.Time
+	Uic     int
+	OrderId string
+}
+
+func QueryJournal(path string, q JournalQuery) ([]JournalRecord, error) {
+	records, err := ReadJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	intents := make(map[int64]bool)
+	if q.OrderId != "" {
+		for _, rec := range records {
+			if rec.OrderId == q.OrderId && rec.Ref != 0 {
+				intents[rec.Ref] = true
+			}
+		}
+	}
+	var found []JournalRecord
+	for _, rec := range records {
+		if !q.From.IsZero() && rec.Time.Before(q.From) {
+			continue
+		}
+		if !q.To.IsZero() && !rec.Time.Before(q.To) {
+			continue
+		}
+		if q.Uic != 0 && rec.Uic != q.Uic {
+			continue
+		}
+		if q.OrderId != "" && rec.OrderId != q.OrderId && !intents[rec.Seq] {
+			continue
+		}
+		found = append(found, rec)
+	}
+	return found, nil
+}
@@ -0,0 +1,144 @@
+package saxotrader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testJournal writes three records and returns the journal's path and
+// lines.
+func testJournal(t *testing.T) (string, []string) {
+	path := filepath.Join(t.TempDir(), "orders.journal")
+	j, err := OpenOrderJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seq, err := j.RecordIntent(SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 100, OrderPrice: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.RecordResult(seq, []SaxoOrder{{OrderId: "5", Uic: 21, Amount: 100}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.RecordCancel("5", nil); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	ba, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(ba), "\n")
+	return path, lines[:len(lines)-1]
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	path, _ := testJournal(t)
+	n, err := VerifyJournal(path)
+	if err != nil || n != 3 {
+		t.Fatalf("VerifyJournal = %d, %v", n, err)
+	}
+	found, err := QueryJournal(path, JournalQuery{OrderId: "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 3 || found[0].Kind != JournalIntent || found[1].Ref != found[0].Seq {
+		t.Errorf("query for order 5 = %+v", found)
+	}
+}
+
+func TestJournalTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tail func(lines []string) string
+		kept int
+	}{
+		{"half a record", func(lines []string) string { return lines[2][:len(lines[2])/2] }, 2},
+		{"record without its newline", func(lines []string) string { return strings.TrimSuffix(lines[2], "\n") }, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, lines := testJournal(t)
+			if err := os.WriteFile(path, []byte(lines[0]+lines[1]+tt.tail(lines)), 0600); err != nil {
+				t.Fatal(err)
+			}
+			j, err := OpenOrderJournal(path)
+			if err != nil {
+				t.Fatalf("torn journal did not open: %v", err)
+			}
+			if err := j.RecordCancel("6", nil); err != nil {
+				t.Fatal(err)
+			}
+			j.Close()
+			n, err := VerifyJournal(path)
+			if err != nil || n != tt.kept+1 {
+				t.Errorf("after an append VerifyJournal = %d, %v, want %d records", n, err, tt.kept+1)
+			}
+		})
+	}
+}
+
+func TestJournalBreaks(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(lines []string) []string
+		line   int
+		reason string
+	}{
+		{
+			name: "tampered record",
+			edit: func(lines []string) []string {
+				lines[0] = strings.Replace(lines[0], `"Amount":100`, `"Amount":1000`, 1)
+				return lines
+			},
+			line:   1,
+			reason: "record hash",
+		},
+		{
+			name:   "removed record",
+			edit:   func(lines []string) []string { return append(lines[:1], lines[2:]...) },
+			line:   2,
+			reason: "expected seq",
+		},
+		{
+			name:   "swapped records",
+			edit:   func(lines []string) []string { lines[1], lines[2] = lines[2], lines[1]; return lines },
+			line:   2,
+			reason: "expected seq",
+		},
+		{
+			name: "wrong previous hash",
+			edit: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"PrevHash":"`, `"PrevHash":"0`, 1)
+				return lines
+			},
+			line:   2,
+			reason: "previous hash",
+		},
+		{
+			name:   "garbage line",
+			edit:   func(lines []string) []string { lines[1] = "not json\n"; return lines },
+			line:   2,
+			reason: "invalid character",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, lines := testJournal(t)
+			if err := os.WriteFile(path, []byte(strings.Join(tt.edit(lines), "")), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := VerifyJournal(path)
+			var jb *JournalBreak
+			if !errors.As(err, &jb) || jb.Line != tt.line || !strings.Contains(jb.Reason, tt.reason) {
+				t.Errorf("VerifyJournal = %v, want a break at line %d: %s", err, tt.line, tt.reason)
+			}
+			if _, err := OpenOrderJournal(path); err == nil {
+				t.Error("broken journal opened for appending")
+			}
+		})
+	}
+}
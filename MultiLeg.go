@@ -0,0 +1,380 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// SaxoOptionContract identifies a single listed option.
+type SaxoOptionContract struct {
+	Uic                           int
+	AssetType                     string
+	UnderlyingUic                 int
+	PutCall                       string
+	StrikePrice                   float64
+	Expiry                        string
+	LastTradeDate                 string
+	CanParticipateInMultiLegOrder bool
+}
+
+type SaxoOrderLeg struct {
+	Uic         int
+	AssetType   string
+	BuySell     string
+	Amount      float64
+	ToOpenClose string `json:",omitempty"`
+}
+
+type SaxoMultiLegOrderPost struct {
+	AccountKey    string
+	BuySell       string
+	Amount        float64
+	OrderType     string
+	OrderPrice    float64 `json:",omitempty"`
+	OrderDuration struct {
+		DurationType string
+	}
+	ManualOrder bool
+	Legs        []SaxoOrderLeg
+}
+
+type SaxoMultiLegResult struct {
+	MultiLegOrderId string
+	Orders          []SaxoOrder
+}
+
+// MultiLegStrategy is a set of option legs built by one of the strategy
+// constructors, ready to be sent with PlaceMultiLegOrder.
+type MultiLegStrategy struct {
+	Name      string
+	Legs      []SaxoOrderLeg
+	Contracts []SaxoOptionContract
+}
+
+func (s *MultiLegStrategy) add(c SaxoOptionContract, buysell string, amount float64) {
+	s.Legs = append(s.Legs, SaxoOrderLeg{Uic: c.Uic, AssetType: c.AssetType, BuySell: buysell, Amount: amount, ToOpenClose: "ToOpen"})
+	s.Contracts = append(s.Contracts, c)
+}
+
+// ToClose flips every leg to close an existing strategy position.
+func (s MultiLegStrategy) ToClose() MultiLegStrategy {
+	closing := MultiLegStrategy{Name: s.Name, Contracts: s.Contracts}
+	for _, l := range s.Legs {
+		l.BuySell = oppositeSide(l.BuySell)
+		l.ToOpenClose = "ToClose"
+		closing.Legs = append(closing.Legs, l)
+	}
+	return closing
+}
+
+func oppositeSide(buysell string) string {
+	if buysell == "Buy" {
+		return "Sell"
+	}
+	return "Buy"
+}
+
+// Validate checks the legs can go in one multi-leg order: 2 to 4 legs in
+// whole contracts, one asset type and, where the contracts are known, one
+// underlying.
+func (s MultiLegStrategy) Validate() error {
+	if len(s.Legs) < 2 || len(s.Legs) > 4 {
+		return errors.New(fmt.Sprintf("%s: multi-leg orders need 2 to 4 legs, got %d", s.Name, len(s.Legs)))
+	}
+	uics := make(map[int]bool)
+	underlying := 0
+	for i, l := range s.Legs {
+		if l.Uic <= 0 {
+			return errors.New(fmt.Sprintf("%s: leg %d has no Uic", s.Name, i))
+		}
+		if uics[l.Uic] {
+			return errors.New(fmt.Sprintf("%s: Uic %d used in more than one leg", s.Name, l.Uic))
+		}
+		uics[l.Uic] = true
+		if l.Amount <= 0 {
+			return errors.New(fmt.Sprintf("%s: leg %d amount must be positive", s.Name, i))
+		}
+		if l.Amount != math.Trunc(l.Amount) {
+			return errors.New(fmt.Sprintf("%s: leg %d amount %g is not a whole number of contracts", s.Name, i, l.Amount))
+		}
+		if l.AssetType != s.Legs[0].AssetType {
+			return errors.New(fmt.Sprintf("%s: legs mix asset types %s and %s", s.Name, s.Legs[0].AssetType, l.AssetType))
+		}
+		if l.BuySell != "Buy" && l.BuySell != "Sell" {
+			return errors.New(fmt.Sprintf("%s: leg %d has invalid BuySell %s", s.Name, i, l.BuySell))
+		}
+		if i < len(s.Contracts) {
+			c := s.Contracts[i]
+			if !c.CanParticipateInMultiLegOrder {
+				return errors.New(fmt.Sprintf("%s: Uic %d cannot participate in multi-leg orders", s.Name, c.Uic))
+			}
+			if underlying != 0 && c.UnderlyingUic != 0 && c.UnderlyingUic != underlying {
+				return errors.New(fmt.Sprintf("%s: legs are on different underlyings", s.Name))
+			}
+			if c.UnderlyingUic != 0 {
+				underlying = c.UnderlyingUic
+			}
+		}
+	}
+	return nil
+}
+
+func checkOption(c SaxoOptionContract, putCall string) error {
+	if putCall != "" && c.PutCall != putCall {
+		return errors.New(fmt.Sprintf("Uic %d is a %s, expected a %s", c.Uic, c.PutCall, putCall))
+	}
+	if c.StrikePrice <= 0 {
+		return errors.New(fmt.Sprintf("Uic %d has no strike price", c.Uic))
+	}
+	return nil
+}
+
+// VerticalSpread buys one strike and sells another of the same type and
+// expiry.
+func VerticalSpread(long, short SaxoOptionContract, amount float64) (MultiLegStrategy, error) {
+	if err := checkOption(long, ""); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if err := checkOption(short, long.PutCall); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if long.Expiry != short.Expiry {
+		return MultiLegStrategy{}, errors.New("Vertical spread legs must share an expiry")
+	}
+	if long.StrikePrice == short.StrikePrice {
+		return MultiLegStrategy{}, errors.New("Vertical spread legs must have different strikes")
+	}
+	s := MultiLegStrategy{Name: "Vertical"}
+	s.add(long, "Buy", amount)
+	s.add(short, "Sell", amount)
+	return s, s.Validate()
+}
+
+// Straddle buys (or sells) a call and a put at the same strike and expiry.
+func Straddle(call, put SaxoOptionContract, buysell string, amount float64) (MultiLegStrategy, error) {
+	if err := checkOption(call, "Call"); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if err := checkOption(put, "Put"); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if call.Expiry != put.Expiry || call.StrikePrice != put.StrikePrice {
+		return MultiLegStrategy{}, errors.New("Straddle legs must share strike and expiry")
+	}
+	s := MultiLegStrategy{Name: "Straddle"}
+	s.add(call, buysell, amount)
+	s.add(put, buysell, amount)
+	return s, s.Validate()
+}
+
+// Strangle buys (or sells) an out of the money put and call with the same
+// expiry.
+func Strangle(call, put SaxoOptionContract, buysell string, amount float64) (MultiLegStrategy, error) {
+	if err := checkOption(call, "Call"); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if err := checkOption(put, "Put"); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if call.Expiry != put.Expiry {
+		return MultiLegStrategy{}, errors.New("Strangle legs must share an expiry")
+	}
+	if put.StrikePrice >= call.StrikePrice {
+		return MultiLegStrategy{}, errors.New("Strangle put strike must be below the call strike")
+	}
+	s := MultiLegStrategy{Name: "Strangle"}
+	s.add(call, buysell, amount)
+	s.add(put, buysell, amount)
+	return s, s.Validate()
+}
+
+// CalendarSpread sells the near expiry and buys the far expiry at the same
+// strike.
+func CalendarSpread(near, far SaxoOptionContract, amount float64) (MultiLegStrategy, error) {
+	if err := checkOption(near, ""); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if err := checkOption(far, near.PutCall); err != nil {
+		return MultiLegStrategy{}, err
+	}
+	if near.StrikePrice != far.StrikePrice {
+		return MultiLegStrategy{}, errors.New("Calendar spread legs must share a strike")
+	}
+	if near.Expiry == "" || far.Expiry == "" || near.Expiry >= far.Expiry {
+		return MultiLegStrategy{}, errors.New("Calendar spread far leg must expire after the near leg")
+	}
+	s := MultiLegStrategy{Name: "Calendar"}
+	s.add(near, "Sell", amount)
+	s.add(far, "Buy", amount)
+	return s, s.Validate()
+}
+
+// IronCondor sells a put spread and a call spread around the current price:
+// long put < short put < short call < long call, all in one expiry.
+func IronCondor(longPut, shortPut, shortCall, longCall SaxoOptionContract, amount float64) (MultiLegStrategy, error) {
+	for _, c := range []struct {
+		contract SaxoOptionContract
+		putCall  string
+	}{{longPut, "Put"}, {shortPut, "Put"}, {shortCall, "Call"}, {longCall, "Call"}} {
+		if err := checkOption(c.contract, c.putCall); err != nil {
+			return MultiLegStrategy{}, err
+		}
+		if c.contract.Expiry != longPut.Expiry {
+			return MultiLegStrategy{}, errors.New("Iron condor legs must share an expiry")
+		}
+	}
+	strikes := []float64{longPut.StrikePrice, shortPut.StrikePrice, shortCall.StrikePrice, longCall.StrikePrice}
+	if !sort.Float64sAreSorted(strikes) || strikes[0] == strikes[1] || strikes[2] == strikes[3] || strikes[1] > strikes[2] {
+		return MultiLegStrategy{}, errors.New("Iron condor strikes must be ordered long put < short put <= short call < long call")
+	}
+	s := MultiLegStrategy{Name: "IronCondor"}
+	s.add(longPut, "Buy", amount)
+	s.add(shortPut, "Sell", amount)
+	s.add(shortCall, "Sell", amount)
+	s.add(longCall, "Buy", amount)
+	return s, s.Validate()
+}
+
+// Units is the number of times the strategy's smallest leg ratio is
+// traded: the greatest common divisor of the leg amounts.
+func (s MultiLegStrategy) Units() float64 {
+	units := 0
+	for _, l := range s.Legs {
+		a, b := int(l.Amount), units
+		for b != 0 {
+			a, b = b, a%b
+		}
+		units = a
+	}
+	return float64(units)
+}
+
+// PlaceMultiLegOrder sends the strategy as one order with a net price limit.
+// netPrice is per unit of the strategy (see Units). A positive netPrice is
+// a debit paid, a negative netPrice a credit received. A zero netPrice
+// sends the strategy at market. With api.Risk set the strategy is checked
+// once, as an order for Units of the first leg's instrument valued at the
+// net price, or at the net of the leg quotes for a market order.
+func (api *SaxoAPI) PlaceMultiLegOrder(strategy MultiLegStrategy, netPrice float64, duration string) (*SaxoMultiLegResult, error) {
+	if api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	if api.AccountKey == "" {
+		return nil, errors.New("No account key set")
+	}
+	if api.Paper != nil {
+		return nil, errors.New("Multi-leg orders are not supported in paper trading")
+	}
+	if err := strategy.Validate(); err != nil {
+		return nil, err
+	}
+	if duration == "" {
+		duration = "DayOrder"
+	}
+	post := SaxoMultiLegOrderPost{
+		AccountKey:  api.AccountKey,
+		BuySell:     "Buy",
+		Amount:      1,
+		OrderType:   "Market",
+		ManualOrder: true,
+		Legs:        strategy.Legs,
+	}
+	if netPrice != 0 {
+		post.OrderType = "Limit"
+		post.OrderPrice = netPrice
+	}
+	post.OrderDuration.DurationType = duration
+	if api.Journal == nil {
+		return api.placeMultiLegOrder(strategy, post)
+	}
+	seq, err := api.Journal.RecordIntent(post)
+	if err != nil {
+		return nil, err
+	}
+	result, err := api.placeMultiLegOrder(strategy, post)
+	var orders []SaxoOrder
+	if result != nil {
+		orders = result.Orders
+	}
+	if jerr := api.Journal.RecordResult(seq, orders, err); jerr != nil && err == nil {
+		err = jerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (api *SaxoAPI) placeMultiLegOrder(strategy MultiLegStrategy, post SaxoMultiLegOrderPost) (*SaxoMultiLegResult, error) {
+	if api.Risk != nil {
+		instr, err := api.strategyOrder(strategy, post.OrderPrice)
+		if err != nil {
+			return nil, err
+		}
+		if err := api.Risk.Check(api, instr); err != nil {
+			return nil, err
+		}
+	}
+	api.BodyObject = post
+	data, err := api.Call("multileg_order")
+	api.BodyObject = nil
+	if err != nil {
+		return nil, err
+	}
+	var result SaxoMultiLegResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// strategyOrder is the single order the risk checks see for a strategy. A
+// debit buys and a credit sells. Without a net price the leg quotes are
+// fetched in one call and netted.
+func (api *SaxoAPI) strategyOrder(strategy MultiLegStrategy, netPrice float64) (SaxoOrderInstruction, error) {
+	units := strategy.Units()
+	first := strategy.Legs[0]
+	if netPrice == 0 {
+		uics := make([]int, len(strategy.Legs))
+		for i, l := range strategy.Legs {
+			uics[i] = l.Uic
+		}
+		prices, err := api.PriceList(uics, first.AssetType, nil)
+		if err != nil {
+			return SaxoOrderInstruction{}, err
+		}
+		quotes := make(map[int]*SaxoPrice)
+		for i := range prices {
+			quotes[prices[i].Uic] = &prices[i]
+		}
+		for _, l := range strategy.Legs {
+			p, ok := quotes[l.Uic]
+			if !ok {
+				return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("No price returned for Uic %d", l.Uic))
+			}
+			if err := api.checkQuote(p); err != nil {
+				return SaxoOrderInstruction{}, err
+			}
+			side := PriceAsk
+			if l.BuySell == "Sell" {
+				side = PriceBid
+			}
+			price, ok := QuotePrice(p.Quote, side)
+			if !ok {
+				return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("No %s side quoted for Uic %d", l.BuySell, l.Uic))
+			}
+			if l.BuySell == "Sell" {
+				price = -price
+			}
+			netPrice += price * l.Amount / units
+		}
+	}
+	buysell := "Buy"
+	if netPrice < 0 {
+		buysell = "Sell"
+	}
+	return SaxoOrderInstruction{Uic: first.Uic, AssetType: first.AssetType, BuySell: buysell, Amount: units, OrderPrice: math.Abs(netPrice)}, nil
+}
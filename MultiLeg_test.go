@@ -0,0 +1,207 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testOption(uic int, putCall string, strike float64) SaxoOptionContract {
+	return SaxoOptionContract{Uic: uic, AssetType: "StockOption", UnderlyingUic: 100, PutCall: putCall, StrikePrice: strike, Expiry: "2024-06-21", CanParticipateInMultiLegOrder: true}
+}
+
+func testCondor(t *testing.T, amount float64) MultiLegStrategy {
+	s, err := IronCondor(testOption(1, "Put", 90), testOption(2, "Put", 95), testOption(3, "Call", 105), testOption(4, "Call", 110), amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestMultiLegValidate(t *testing.T) {
+	leg := func(uic int, buysell string, amount float64) SaxoOrderLeg {
+		return SaxoOrderLeg{Uic: uic, AssetType: "StockOption", BuySell: buysell, Amount: amount}
+	}
+	other := testOption(2, "Call", 100)
+	other.UnderlyingUic = 200
+	closed := testOption(2, "Call", 100)
+	closed.CanParticipateInMultiLegOrder = false
+	mixed := leg(2, "Sell", 1)
+	mixed.AssetType = "FuturesOption"
+	tests := []struct {
+		name      string
+		legs      []SaxoOrderLeg
+		contracts []SaxoOptionContract
+		wantErr   string
+	}{
+		{name: "two legs", legs: []SaxoOrderLeg{leg(1, "Buy", 2), leg(2, "Sell", 1)}},
+		{name: "one leg", legs: []SaxoOrderLeg{leg(1, "Buy", 1)}, wantErr: "2 to 4 legs"},
+		{name: "five legs", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(2, "Buy", 1), leg(3, "Buy", 1), leg(4, "Buy", 1), leg(5, "Buy", 1)}, wantErr: "2 to 4 legs"},
+		{name: "duplicate Uic", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(1, "Sell", 1)}, wantErr: "more than one leg"},
+		{name: "fractional ratio", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(2, "Sell", 0.5)}, wantErr: "whole number"},
+		{name: "zero amount", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(2, "Sell", 0)}, wantErr: "positive"},
+		{name: "mixed asset types", legs: []SaxoOrderLeg{leg(1, "Buy", 1), mixed}, wantErr: "mix asset types"},
+		{name: "bad side", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(2, "Short", 1)}, wantErr: "invalid BuySell"},
+		{name: "different underlyings", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(2, "Sell", 1)}, contracts: []SaxoOptionContract{testOption(1, "Call", 95), other}, wantErr: "different underlyings"},
+		{name: "not multi-leg", legs: []SaxoOrderLeg{leg(1, "Buy", 1), leg(2, "Sell", 1)}, contracts: []SaxoOptionContract{testOption(1, "Call", 95), closed}, wantErr: "cannot participate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := MultiLegStrategy{Name: "Test", Legs: tt.legs, Contracts: tt.contracts}.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMultiLegUnits(t *testing.T) {
+	s := MultiLegStrategy{Legs: []SaxoOrderLeg{{Amount: 4}, {Amount: 6}, {Amount: 10}}}
+	if u := s.Units(); u != 2 {
+		t.Errorf("Units = %g, want 2", u)
+	}
+}
+
+func TestPlaceMultiLegOrderBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		netPrice  float64
+		orderType string
+	}{
+		{"net credit", -0.8, "Limit"},
+		{"market", 0, "Market"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, fake := newFakeSaxo(t)
+			fake.reply("POST trade/v2/orders/multileg", `{"MultiLegOrderId":"9","Orders":[{"OrderId":"11"},{"OrderId":"12"}]}`)
+			result, err := api.PlaceMultiLegOrder(testCondor(t, 5), tt.netPrice, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.MultiLegOrderId != "9" || len(result.Orders) != 2 {
+				t.Errorf("result = %+v", result)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal([]byte(fake.calls("POST trade/v2/orders/multileg")[0].Body), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["AccountKey"] != "account" || body["OrderType"] != tt.orderType || body["ManualOrder"] != true {
+				t.Errorf("body = %v", body)
+			}
+			if price, ok := body["OrderPrice"]; ok != (tt.netPrice != 0) || (ok && price != tt.netPrice) {
+				t.Errorf("OrderPrice = %v, want %g", price, tt.netPrice)
+			}
+			if d := body["OrderDuration"].(map[string]interface{}); d["DurationType"] != "DayOrder" {
+				t.Errorf("OrderDuration = %v", d)
+			}
+			legs := body["Legs"].([]interface{})
+			want := []string{"Buy", "Sell", "Sell", "Buy"}
+			for i, l := range legs {
+				leg := l.(map[string]interface{})
+				if leg["Uic"] != float64(i+1) || leg["BuySell"] != want[i] || leg["Amount"] != 5.0 || leg["AssetType"] != "StockOption" || leg["ToOpenClose"] != "ToOpen" {
+					t.Errorf("leg %d = %v, want %s Uic %d", i, leg, want[i], i+1)
+				}
+			}
+			if len(legs) != len(want) {
+				t.Errorf("%d legs, want %d", len(legs), len(want))
+			}
+		})
+	}
+}
+
+// strategyFake serves an EUR account trading EUR options with a contract
+// size of 100.
+func strategyFake(t *testing.T) (*SaxoAPI, *fakeSaxo) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET port/v1/balances", `{"Currency":"EUR","TotalValue":100000}`)
+	fake.reply("GET ref/v1/instruments/details", `{"Data":[{"AssetType":"StockOption","CurrencyCode":"EUR","ContractSize":100}]}`)
+	fake.reply("GET port/v1/netpositions/me", `{"Data":[]}`)
+	fake.reply("GET trade/v1/infoprices/list", `{"Data":[
+		{"Uic":1,"Quote":{"BidPrice":0.9,"AskPrice":1.0}},
+		{"Uic":2,"Quote":{"BidPrice":1.8,"AskPrice":2.0}},
+		{"Uic":3,"Quote":{"BidPrice":1.6,"AskPrice":1.7}},
+		{"Uic":4,"Quote":{"BidPrice":0.6,"AskPrice":0.7}}]}`)
+	fake.reply("POST trade/v2/orders/multileg", `{"MultiLegOrderId":"9"}`)
+	return api, fake
+}
+
+func TestPlaceMultiLegOrderRisk(t *testing.T) {
+	tests := []struct {
+		name     string
+		netPrice float64
+		notional float64
+		prices   int
+	}{
+		// 5 units of a 0.8 credit on 100 contract size
+		{name: "net price", netPrice: -0.8, notional: 400},
+		// long legs at the ask, short legs at the bid: 1.0 + 0.7 - 1.8 - 1.6
+		{name: "market from one price call", notional: 5 * 1.7 * 100, prices: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, fake := strategyFake(t)
+			api.Risk = NewRiskGuard(RiskLimits{MaxOrderNotional: 100, MaxOrdersPerMinute: 1, MaxGrossExposure: 1e6}, nil)
+			_, err := api.PlaceMultiLegOrder(testCondor(t, 5), tt.netPrice, "")
+			var rv *RiskViolation
+			if !errors.As(err, &rv) || rv.Rule != RiskMaxOrderNotional {
+				t.Fatalf("err = %v, want a notional violation", err)
+			}
+			if math.Abs(rv.Value-tt.notional) > 1e-9 || rv.Uic != 1 {
+				t.Errorf("strategy valued at %g on Uic %d, want %g on Uic 1", rv.Value, rv.Uic, tt.notional)
+			}
+			if n := len(fake.calls("GET trade/v1/infoprices/list")); n != tt.prices {
+				t.Errorf("%d price calls, want %d", n, tt.prices)
+			}
+
+			// the whole strategy takes one slot in the rate window
+			api.Risk.Limits.MaxOrderNotional = 0
+			if _, err := api.PlaceMultiLegOrder(testCondor(t, 5), tt.netPrice, ""); err != nil {
+				t.Fatalf("strategy blocked: %v", err)
+			}
+			if _, err := api.PlaceMultiLegOrder(testCondor(t, 5), tt.netPrice, ""); !errors.As(err, &rv) || rv.Rule != RiskMaxOrderRate {
+				t.Errorf("second strategy err = %v, want a rate violation", err)
+			}
+			if n := len(fake.calls("POST trade/v2/orders/multileg")); n != 1 {
+				t.Errorf("%d strategies sent, want 1", n)
+			}
+		})
+	}
+}
+
+func TestPlaceMultiLegOrderJournalsBlockedIntent(t *testing.T) {
+	api, fake := strategyFake(t)
+	path := filepath.Join(t.TempDir(), "orders.journal")
+	j, err := OpenOrderJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	api.Journal = j
+	api.Risk = NewRiskGuard(RiskLimits{AllowedAssetTypes: []string{"FxSpot"}}, nil)
+	if _, err := api.PlaceMultiLegOrder(testCondor(t, 1), 1.2, ""); err == nil {
+		t.Fatal("strategy was not blocked")
+	}
+	if n := len(fake.calls("POST trade/v2/orders/multileg")); n != 0 {
+		t.Errorf("%d strategies sent", n)
+	}
+	records, err := ReadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Kind != JournalIntent || records[1].Kind != JournalError || records[1].Ref != records[0].Seq {
+		t.Fatalf("journal = %+v, want the intent and its error", records)
+	}
+	if !strings.Contains(records[1].Error, string(RiskAssetType)) || records[0].Uic != 1 {
+		t.Errorf("journal = %+v", records)
+	}
+}
@@ -0,0 +1,242 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Asset types that have contract option spaces.
+var optionAssetTypes = []string{"StockOption", "StockIndexOption", "FuturesOption"}
+
+type SaxoSpecificOption struct {
+	PutCall       string
+	StrikePrice   float64
+	Uic           int
+	UnderlyingUic int
+	TradingStatus string
+}
+
+type SaxoOptionSpaceExpiry struct {
+	DisplayDaysToExpiry int
+	DisplayExpiry       string
+	Expiry              string
+	LastTradeDate       string
+	SpecificOptions     []SaxoSpecificOption
+}
+
+type SaxoContractOptionSpace struct {
+	AssetType                     string
+	CanParticipateInMultiLegOrder bool
+	ContractSize                  float64
+	CurrencyCode                  string
+	DefaultExpiry                 string
+	Description                   string
+	ExchangeId                    string
+	OptionRootId                  int
+	OptionSpace                   []SaxoOptionSpaceExpiry
+	UnderlyingAssetType           string
+	UnderlyingUic                 int
+}
+
+type OptionStrike struct {
+	Strike float64
+	Call   *SaxoOptionContract
+	Put    *SaxoOptionContract
+}
+
+// OptionExpiry holds the strikes of one expiry in ascending order.
+type OptionExpiry struct {
+	Expiry        time.Time
+	LastTradeDate string
+	Strikes       []OptionStrike
+}
+
+// OptionChain is every listed contract of an option root, expiries in date
+// order.
+type OptionChain struct {
+	OptionRootId  int
+	UnderlyingUic int
+	AssetType     string
+	CurrencyCode  string
+	ContractSize  float64
+	Expiries      []OptionExpiry
+}
+
+// OptionRoots finds the option roots listed on an underlying.
+func (api *SaxoAPI) OptionRoots(underlyingUic int) ([]SaxoAsset, error) {
+	return api.Instruments(SaxoInstruction{AssetTypes: optionAssetTypes, UnderlyingUic: underlyingUic})
+}
+
+// OptionChain returns the chain of the first option root on the
+// underlying. Use OptionChainForRoot when an underlying has several.
+func (api *SaxoAPI) OptionChain(underlyingUic int) (*OptionChain, error) {
+	roots, err := api.OptionRoots(underlyingUic)
+	if err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errors.New(fmt.Sprintf("No options listed on Uic %d", underlyingUic))
+	}
+	return api.OptionChainForRoot(roots[0].Identifier)
+}
+
+func (api *SaxoAPI) OptionChainForRoot(optionRootId int) (*OptionChain, error) {
+	api.Params = map[string]string{
+		"OptionRootId":       strconv.Itoa(optionRootId),
+		"OptionSpaceSegment": "AllDates",
+	}
+	data, err := api.Call("option_space")
+	if err != nil {
+		return nil, err
+	}
+	var space SaxoContractOptionSpace
+	err = json.Unmarshal(data, &space)
+	if err != nil {
+		return nil, err
+	}
+	return NewOptionChain(space)
+}
+
+func NewOptionChain(space SaxoContractOptionSpace) (*OptionChain, error) {
+	chain := &OptionChain{
+		OptionRootId:  space.OptionRootId,
+		UnderlyingUic: space.UnderlyingUic,
+		AssetType:     space.AssetType,
+		CurrencyCode:  space.CurrencyCode,
+		ContractSize:  space.ContractSize,
+	}
+	for _, e := range space.OptionSpace {
+		expiry, err := ParseSaxoDate(e.Expiry)
+		if err != nil {
+			return nil, err
+		}
+		strikes := make(map[float64]*OptionStrike)
+		for _, o := range e.SpecificOptions {
+			s, ok := strikes[o.StrikePrice]
+			if !ok {
+				s = &OptionStrike{Strike: o.StrikePrice}
+				strikes[o.StrikePrice] = s
+			}
+			underlying := o.UnderlyingUic
+			if underlying == 0 {
+				underlying = space.UnderlyingUic
+			}
+			c := &SaxoOptionContract{
+				Uic:                           o.Uic,
+				AssetType:                     space.AssetType,
+				UnderlyingUic:                 underlying,
+				PutCall:                       o.PutCall,
+				StrikePrice:                   o.StrikePrice,
+				Expiry:                        fxDate(expiry),
+				LastTradeDate:                 e.LastTradeDate,
+				CanParticipateInMultiLegOrder: space.CanParticipateInMultiLegOrder,
+			}
+			if o.PutCall == "Put" {
+				s.Put = c
+			} else {
+				s.Call = c
+			}
+		}
+		oe := OptionExpiry{Expiry: expiry, LastTradeDate: e.LastTradeDate}
+		for _, s := range strikes {
+			oe.Strikes = append(oe.Strikes, *s)
+		}
+		sort.Slice(oe.Strikes, func(i, j int) bool { return oe.Strikes[i].Strike < oe.Strikes[j].Strike })
+		chain.Expiries = append(chain.Expiries, oe)
+	}
+	sort.Slice(chain.Expiries, func(i, j int) bool { return chain.Expiries[i].Expiry.Before(chain.Expiries[j].Expiry) })
+	return chain, nil
+}
+
+// NearestExpiry returns the first expiry on or after the date of t.
+func (oc *OptionChain) NearestExpiry(t time.Time) (*OptionExpiry, error) {
+	day := dateOnly(t)
+	for i := range oc.Expiries {
+		if !oc.Expiries[i].Expiry.Before(day) {
+			return &oc.Expiries[i], nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("No expiry of option root %d after %s", oc.OptionRootId, fxDate(t)))
+}
+
+// ExpiryAfter returns the first expiry at least days after t, for picking
+// a tenor such as the monthly roughly 30 days out.
+func (oc *OptionChain) ExpiryAfter(t time.Time, days int) (*OptionExpiry, error) {
+	return oc.NearestExpiry(t.AddDate(0, 0, days))
+}
+
+// Expiry returns the expiry on date (YYYY-MM-DD).
+func (oc *OptionChain) Expiry(date string) (*OptionExpiry, bool) {
+	for i := range oc.Expiries {
+		if fxDate(oc.Expiries[i].Expiry) == date {
+			return &oc.Expiries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Contract finds a listed option by expiry date, strike and Put or Call.
+func (oc *OptionChain) Contract(date string, strike float64, putCall string) (*SaxoOptionContract, error) {
+	e, ok := oc.Expiry(date)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Option root %d has no expiry %s", oc.OptionRootId, date))
+	}
+	s, ok := e.Strike(strike)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Expiry %s has no strike %g", date, strike))
+	}
+	c := s.Call
+	if putCall == "Put" {
+		c = s.Put
+	}
+	if c == nil {
+		return nil, errors.New(fmt.Sprintf("No %s listed at %g on %s", putCall, strike, date))
+	}
+	return c, nil
+}
+
+func (oe *OptionExpiry) Strike(strike float64) (*OptionStrike, bool) {
+	i := sort.Search(len(oe.Strikes), func(i int) bool { return oe.Strikes[i].Strike >= strike })
+	if i < len(oe.Strikes) && oe.Strikes[i].Strike == strike {
+		return &oe.Strikes[i], true
+	}
+	return nil, false
+}
+
+// ATMStrike returns the strike closest to spot. Ties go to the lower
+// strike.
+func (oe *OptionExpiry) ATMStrike(spot float64) (*OptionStrike, error) {
+	if len(oe.Strikes) == 0 {
+		return nil, errors.New(fmt.Sprintf("Expiry %s has no strikes", fxDate(oe.Expiry)))
+	}
+	best := 0
+	for i, s := range oe.Strikes {
+		if math.Abs(s.Strike-spot) < math.Abs(oe.Strikes[best].Strike-spot) {
+			best = i
+		}
+	}
+	return &oe.Strikes[best], nil
+}
+
+// StrikesWithin returns the strikes within pct percent of spot.
+func (oe *OptionExpiry) StrikesWithin(spot, pct float64) []OptionStrike {
+	lo, hi := spot*(1-pct/100), spot*(1+pct/100)
+	var strikes []OptionStrike
+	for _, s := range oe.Strikes {
+		if s.Strike >= lo && s.Strike <= hi {
+			strikes = append(strikes, s)
+		}
+	}
+	return strikes
+}
+
+// DaysToExpiry counts calendar days from t to the expiry date.
+func (oe *OptionExpiry) DaysToExpiry(t time.Time) int {
+	day := dateOnly(t)
+	return int(oe.Expiry.Sub(day).Hours() / 24)
+}
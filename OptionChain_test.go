@@ -0,0 +1,176 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// testOptionSpace lists expiries out of date order, each with strikes out
+// of order and the 110 put missing in April.
+func testOptionSpace() SaxoContractOptionSpace {
+	expiry := func(date string, uic int, strikes ...float64) SaxoOptionSpaceExpiry {
+		e := SaxoOptionSpaceExpiry{Expiry: date + "T00:00:00Z", LastTradeDate: date + "T20:00:00Z"}
+		for _, k := range strikes {
+			e.SpecificOptions = append(e.SpecificOptions,
+				SaxoSpecificOption{PutCall: "Call", StrikePrice: k, Uic: uic},
+				SaxoSpecificOption{PutCall: "Put", StrikePrice: k, Uic: uic + 1})
+			uic += 2
+		}
+		return e
+	}
+	april := expiry("2024-04-19", 2000, 110, 90, 100, 95, 105)
+	// drop the 110 put
+	april.SpecificOptions = append(april.SpecificOptions[:1], april.SpecificOptions[2:]...)
+	return SaxoContractOptionSpace{
+		AssetType:     "StockOption",
+		ContractSize:  100,
+		CurrencyCode:  "USD",
+		OptionRootId:  77,
+		UnderlyingUic: 211,
+		OptionSpace: []SaxoOptionSpaceExpiry{
+			april,
+			expiry("2024-03-15", 1000, 100, 90, 110),
+			expiry("2024-06-21", 3000, 100),
+		},
+	}
+}
+
+func TestOptionChainLayout(t *testing.T) {
+	chain, err := NewOptionChain(testOptionSpace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dates []string
+	for _, e := range chain.Expiries {
+		dates = append(dates, fxDate(e.Expiry))
+		for i := 1; i < len(e.Strikes); i++ {
+			if e.Strikes[i-1].Strike >= e.Strikes[i].Strike {
+				t.Errorf("%s strikes out of order: %v then %v", fxDate(e.Expiry), e.Strikes[i-1].Strike, e.Strikes[i].Strike)
+			}
+		}
+	}
+	if len(dates) != 3 || dates[0] != "2024-03-15" || dates[1] != "2024-04-19" || dates[2] != "2024-06-21" {
+		t.Errorf("expiries = %v", dates)
+	}
+	c, err := chain.Contract("2024-03-15", 90, "Put")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Uic != 1003 || c.UnderlyingUic != 211 || c.AssetType != "StockOption" || c.Expiry != "2024-03-15" {
+		t.Errorf("March 90 put = %+v", c)
+	}
+	for _, tt := range []struct {
+		date    string
+		strike  float64
+		putCall string
+	}{
+		{"2024-05-17", 100, "Call"},
+		{"2024-03-15", 95, "Call"},
+		{"2024-04-19", 110, "Put"},
+	} {
+		if c, err := chain.Contract(tt.date, tt.strike, tt.putCall); err == nil {
+			t.Errorf("Contract(%s, %g, %s) = %+v, want an error", tt.date, tt.strike, tt.putCall, c)
+		}
+	}
+	if c, err := chain.Contract("2024-04-19", 110, "Call"); err != nil || c.Uic != 2000 {
+		t.Errorf("April 110 call = %+v, %v", c, err)
+	}
+}
+
+func TestOptionChainExpirySelection(t *testing.T) {
+	chain, err := NewOptionChain(testOptionSpace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		days int
+		want string
+	}{
+		{"before the first expiry", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), 0, "2024-03-15"},
+		{"on expiry day after the close", time.Date(2024, 3, 15, 22, 0, 0, 0, time.UTC), 0, "2024-03-15"},
+		{"the day after an expiry", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC), 0, "2024-04-19"},
+		{"a month out", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 30, "2024-04-19"},
+		{"past the last expiry", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 30, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := chain.ExpiryAfter(tt.t, tt.days)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("ExpiryAfter = %s, want an error", fxDate(e.Expiry))
+				}
+				return
+			}
+			if err != nil || fxDate(e.Expiry) != tt.want {
+				t.Fatalf("ExpiryAfter = %v, %v, want %s", e, err, tt.want)
+			}
+		})
+	}
+	e, _ := chain.Expiry("2024-04-19")
+	if d := e.DaysToExpiry(time.Date(2024, 4, 1, 18, 0, 0, 0, time.UTC)); d != 18 {
+		t.Errorf("DaysToExpiry = %d, want 18", d)
+	}
+}
+
+func TestOptionChainStrikeSelection(t *testing.T) {
+	chain, err := NewOptionChain(testOptionSpace())
+	if err != nil {
+		t.Fatal(err)
+	}
+	april, _ := chain.Expiry("2024-04-19")
+	tests := []struct {
+		spot float64
+		want float64
+	}{
+		{101, 100},
+		{102.5, 100}, // ties go to the lower strike
+		{103, 105},
+		{50, 90},
+		{500, 110},
+	}
+	for _, tt := range tests {
+		s, err := april.ATMStrike(tt.spot)
+		if err != nil || s.Strike != tt.want {
+			t.Errorf("ATMStrike(%g) = %v, %v, want %g", tt.spot, s, err, tt.want)
+		}
+	}
+	var within []float64
+	for _, s := range april.StrikesWithin(100, 5) {
+		within = append(within, s.Strike)
+	}
+	if !sameValues(within, []float64{95, 100, 105}) {
+		t.Errorf("StrikesWithin 5%% = %v", within)
+	}
+	if _, err := (&OptionExpiry{}).ATMStrike(100); err == nil {
+		t.Error("ATMStrike without strikes did not fail")
+	}
+}
+
+func TestOptionChainForUnderlying(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET ref/v1/instruments", `{"Data":[{"Identifier":77,"AssetType":"StockOption"}]}`)
+	ba, _ := json.Marshal(testOptionSpace())
+	fake.reply("GET ref/v1/instruments/contractoptionspaces/77", string(ba))
+	chain, err := api.OptionChain(211)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.OptionRootId != 77 || chain.ContractSize != 100 || len(chain.Expiries) != 3 {
+		t.Errorf("chain = %+v", chain)
+	}
+	calls := fake.calls("GET ref/v1/instruments")
+	if len(calls) != 1 || calls[0].Query.Get("UnderlyingUic") != "211" {
+		t.Errorf("root search = %+v", calls)
+	}
+	if q := fake.calls("GET ref/v1/instruments/contractoptionspaces/77"); len(q) != 1 || q[0].Query.Get("OptionSpaceSegment") != "AllDates" {
+		t.Errorf("option space request = %+v", q)
+	}
+
+	fake.reply("GET ref/v1/instruments", `{"Data":[]}`)
+	if _, err := api.OptionChain(212); err == nil {
+		t.Error("OptionChain for an underlying without options did not fail")
+	}
+}
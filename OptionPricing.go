@@ -0,0 +1,275 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type OptionModel string
+
+const (
+	// ModelBlackScholes prices options on spot with a continuous dividend
+	// yield.
+	ModelBlackScholes OptionModel = "BlackScholes"
+	// ModelBlack76 prices options on futures and forwards.
+	ModelBlack76 OptionModel = "Black76"
+)
+
+// OptionInputs describes one European option. Expiry is in years,
+// Volatility, Rate and DividendYield are annual decimals (0.2 for 20%).
+// For Black76, Underlying is the futures price and DividendYield is unused.
+type OptionInputs struct {
+	Model         OptionModel
+	PutCall       string
+	Underlying    float64
+	Strike        float64
+	Expiry        float64
+	Rate          float64
+	DividendYield float64
+	Volatility    float64
+}
+
+// OptionValue is a model price with its Greeks. Vega and Rho are per one
+// percentage point, Theta is per calendar day.
+type OptionValue struct {
+	Price float64
+	Delta float64
+	Gamma float64
+	Vega  float64
+	Theta float64
+	Rho   float64
+}
+
+// YearFraction is the act/365 year fraction between two times.
+func YearFraction(from, to time.Time) float64 {
+	return to.Sub(from).Hours() / 24 / 365
+}
+
+func normCDF(x float64) float64 {
+	return 0.5 * math.Erfc(-x/math.Sqrt2)
+}
+
+func normPDF(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func (in OptionInputs) check() error {
+	if in.PutCall != "Call" && in.PutCall != "Put" {
+		return errors.New(fmt.Sprintf("PutCall must be Call or Put, got %s", in.PutCall))
+	}
+	if in.Underlying <= 0 || in.Strike <= 0 {
+		return errors.New("Underlying and strike must be positive")
+	}
+	if in.Expiry < 0 || in.Volatility < 0 {
+		return errors.New("Expiry and volatility can not be negative")
+	}
+	return nil
+}
+
+// PriceOption values a European option under the chosen model.
+func PriceOption(in OptionInputs) (OptionValue, error) {
+	if err := in.check(); err != nil {
+		return OptionValue{}, err
+	}
+	call := in.PutCall == "Call"
+	// Black76 is Black-Scholes with the carry equal to the rate
+	q := in.DividendYield
+	if in.Model == ModelBlack76 {
+		q = in.Rate
+	}
+	S, K, T, r, v := in.Underlying, in.Strike, in.Expiry, in.Rate, in.Volatility
+	dfq, dfr := math.Exp(-q*T), math.Exp(-r*T)
+
+	if T == 0 || v == 0 {
+		// intrinsic value on the forward
+		fwd := S * dfq
+		var val OptionValue
+		if call && fwd > K*dfr {
+			val = OptionValue{Price: fwd - K*dfr, Delta: dfq}
+		} else if !call && fwd < K*dfr {
+			val = OptionValue{Price: K*dfr - fwd, Delta: -dfq}
+		}
+		return val, nil
+	}
+
+	sqrtT := math.Sqrt(T)
+	d1 := (math.Log(S/K) + (r-q+v*v/2)*T) / (v * sqrtT)
+	d2 := d1 - v*sqrtT
+	val := OptionValue{
+		Gamma: dfq * normPDF(d1) / (S * v * sqrtT),
+		Vega:  S * dfq * normPDF(d1) * sqrtT / 100,
+	}
+	decay := -S * dfq * normPDF(d1) * v / (2 * sqrtT)
+	if call {
+		val.Price = S*dfq*normCDF(d1) - K*dfr*normCDF(d2)
+		val.Delta = dfq * normCDF(d1)
+		val.Theta = (decay + q*S*dfq*normCDF(d1) - r*K*dfr*normCDF(d2)) / 365
+		val.Rho = K * T * dfr * normCDF(d2) / 100
+	} else {
+		val.Price = K*dfr*normCDF(-d2) - S*dfq*normCDF(-d1)
+		val.Delta = -dfq * normCDF(-d1)
+		val.Theta = (decay - q*S*dfq*normCDF(-d1) + r*K*dfr*normCDF(-d2)) / 365
+		val.Rho = -K * T * dfr * normCDF(-d2) / 100
+	}
+	if in.Model == ModelBlack76 {
+		// the futures price does not move with the rate
+		val.Rho = -T * val.Price / 100
+	}
+	return val, nil
+}
+
+// ImpliedVolatility finds the volatility at which the model gives price,
+// by Newton steps kept inside a bisection bracket. It fails for prices
+// outside the model's no-arbitrage range and when the search does not
+// converge.
+func ImpliedVolatility(in OptionInputs, price float64) (float64, error) {
+	if err := in.check(); err != nil {
+		return 0, err
+	}
+	if in.Expiry <= 0 {
+		return 0, errors.New("Option has expired")
+	}
+	if price <= 0 {
+		return 0, errors.New("Option price must be positive")
+	}
+	lo, hi := 1e-6, 5.0
+	in.Volatility = lo
+	low, _ := PriceOption(in)
+	in.Volatility = hi
+	high, _ := PriceOption(in)
+	if price < low.Price || price > high.Price {
+		return 0, errors.New(fmt.Sprintf("Price %g is outside the model range %g to %g", price, low.Price, high.Price))
+	}
+	v := 0.3
+	for i := 0; i < 100; i++ {
+		in.Volatility = v
+		val, _ := PriceOption(in)
+		diff := val.Price - price
+		if math.Abs(diff) < 1e-10 {
+			return v, nil
+		}
+		if diff > 0 {
+			hi = v
+		} else {
+			lo = v
+		}
+		next := v - diff/(val.Vega*100)
+		if val.Vega <= 0 || next <= lo || next >= hi {
+			next = (lo + hi) / 2
+		}
+		if math.Abs(next-v) < 1e-12 {
+			return next, nil
+		}
+		v = next
+	}
+	return 0, errors.New(fmt.Sprintf("Implied volatility for price %g did not converge", price))
+}
+
+// Saxo asset type of the underlying of each option asset type.
+var optionUnderlyingTypes = map[string]string{
+	"StockOption":      "Stock",
+	"StockIndexOption": "StockIndex",
+	"FuturesOption":    "ContractFutures",
+}
+
+// OptionAnalytics is a locally computed valuation of a listed option.
+type OptionAnalytics struct {
+	Contract          SaxoOptionContract
+	Model             OptionModel
+	UnderlyingPrice   float64
+	OptionPrice       float64
+	ImpliedVolatility float64
+	OptionValue
+}
+
+// SaxoGreeks returns the analytics in the shape of the Greeks field group,
+// for reports that mix both sources.
+func (oa OptionAnalytics) SaxoGreeks() SaxoGreeks {
+	return SaxoGreeks{
+		Delta:            oa.Delta,
+		Gamma:            oa.Gamma,
+		Theta:            oa.Theta,
+		Vega:             oa.Vega,
+		Rho:              oa.Rho,
+		MidVolatility:    oa.ImpliedVolatility * 100,
+		TheoreticalPrice: oa.Price,
+	}
+}
+
+// optionExpiryTime is when a contract stops trading: its LastTradeDate, or
+// its expiry, and the end of that day when only a date is given.
+func optionExpiryTime(c SaxoOptionContract) (time.Time, error) {
+	date := c.LastTradeDate
+	if date == "" {
+		date = c.Expiry
+	}
+	t, err := ParseSaxoDate(date)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t.Equal(dateOnly(t)) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// OptionAnalytics prices a contract from the option chain locally. It
+// fetches the underlying and option mids with Prices, backs out the
+// implied volatility and computes the Greeks at that volatility. Futures
+// options use Black76, everything else Black-Scholes.
+func (api *SaxoAPI) OptionAnalytics(c SaxoOptionContract, rate, dividendYield float64) (*OptionAnalytics, error) {
+	underlyingType, ok := optionUnderlyingTypes[c.AssetType]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown option asset type %s", c.AssetType))
+	}
+	expiry, err := optionExpiryTime(c)
+	if err != nil {
+		return nil, err
+	}
+	up, err := api.Prices(SaxoInstruction{Uic: c.UnderlyingUic, AssetTypes: []string{underlyingType}})
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkQuote(up); err != nil {
+		return nil, err
+	}
+	op, err := api.Prices(SaxoInstruction{Uic: c.Uic, AssetTypes: []string{c.AssetType}})
+	if err != nil {
+		return nil, err
+	}
+	if err := api.checkQuote(op); err != nil {
+		return nil, err
+	}
+	underlying, ok := QuotePrice(up.Quote, PriceMid)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("No price for underlying Uic %d", c.UnderlyingUic))
+	}
+	price, ok := QuotePrice(op.Quote, PriceMid)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("No price for option Uic %d", c.Uic))
+	}
+	in := OptionInputs{
+		Model:         ModelBlackScholes,
+		PutCall:       c.PutCall,
+		Underlying:    underlying,
+		Strike:        c.StrikePrice,
+		Expiry:        math.Max(0, YearFraction(time.Now(), expiry)),
+		Rate:          rate,
+		DividendYield: dividendYield,
+	}
+	if c.AssetType == "FuturesOption" {
+		in.Model = ModelBlack76
+	}
+	iv, err := ImpliedVolatility(in, price)
+	if err != nil {
+		return nil, err
+	}
+	in.Volatility = iv
+	val, err := PriceOption(in)
+	if err != nil {
+		return nil, err
+	}
+	return &OptionAnalytics{Contract: c, Model: in.Model, UnderlyingPrice: underlying, OptionPrice: price, ImpliedVolatility: iv, OptionValue: val}, nil
+}
@@ -0,0 +1,167 @@
+package saxotrader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPriceOption(t *testing.T) {
+	// reference values from Hull, Options, Futures and Other Derivatives
+	tests := []struct {
+		name string
+		in   OptionInputs
+		want OptionValue
+	}{
+		{
+			name: "call",
+			in:   OptionInputs{Model: ModelBlackScholes, PutCall: "Call", Underlying: 42, Strike: 40, Expiry: 0.5, Rate: 0.1, Volatility: 0.2},
+			want: OptionValue{Price: 4.7594, Delta: 0.7791, Gamma: 0.0500, Vega: 0.0881, Theta: -0.0125, Rho: 0.1398},
+		},
+		{
+			name: "put",
+			in:   OptionInputs{Model: ModelBlackScholes, PutCall: "Put", Underlying: 42, Strike: 40, Expiry: 0.5, Rate: 0.1, Volatility: 0.2},
+			want: OptionValue{Price: 0.8086, Delta: -0.2209, Gamma: 0.0500, Vega: 0.0881, Theta: -0.0021, Rho: -0.0504},
+		},
+		{
+			name: "call with dividend yield",
+			in:   OptionInputs{Model: ModelBlackScholes, PutCall: "Call", Underlying: 930, Strike: 900, Expiry: 2.0 / 12, Rate: 0.08, DividendYield: 0.03, Volatility: 0.2},
+			want: OptionValue{Price: 51.8330, Delta: 0.7034, Gamma: 0.0045, Vega: 1.2995, Theta: -0.2919, Rho: 1.0039},
+		},
+		{
+			name: "greeks",
+			in:   OptionInputs{Model: ModelBlackScholes, PutCall: "Call", Underlying: 49, Strike: 50, Expiry: 0.3846, Rate: 0.05, Volatility: 0.2},
+			want: OptionValue{Price: 2.4005, Delta: 0.5216, Gamma: 0.0655, Vega: 0.1211, Theta: -0.0118, Rho: 0.0891},
+		},
+		{
+			name: "black76 put",
+			in:   OptionInputs{Model: ModelBlack76, PutCall: "Put", Underlying: 20, Strike: 20, Expiry: 4.0 / 12, Rate: 0.09, DividendYield: 0.5, Volatility: 0.25},
+			want: OptionValue{Price: 1.1166, Delta: -0.4573, Gamma: 0.1338, Vega: 0.0446, Theta: -0.0043, Rho: -0.0037},
+		},
+		{
+			name: "expired call",
+			in:   OptionInputs{Model: ModelBlackScholes, PutCall: "Call", Underlying: 105, Strike: 100, Rate: 0.05, Volatility: 0.2},
+			want: OptionValue{Price: 5, Delta: 1},
+		},
+		{
+			name: "expired put out of the money",
+			in:   OptionInputs{Model: ModelBlackScholes, PutCall: "Put", Underlying: 105, Strike: 100, Rate: 0.05, Volatility: 0.2},
+			want: OptionValue{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PriceOption(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checks := []struct {
+				field     string
+				got, want float64
+			}{
+				{"Price", got.Price, tt.want.Price},
+				{"Delta", got.Delta, tt.want.Delta},
+				{"Gamma", got.Gamma, tt.want.Gamma},
+				{"Vega", got.Vega, tt.want.Vega},
+				{"Theta", got.Theta, tt.want.Theta},
+				{"Rho", got.Rho, tt.want.Rho},
+			}
+			for _, c := range checks {
+				if math.Abs(c.got-c.want) > 1e-4 {
+					t.Errorf("%s = %.6f, want %.4f", c.field, c.got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPriceOptionRejectsBadInputs(t *testing.T) {
+	tests := []OptionInputs{
+		{PutCall: "Straddle", Underlying: 100, Strike: 100, Expiry: 1, Volatility: 0.2},
+		{PutCall: "Call", Underlying: 0, Strike: 100, Expiry: 1, Volatility: 0.2},
+		{PutCall: "Call", Underlying: 100, Strike: 100, Expiry: -1, Volatility: 0.2},
+		{PutCall: "Put", Underlying: 100, Strike: 100, Expiry: 1, Volatility: -0.2},
+	}
+	for _, in := range tests {
+		if _, err := PriceOption(in); err == nil {
+			t.Errorf("PriceOption(%+v) did not fail", in)
+		}
+	}
+}
+
+func TestImpliedVolatilityRoundTrip(t *testing.T) {
+	tests := []OptionInputs{
+		{Model: ModelBlackScholes, PutCall: "Call", Underlying: 100, Strike: 100, Expiry: 1, Rate: 0.03, Volatility: 0.2},
+		{Model: ModelBlackScholes, PutCall: "Put", Underlying: 100, Strike: 120, Expiry: 0.25, Rate: 0.01, DividendYield: 0.02, Volatility: 0.45},
+		{Model: ModelBlackScholes, PutCall: "Call", Underlying: 50, Strike: 40, Expiry: 2, Rate: 0.05, Volatility: 0.08},
+		{Model: ModelBlackScholes, PutCall: "Call", Underlying: 100, Strike: 150, Expiry: 0.1, Rate: 0, Volatility: 1.5},
+		{Model: ModelBlack76, PutCall: "Put", Underlying: 4500, Strike: 4400, Expiry: 0.5, Rate: 0.04, Volatility: 0.18},
+		{Model: ModelBlack76, PutCall: "Call", Underlying: 80, Strike: 90, Expiry: 1.5, Rate: 0.02, Volatility: 0.35},
+	}
+	for _, in := range tests {
+		val, err := PriceOption(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv, err := ImpliedVolatility(in, val.Price)
+		if err != nil {
+			t.Errorf("ImpliedVolatility(%+v): %v", in, err)
+			continue
+		}
+		if math.Abs(iv-in.Volatility) > 1e-6 {
+			t.Errorf("ImpliedVolatility(%+v) = %.8f, want %g", in, iv, in.Volatility)
+		}
+	}
+}
+
+func TestImpliedVolatilityErrors(t *testing.T) {
+	call := OptionInputs{Model: ModelBlackScholes, PutCall: "Call", Underlying: 100, Strike: 80, Expiry: 1, Rate: 0.03}
+	put := call
+	put.PutCall = "Put"
+	expired := call
+	expired.Expiry = 0
+	tests := []struct {
+		name  string
+		in    OptionInputs
+		price float64
+	}{
+		{"call above the underlying", call, 150},
+		{"call below its discounted intrinsic value", call, 100 - 80*math.Exp(-0.03) - 0.5},
+		{"put above the discounted strike", put, 80},
+		{"zero price", put, 0},
+		{"expired", expired, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v, err := ImpliedVolatility(tt.in, tt.price); err == nil {
+				t.Errorf("ImpliedVolatility = %g, want an error", v)
+			}
+		})
+	}
+}
+
+func TestOptionExpiryTime(t *testing.T) {
+	tests := []struct {
+		name string
+		c    SaxoOptionContract
+		want time.Time
+	}{
+		{"end of expiry day", SaxoOptionContract{Expiry: "2024-06-21"}, time.Date(2024, 6, 22, 0, 0, 0, 0, time.UTC)},
+		{"last trade date", SaxoOptionContract{Expiry: "2024-06-21", LastTradeDate: "2024-06-20"}, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)},
+		{"last trade time", SaxoOptionContract{Expiry: "2024-06-21", LastTradeDate: "2024-06-21T15:30:00Z"}, time.Date(2024, 6, 21, 15, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := optionExpiryTime(tt.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if _, err := optionExpiryTime(SaxoOptionContract{}); err == nil {
+		t.Error("contract without expiry did not fail")
+	}
+}
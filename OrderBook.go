@@ -0,0 +1,215 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+type BookLevel struct {
+	Price  float64
+	Size   float64
+	Orders int
+}
+
+// OrderBook is the market depth of one instrument, best prices first.
+// Without depth data the book holds the top of book quote only.
+type OrderBook struct {
+	Uic       int
+	AssetType string
+	Time      time.Time
+	Bids      []BookLevel
+	Asks      []BookLevel
+}
+
+func depthLevels(prices, sizes []float64, orders []int, count int) []BookLevel {
+	if count <= 0 || count > len(prices) {
+		count = len(prices)
+	}
+	levels := make([]BookLevel, 0, count)
+	for i := 0; i < count; i++ {
+		if prices[i] == 0 {
+			continue
+		}
+		l := BookLevel{Price: prices[i]}
+		if i < len(sizes) {
+			l.Size = sizes[i]
+		}
+		if i < len(orders) {
+			l.Orders = orders[i]
+		}
+		levels = append(levels, l)
+	}
+	return levels
+}
+
+// NewOrderBook builds a book from a price fetched or streamed with the
+// MarketDepth field group.
+func NewOrderBook(p SaxoPrice) *OrderBook {
+	book := &OrderBook{Uic: p.Uic, AssetType: p.AssetType}
+	book.Time, _ = ParseSaxoDate(p.LastUpdated)
+	d := p.MarketDepth
+	book.Bids = depthLevels(d.Bid, d.BidSize, d.BidOrders, d.NoOfBids)
+	book.Asks = depthLevels(d.Ask, d.AskSize, d.AskOrders, d.NoOfOffers)
+	if len(book.Bids) == 0 && p.Quote.BidPrice != 0 {
+		book.Bids = []BookLevel{{Price: p.Quote.BidPrice, Size: p.Quote.BidSize}}
+	}
+	if len(book.Asks) == 0 && p.Quote.AskPrice != 0 {
+		book.Asks = []BookLevel{{Price: p.Quote.AskPrice, Size: p.Quote.AskSize}}
+	}
+	return book
+}
+
+func (ob *OrderBook) BestBid() (BookLevel, bool) {
+	if len(ob.Bids) == 0 {
+		return BookLevel{}, false
+	}
+	return ob.Bids[0], true
+}
+
+func (ob *OrderBook) BestAsk() (BookLevel, bool) {
+	if len(ob.Asks) == 0 {
+		return BookLevel{}, false
+	}
+	return ob.Asks[0], true
+}
+
+// Spread is the best ask less the best bid, or NaN for a one sided book.
+func (ob *OrderBook) Spread() float64 {
+	bid, okb := ob.BestBid()
+	ask, oka := ob.BestAsk()
+	if !okb || !oka {
+		return math.NaN()
+	}
+	return ask.Price - bid.Price
+}
+
+func (ob *OrderBook) Mid() float64 {
+	bid, okb := ob.BestBid()
+	ask, oka := ob.BestAsk()
+	if !okb || !oka {
+		return math.NaN()
+	}
+	return (ask.Price + bid.Price) / 2
+}
+
+// SpreadBps is the spread in basis points of the mid price.
+func (ob *OrderBook) SpreadBps() float64 {
+	return ob.Spread() / ob.Mid() * 10000
+}
+
+// Imbalance compares the bid and ask size of the first levels of the book,
+// from -1 (all offers) to 1 (all bids). levels <= 0 uses the whole book.
+func (ob *OrderBook) Imbalance(levels int) float64 {
+	var bids, asks float64
+	for i, l := range ob.Bids {
+		if levels > 0 && i >= levels {
+			break
+		}
+		bids += l.Size
+	}
+	for i, l := range ob.Asks {
+		if levels > 0 && i >= levels {
+			break
+		}
+		asks += l.Size
+	}
+	if bids+asks == 0 {
+		return 0
+	}
+	return (bids - asks) / (bids + asks)
+}
+
+func cumulative(levels []BookLevel) []BookLevel {
+	out := make([]BookLevel, len(levels))
+	var size float64
+	var orders int
+	for i, l := range levels {
+		size += l.Size
+		orders += l.Orders
+		out[i] = BookLevel{Price: l.Price, Size: size, Orders: orders}
+	}
+	return out
+}
+
+// CumulativeBids returns the bid levels with the size available at that
+// price or better.
+func (ob *OrderBook) CumulativeBids() []BookLevel {
+	return cumulative(ob.Bids)
+}
+
+func (ob *OrderBook) CumulativeAsks() []BookLevel {
+	return cumulative(ob.Asks)
+}
+
+// FillPrice walks the book for a market order of amount on the given side
+// ("Buy" takes the offers) and returns the average price. It fails when
+// the visible depth is not enough.
+func (ob *OrderBook) FillPrice(buysell string, amount float64) (float64, error) {
+	levels := ob.Bids
+	if buysell == "Buy" {
+		levels = ob.Asks
+	}
+	remaining, cost := amount, 0.0
+	for _, l := range levels {
+		if remaining <= 0 {
+			break
+		}
+		take := math.Min(remaining, l.Size)
+		cost += take * l.Price
+		remaining -= take
+	}
+	if remaining > 0 {
+		return 0, errors.New(fmt.Sprintf("Book depth of Uic %d is short by %g", ob.Uic, remaining))
+	}
+	return cost / amount, nil
+}
+
+// OrderBook fetches a depth snapshot for one instrument.
+func (api *SaxoAPI) OrderBook(uic int, assetType string) (*OrderBook, error) {
+	books, err := api.OrderBooks([]int{uic}, assetType)
+	if err != nil {
+		return nil, err
+	}
+	if len(books) == 0 {
+		return nil, errors.New(fmt.Sprintf("No price returned for Uic %d", uic))
+	}
+	return books[0], nil
+}
+
+func (api *SaxoAPI) OrderBooks(uics []int, assetType string) ([]*OrderBook, error) {
+	prices, err := api.PriceList(uics, assetType, []string{FieldGroupQuote, FieldGroupMarketDepth})
+	if err != nil {
+		return nil, err
+	}
+	books := make([]*OrderBook, len(prices))
+	for i, p := range prices {
+		books[i] = NewOrderBook(p)
+	}
+	return books, nil
+}
+
+// SubscribeOrderBooks streams market depth. The returned state follows the
+// subscription; CurrentOrderBook reads the book of a Uic from it. The
+// changes channel carries every merged update and is closed when the
+// subscription ends; changes not read in time are dropped and reported to
+// s.Errors.
+func (s *Streamer) SubscribeOrderBooks(uics []int, assetType string, refreshRate int) (*Subscription[SaxoPrice], *StreamState[SaxoPrice], <-chan StateChange[SaxoPrice], error) {
+	sub, err := s.SubscribePrices(uics, assetType, []string{FieldGroupQuote, FieldGroupMarketDepth}, refreshRate)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	state := NewPriceState()
+	changes := state.Follow(sub, s.Errors)
+	return sub, state, changes, nil
+}
+
+func CurrentOrderBook(state *StreamState[SaxoPrice], uic int) (*OrderBook, bool) {
+	p, ok := state.Get(strconv.Itoa(uic))
+	if !ok {
+		return nil, false
+	}
+	return NewOrderBook(p), true
+}
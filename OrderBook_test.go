@@ -0,0 +1,170 @@
+package saxotrader
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func testBook() *OrderBook {
+	return &OrderBook{
+		Uic:  21,
+		Bids: []BookLevel{{Price: 99, Size: 100}, {Price: 98, Size: 200}, {Price: 97, Size: 300}},
+		Asks: []BookLevel{{Price: 101, Size: 50}, {Price: 102, Size: 150}, {Price: 104, Size: 100}},
+	}
+}
+
+func TestOrderBookFillPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		buysell string
+		amount  float64
+		want    float64
+		wantErr bool
+	}{
+		{"buy inside the best offer", "Buy", 20, 101, false},
+		{"buy the whole best offer", "Buy", 50, 101, false},
+		{"buy across two levels", "Buy", 100, (50*101 + 50*102) / 100.0, false},
+		{"buy the whole book", "Buy", 300, (50*101 + 150*102 + 100*104) / 300.0, false},
+		{"buy more than the book", "Buy", 301, 0, true},
+		{"sell across three levels", "Sell", 400, (100*99 + 200*98 + 100*97) / 400.0, false},
+		{"sell more than the book", "Sell", 700, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testBook().FillPrice(tt.buysell, tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderBookMeasures(t *testing.T) {
+	book := testBook()
+	if got := book.Spread(); got != 2 {
+		t.Errorf("Spread = %g, want 2", got)
+	}
+	if got := book.Mid(); got != 100 {
+		t.Errorf("Mid = %g, want 100", got)
+	}
+	if got := book.SpreadBps(); got != 200 {
+		t.Errorf("SpreadBps = %g, want 200", got)
+	}
+	if got := book.Imbalance(1); math.Abs(got-50.0/150) > 1e-12 {
+		t.Errorf("Imbalance(1) = %g, want %g", got, 50.0/150)
+	}
+	if got := book.Imbalance(0); math.Abs(got-(600.0-300)/900) > 1e-12 {
+		t.Errorf("Imbalance(0) = %g, want %g", got, 300.0/900)
+	}
+	cum := book.CumulativeAsks()
+	if cum[2].Size != 300 || cum[2].Price != 104 {
+		t.Errorf("CumulativeAsks last level = %+v, want size 300 at 104", cum[2])
+	}
+	oneSided := &OrderBook{Bids: book.Bids}
+	if !math.IsNaN(oneSided.Spread()) {
+		t.Error("one sided book has a spread")
+	}
+}
+
+func TestNewOrderBook(t *testing.T) {
+	tests := []struct {
+		name string
+		p    SaxoPrice
+		bids []BookLevel
+		asks []BookLevel
+	}{
+		{
+			name: "depth",
+			p: SaxoPrice{MarketDepth: SaxoMarketDepth{
+				Bid: []float64{10, 9.9, 9.8}, BidSize: []float64{1, 2, 3}, BidOrders: []int{1, 1, 2}, NoOfBids: 2,
+				Ask: []float64{10.1, 0, 10.3}, AskSize: []float64{4, 0, 6}, NoOfOffers: 3,
+			}},
+			bids: []BookLevel{{Price: 10, Size: 1, Orders: 1}, {Price: 9.9, Size: 2, Orders: 1}},
+			asks: []BookLevel{{Price: 10.1, Size: 4}, {Price: 10.3, Size: 6}},
+		},
+		{
+			name: "top of book only",
+			p:    SaxoPrice{Quote: SaxoQuote{BidPrice: 10, BidSize: 5, AskPrice: 10.1, AskSize: 7}},
+			bids: []BookLevel{{Price: 10, Size: 5}},
+			asks: []BookLevel{{Price: 10.1, Size: 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := NewOrderBook(tt.p)
+			if !sameLevels(book.Bids, tt.bids) {
+				t.Errorf("bids = %+v, want %+v", book.Bids, tt.bids)
+			}
+			if !sameLevels(book.Asks, tt.asks) {
+				t.Errorf("asks = %+v, want %+v", book.Asks, tt.asks)
+			}
+		})
+	}
+}
+
+func sameLevels(got, want []BookLevel) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSubscribeOrderBooks(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("POST trade/v1/infoprices/subscriptions", `{"ReferenceId":"ref1","Snapshot":{"Data":[
+		{"Uic":21,"AssetType":"Stock","MarketDepth":{"Bid":[99,98],"BidSize":[100,200],"Ask":[101,102],"AskSize":[50,150],"NoOfBids":2,"NoOfOffers":2}}]}}`)
+	fake.reply("DELETE trade/v1/infoprices/subscriptions/ctx/ref1", ``)
+	s := NewStreamer(api)
+	s.ContextId = "ctx"
+	sub, state, changes, err := s.SubscribeOrderBooks([]int{21}, "Stock", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() StateChange[SaxoPrice] {
+		select {
+		case c, ok := <-changes:
+			if !ok {
+				t.Fatal("changes closed early")
+			}
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatal("no book change")
+		}
+		return StateChange[SaxoPrice]{}
+	}
+	bestBid := func(p SaxoPrice) float64 {
+		level, _ := NewOrderBook(p).BestBid()
+		return level.Price
+	}
+	if c := next(); c.Key != "21" || bestBid(c.Value) != 99 {
+		t.Errorf("snapshot change = %+v", c)
+	}
+	if err := sub.deliver(StreamMessage{ReferenceId: "ref1", Payload: []byte(`[{"Uic":21,"MarketDepth":{"Bid":[99.5,99],"BidSize":[10,100]}}]`)}); err != nil {
+		t.Fatal(err)
+	}
+	if c := next(); bestBid(c.Value) != 99.5 {
+		t.Errorf("delta change = %+v", c)
+	}
+	book, ok := CurrentOrderBook(state, 21)
+	if !ok {
+		t.Fatal("no current book for Uic 21")
+	}
+	bid, _ := book.BestBid()
+	if ask, _ := book.BestAsk(); bid.Price != 99.5 || ask.Price != 101 {
+		t.Errorf("CurrentOrderBook = %+v", book)
+	}
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	for range changes {
+	}
+}
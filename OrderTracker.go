@@ -0,0 +1,425 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type OrderEventType string
+
+const (
+	OrderEventPlaced        OrderEventType = "Placed"
+	OrderEventChanged       OrderEventType = "Changed"
+	OrderEventPartialFill   OrderEventType = "PartialFill"
+	OrderEventFilled        OrderEventType = "Filled"
+	OrderEventCancelled     OrderEventType = "Cancelled"
+	OrderEventExpired       OrderEventType = "Expired"
+	OrderEventRejected      OrderEventType = "Rejected"
+	OrderEventUnknownFinish OrderEventType = "Unknown"
+)
+
+// OrderEvent describes a single change in the lifecycle of a tracked order.
+type OrderEvent struct {
+	Type         OrderEventType
+	OrderId      string
+	Uic          int
+	AssetType    string
+	BuySell      string
+	Amount       float64
+	FilledAmount float64
+	AveragePrice float64
+	Status       string
+	Final        bool
+	Time         time.Time
+}
+
+type TrackedOrder struct {
+	Order        SaxoOrder
+	FilledAmount float64
+	AveragePrice float64
+	Status       string
+	Final        bool
+	LastEvent    OrderEventType
+	Updated      time.Time
+}
+
+// OrderTracker follows placed orders by polling the order list and the
+// order activity log, and reports lifecycle changes as OrderEvents.
+// The api is used from the tracker's own goroutine once Start is called,
+// so it should not be shared with other callers at the same time.
+// Events drops its oldest event when the reader falls behind; OnEvent is
+// called with every event.
+type OrderTracker struct {
+	Events  chan OrderEvent
+	Errors  chan error
+	OnEvent func(OrderEvent)
+
+	api     *SaxoAPI
+	orders  map[string]*TrackedOrder
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func NewOrderTracker(api *SaxoAPI) *OrderTracker {
+	return &OrderTracker{
+		api:    api,
+		Events: make(chan OrderEvent, 100),
+		Errors: make(chan error, 10),
+		orders: make(map[string]*TrackedOrder),
+	}
+}
+
+func (t *OrderTracker) Track(orders ...SaxoOrder) {
+	var evs []OrderEvent
+	t.mu.Lock()
+	defer func() {
+		t.mu.Unlock()
+		t.dispatch(evs)
+	}()
+	for _, o := range orders {
+		if o.OrderId == "" {
+			continue
+		}
+		if _, ok := t.orders[o.OrderId]; ok {
+			continue
+		}
+		t.orders[o.OrderId] = &TrackedOrder{Order: o, Status: o.Status, FilledAmount: o.FilledAmount, Updated: time.Now()}
+		evs = append(evs, t.event(OrderEventPlaced, t.orders[o.OrderId]))
+	}
+}
+
+func (t *OrderTracker) TrackId(orderId string) {
+	t.Track(SaxoOrder{OrderId: orderId})
+}
+
+func (t *OrderTracker) Untrack(orderId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.orders, orderId)
+}
+
+func (t *OrderTracker) Order(orderId string) (TrackedOrder, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	o, ok := t.orders[orderId]
+	if !ok {
+		return TrackedOrder{}, false
+	}
+	return *o, true
+}
+
+func (t *OrderTracker) Open() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var ids []string
+	for id, o := range t.orders {
+		if !o.Final {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Update applies a fresh view of a working order, e.g. from the order list
+// or from a streaming subscription. When more has been filled, the order
+// activity log is fetched for the average fill price.
+func (t *OrderTracker) Update(order SaxoOrder) {
+	t.mu.Lock()
+	o, ok := t.orders[order.OrderId]
+	filling := ok && !o.Final && order.FilledAmount > o.FilledAmount
+	t.mu.Unlock()
+	var activities []SaxoOrderActivity
+	if filling && t.api != nil {
+		var err error
+		activities, err = t.api.OrderActivities(order.OrderId)
+		if err != nil {
+			t.reportError(err)
+		}
+	}
+
+	var evs []OrderEvent
+	t.mu.Lock()
+	defer func() {
+		t.mu.Unlock()
+		t.dispatch(evs)
+	}()
+	o, ok = t.orders[order.OrderId]
+	if !ok || o.Final {
+		return
+	}
+	filled := order.FilledAmount
+	changed := o.Order.Amount != 0 && (order.Amount != o.Order.Amount || order.Price != o.Order.Price)
+	o.Order = order
+	o.Status = order.Status
+	o.Updated = time.Now()
+	if filled > o.FilledAmount {
+		o.FilledAmount = filled
+		o.applyPrices(activities)
+		evs = append(evs, t.event(OrderEventPartialFill, o))
+	} else if changed {
+		evs = append(evs, t.event(OrderEventChanged, o))
+	}
+}
+
+// applyPrices takes the latest average fill price from the activity log.
+func (o *TrackedOrder) applyPrices(activities []SaxoOrderActivity) {
+	for _, a := range activities {
+		if a.AveragePrice != 0 {
+			o.AveragePrice = a.AveragePrice
+		} else if a.ExecutionPrice != 0 && o.AveragePrice == 0 {
+			o.AveragePrice = a.ExecutionPrice
+		}
+	}
+}
+
+// Finish applies the order activity log of an order which has left the
+// order list and emits its final event.
+func (t *OrderTracker) Finish(orderId string, activities []SaxoOrderActivity) {
+	var evs []OrderEvent
+	t.mu.Lock()
+	defer func() {
+		t.mu.Unlock()
+		t.dispatch(evs)
+	}()
+	o, ok := t.orders[orderId]
+	if !ok || o.Final {
+		return
+	}
+	evType := OrderEventUnknownFinish
+	o.applyPrices(activities)
+	for _, a := range activities {
+		if a.FilledAmount > o.FilledAmount {
+			o.FilledAmount = a.FilledAmount
+		}
+		if a.Amount != 0 && o.Order.Amount == 0 {
+			o.Order.Amount = a.Amount
+		}
+		if o.Order.Uic == 0 {
+			o.Order.Uic = a.Uic
+			o.Order.AssetType = a.AssetType
+			o.Order.BuySell = a.BuySell
+		}
+		o.Status = a.Status
+		switch a.Status {
+		case "FinalFill":
+			evType = OrderEventFilled
+		case "Cancelled":
+			evType = OrderEventCancelled
+		case "Expired":
+			evType = OrderEventExpired
+		case "Rejected":
+			evType = OrderEventRejected
+		}
+	}
+	if evType == OrderEventUnknownFinish && o.Order.Amount > 0 && o.FilledAmount >= o.Order.Amount {
+		evType = OrderEventFilled
+	}
+	o.Final = true
+	o.Updated = time.Now()
+	evs = append(evs, t.event(evType, o))
+}
+
+// FollowStream drives the tracker from an order subscription instead of
+// Poll. Orders leaving the stream are finished from the order activity log,
+// which is fetched with the tracker's api. Changes are queued without limit
+// and handled on a goroutine of their own, so no delete is lost to a slow
+// activity fetch and the stream is never held up by one.
+func (t *OrderTracker) FollowStream(sub *Subscription[SaxoOrder]) {
+	var mu sync.Mutex
+	var queue []StateChange[SaxoOrder]
+	wake := make(chan struct{}, 1)
+	state := NewOrderState()
+	state.OnChange = func(c StateChange[SaxoOrder]) {
+		mu.Lock()
+		queue = append(queue, c)
+		mu.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	// with OnChange set nothing is sent on changes, it is only closed
+	// once the subscription ends
+	changes := state.Follow(sub, t.Errors)
+	go func() {
+		ended := false
+		for {
+			mu.Lock()
+			batch := queue
+			queue = nil
+			mu.Unlock()
+			for _, c := range batch {
+				t.applyChange(c)
+			}
+			if ended && len(batch) == 0 {
+				return
+			}
+			select {
+			case <-wake:
+			case _, ok := <-changes:
+				ended = ended || !ok
+			}
+		}
+	}()
+}
+
+func (t *OrderTracker) applyChange(c StateChange[SaxoOrder]) {
+	if !c.Deleted {
+		t.Update(c.Value)
+		return
+	}
+	if _, ok := t.Order(c.Key); !ok {
+		return
+	}
+	activities, err := t.api.OrderActivities(c.Key)
+	if err != nil {
+		t.reportError(err)
+		return
+	}
+	if len(activities) == 0 {
+		return
+	}
+	t.Finish(c.Key, activities)
+}
+
+// Poll refreshes every open tracked order once.
+func (t *OrderTracker) Poll() error {
+	open := t.Open()
+	if len(open) == 0 {
+		return nil
+	}
+	list, err := t.api.OrderList()
+	if err != nil {
+		return err
+	}
+	working := make(map[string]SaxoOrder)
+	for _, o := range list {
+		working[o.OrderId] = o
+	}
+	var errs []string
+	for _, id := range open {
+		if o, ok := working[id]; ok {
+			t.Update(o)
+			continue
+		}
+		activities, err := t.api.OrderActivities(id)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", id, err.Error()))
+			continue
+		}
+		if len(activities) == 0 {
+			continue
+		}
+		t.Finish(id, activities)
+	}
+	if len(errs) > 0 {
+		return errors.New(fmt.Sprintf("Error polling orders: %v", errs))
+	}
+	return nil
+}
+
+// Start polls in the background until Stop is called. Poll errors are
+// sent to Errors and retried on the next tick.
+func (t *OrderTracker) Start(interval time.Duration) {
+	t.mu.Lock()
+	if t.stop != nil {
+		t.mu.Unlock()
+		return
+	}
+	t.stop = make(chan struct{})
+	t.stopped = make(chan struct{})
+	stop, stopped := t.stop, t.stopped
+	t.mu.Unlock()
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := t.Poll(); err != nil {
+					t.reportError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (t *OrderTracker) Stop() {
+	t.mu.Lock()
+	stop, stopped := t.stop, t.stopped
+	t.stop, t.stopped = nil, nil
+	t.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+// event must be called with t.mu held. The event is passed to dispatch
+// once the lock is released.
+func (t *OrderTracker) event(evType OrderEventType, o *TrackedOrder) OrderEvent {
+	o.LastEvent = evType
+	return OrderEvent{
+		Type:         evType,
+		OrderId:      o.Order.OrderId,
+		Uic:          o.Order.Uic,
+		AssetType:    o.Order.AssetType,
+		BuySell:      o.Order.BuySell,
+		Amount:       o.Order.Amount,
+		FilledAmount: o.FilledAmount,
+		AveragePrice: o.AveragePrice,
+		Status:       o.Status,
+		Final:        o.Final,
+		Time:         o.Updated,
+	}
+}
+
+// dispatch journals and delivers events. It must be called without t.mu
+// held, so OnEvent may call back into the tracker.
+func (t *OrderTracker) dispatch(evs []OrderEvent) {
+	for _, ev := range evs {
+		if t.api != nil && t.api.Journal != nil {
+			if err := t.api.Journal.RecordEvent(ev); err != nil {
+				t.reportError(err)
+			}
+		}
+		if t.OnEvent != nil {
+			t.OnEvent(ev)
+		}
+		if t.Events != nil {
+			t.send(ev)
+		}
+	}
+}
+
+// send delivers ev without blocking, dropping the oldest event when Events
+// is full. It retries until ev is queued, as another dispatch may take the
+// freed slot first.
+func (t *OrderTracker) send(ev OrderEvent) {
+	for {
+		select {
+		case t.Events <- ev:
+			return
+		default:
+		}
+		select {
+		case <-t.Events:
+		default:
+		}
+	}
+}
+
+func (t *OrderTracker) reportError(err error) {
+	select {
+	case t.Errors <- err:
+	default:
+	}
+}
@@ -0,0 +1,275 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordEvents collects every event the tracker emits.
+func recordEvents(tr *OrderTracker) func() []OrderEvent {
+	var mu sync.Mutex
+	var evs []OrderEvent
+	tr.OnEvent = func(ev OrderEvent) {
+		mu.Lock()
+		evs = append(evs, ev)
+		mu.Unlock()
+	}
+	return func() []OrderEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]OrderEvent(nil), evs...)
+	}
+}
+
+// serveActivities answers order activity requests from the given log.
+func serveActivities(fake *fakeSaxo, log map[string][]SaxoOrderActivity) {
+	var mu sync.Mutex
+	fake.handle("GET cs/v1/audit/orderactivities", func(r fakeRequest) (int, string) {
+		mu.Lock()
+		defer mu.Unlock()
+		ba, _ := json.Marshal(SaxoData[SaxoOrderActivity]{Data: log[r.Query.Get("OrderId")]})
+		return http.StatusOK, string(ba)
+	})
+}
+
+func TestOrderTrackerFills(t *testing.T) {
+	order := SaxoOrder{OrderId: "1", Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 100, Price: 10}
+	withFill := func(filled, price float64) SaxoOrder {
+		o := order
+		o.FilledAmount, o.Price = filled, price
+		return o
+	}
+	tests := []struct {
+		name       string
+		updates    []SaxoOrder
+		activities [][]SaxoOrderActivity
+		want       []OrderEventType
+		filled     float64
+		average    float64
+	}{
+		{
+			name:    "no change",
+			updates: []SaxoOrder{withFill(0, 10)},
+			want:    []OrderEventType{OrderEventPlaced},
+		},
+		{
+			name:    "price change",
+			updates: []SaxoOrder{withFill(0, 10.5)},
+			want:    []OrderEventType{OrderEventPlaced, OrderEventChanged},
+		},
+		{
+			name:    "partial fills aggregate",
+			updates: []SaxoOrder{withFill(40, 10), withFill(40, 10), withFill(100, 10)},
+			activities: [][]SaxoOrderActivity{
+				{{FilledAmount: 40, AveragePrice: 10}},
+				nil,
+				{{FilledAmount: 40, AveragePrice: 10}, {FilledAmount: 100, AveragePrice: 10.3}},
+			},
+			want:    []OrderEventType{OrderEventPlaced, OrderEventPartialFill, OrderEventPartialFill},
+			filled:  100,
+			average: 10.3,
+		},
+		{
+			name:       "execution price without an average",
+			updates:    []SaxoOrder{withFill(30, 10)},
+			activities: [][]SaxoOrderActivity{{{FilledAmount: 30, ExecutionPrice: 9.9}}},
+			want:       []OrderEventType{OrderEventPlaced, OrderEventPartialFill},
+			filled:     30,
+			average:    9.9,
+		},
+		{
+			name:    "fills never go back",
+			updates: []SaxoOrder{withFill(60, 10), withFill(50, 10)},
+			activities: [][]SaxoOrderActivity{
+				{{FilledAmount: 60, AveragePrice: 10}},
+			},
+			want:    []OrderEventType{OrderEventPlaced, OrderEventPartialFill},
+			filled:  60,
+			average: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, fake := newFakeSaxo(t)
+			log := make(map[string][]SaxoOrderActivity)
+			serveActivities(fake, log)
+			tr := NewOrderTracker(api)
+			events := recordEvents(tr)
+			tr.Track(order)
+			for i, u := range tt.updates {
+				if i < len(tt.activities) {
+					log["1"] = tt.activities[i]
+				}
+				tr.Update(u)
+			}
+			var got []OrderEventType
+			for _, ev := range events() {
+				got = append(got, ev.Type)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("events %v, want %v", got, tt.want)
+			}
+			o, _ := tr.Order("1")
+			if o.FilledAmount != tt.filled || o.AveragePrice != tt.average {
+				t.Errorf("filled %g at %g, want %g at %g", o.FilledAmount, o.AveragePrice, tt.filled, tt.average)
+			}
+			if evs := events(); len(evs) > 1 {
+				last := evs[len(evs)-1]
+				if last.FilledAmount != o.FilledAmount || last.AveragePrice != o.AveragePrice {
+					t.Errorf("last event %+v does not match the order", last)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderTrackerFinish(t *testing.T) {
+	tests := []struct {
+		name       string
+		order      SaxoOrder
+		activities []SaxoOrderActivity
+		want       OrderEventType
+		filled     float64
+		average    float64
+	}{
+		{
+			name:       "final fill",
+			order:      SaxoOrder{OrderId: "1", Amount: 100},
+			activities: []SaxoOrderActivity{{Status: "Working"}, {Status: "FinalFill", FilledAmount: 100, AveragePrice: 12.5}},
+			want:       OrderEventFilled,
+			filled:     100,
+			average:    12.5,
+		},
+		{
+			name:       "cancelled after a partial fill",
+			order:      SaxoOrder{OrderId: "1", Amount: 100},
+			activities: []SaxoOrderActivity{{Status: "Fill", FilledAmount: 20, AveragePrice: 12}, {Status: "Cancelled", FilledAmount: 20}},
+			want:       OrderEventCancelled,
+			filled:     20,
+			average:    12,
+		},
+		{
+			name:       "expired",
+			order:      SaxoOrder{OrderId: "1", Amount: 100},
+			activities: []SaxoOrderActivity{{Status: "Expired"}},
+			want:       OrderEventExpired,
+		},
+		{
+			name:       "rejected",
+			order:      SaxoOrder{OrderId: "1", Amount: 100},
+			activities: []SaxoOrderActivity{{Status: "Rejected"}},
+			want:       OrderEventRejected,
+		},
+		{
+			name:       "fully filled without a final status",
+			order:      SaxoOrder{OrderId: "1"},
+			activities: []SaxoOrderActivity{{Status: "Fill", Amount: 50, FilledAmount: 50, ExecutionPrice: 3, Uic: 21, BuySell: "Sell"}},
+			want:       OrderEventFilled,
+			filled:     50,
+			average:    3,
+		},
+		{
+			name:       "unknown",
+			order:      SaxoOrder{OrderId: "1", Amount: 100},
+			activities: []SaxoOrderActivity{{Status: "Working"}},
+			want:       OrderEventUnknownFinish,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewOrderTracker(nil)
+			events := recordEvents(tr)
+			tr.Track(tt.order)
+			tr.Finish("1", tt.activities)
+			// a final order ignores anything after it
+			tr.Finish("1", []SaxoOrderActivity{{Status: "FinalFill", FilledAmount: 1000}})
+			tr.Update(SaxoOrder{OrderId: "1", Amount: 100, FilledAmount: 1000})
+			evs := events()
+			if len(evs) != 2 {
+				t.Fatalf("got %d events, want Placed and one final event", len(evs))
+			}
+			ev := evs[1]
+			if ev.Type != tt.want || !ev.Final || ev.FilledAmount != tt.filled || ev.AveragePrice != tt.average {
+				t.Errorf("final event %+v, want %s with %g at %g", ev, tt.want, tt.filled, tt.average)
+			}
+			if open := tr.Open(); len(open) != 0 {
+				t.Errorf("orders still open: %v", open)
+			}
+		})
+	}
+}
+
+func TestOrderTrackerStreamLosesNoDeletes(t *testing.T) {
+	// more orders than the state's change buffer holds, all finishing at
+	// once while each finish waits on an activity fetch
+	const n = 1500
+	api, fake := newFakeSaxo(t)
+	log := make(map[string][]SaxoOrderActivity)
+	var working []string
+	var deleted []string
+	tr := NewOrderTracker(api)
+	events := recordEvents(tr)
+	for i := 1; i <= n; i++ {
+		id := fmt.Sprint(i)
+		log[id] = []SaxoOrderActivity{{Status: "FinalFill", Amount: 1, FilledAmount: 1, AveragePrice: 2}}
+		working = append(working, fmt.Sprintf(`{"OrderId":"%s","Amount":1}`, id))
+		deleted = append(deleted, fmt.Sprintf(`{"OrderId":"%s","__meta_deleted":true}`, id))
+		tr.TrackId(id)
+	}
+	serveActivities(fake, log)
+	sub := &Subscription[SaxoOrder]{Updates: make(chan StreamUpdate[SaxoOrder], 2)}
+	tr.FollowStream(sub)
+	sub.Updates <- StreamUpdate[SaxoOrder]{Snapshot: true, Raw: []byte("[" + strings.Join(working, ",") + "]")}
+	sub.Updates <- StreamUpdate[SaxoOrder]{Raw: []byte("[" + strings.Join(deleted, ",") + "]")}
+	close(sub.Updates)
+
+	deadline := time.Now().Add(20 * time.Second)
+	for len(tr.Open()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if open := tr.Open(); len(open) != 0 {
+		t.Fatalf("%d orders never finished", len(open))
+	}
+	filled := 0
+	for _, ev := range events() {
+		if ev.Type == OrderEventFilled {
+			filled++
+		}
+	}
+	if filled != n {
+		t.Errorf("%d Filled events, want %d", filled, n)
+	}
+}
+
+func TestOrderTrackerEventsDoNotBlock(t *testing.T) {
+	tr := NewOrderTracker(nil)
+	tr.Events = make(chan OrderEvent, 1)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				tr.TrackId(fmt.Sprintf("%d-%d", g, i))
+			}
+		}(g)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("dispatch blocked on a full Events channel")
+	}
+	if len(tr.Events) != 1 {
+		t.Errorf("Events holds %d events, want the newest one", len(tr.Events))
+	}
+}
@@ -0,0 +1,416 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PaperBook is a local simulated order book. When set as SaxoAPI.Paper,
+// order placement, cancellation, order listing, net positions and balance
+// are served from the book instead of Saxo, and quotes fetched through
+// Prices drive the fills.
+type PaperBook struct {
+	AccountKey string
+	Currency   string
+
+	mu         sync.Mutex
+	cash       float64
+	realized   float64
+	nextId     int
+	orders     map[string]*SaxoOrder
+	activities map[string][]SaxoOrderActivity
+	positions  map[string]*paperPosition
+	quotes     map[string]SaxoQuote
+	// liquidity already taken from the displayed size of the latest quote
+	taken map[string]paperLiquidity
+}
+
+type paperLiquidity struct {
+	Bid float64
+	Ask float64
+}
+
+type paperPosition struct {
+	Uic          int
+	AssetType    string
+	Amount       float64
+	AveragePrice float64
+	Realized     float64
+	Fills        int
+	Opened       time.Time
+}
+
+func NewPaperBook(currency string, cash float64) *PaperBook {
+	return &PaperBook{
+		AccountKey: "PAPER",
+		Currency:   currency,
+		cash:       cash,
+		nextId:     1,
+		orders:     make(map[string]*SaxoOrder),
+		activities: make(map[string][]SaxoOrderActivity),
+		positions:  make(map[string]*paperPosition),
+		quotes:     make(map[string]SaxoQuote),
+		taken:      make(map[string]paperLiquidity),
+	}
+}
+
+func (pb *PaperBook) PlaceOrder(instr SaxoOrderInstruction) ([]SaxoOrder, error) {
+	if instr.Amount <= 0 {
+		return nil, errors.New("Order amount must be positive")
+	}
+	if instr.BuySell != "Buy" && instr.BuySell != "Sell" {
+		return nil, errors.New(fmt.Sprintf("Invalid BuySell %s", instr.BuySell))
+	}
+	switch instr.OrderType {
+	case "Market":
+	case "Limit", "Stop":
+		if instr.OrderPrice <= 0 {
+			return nil, errors.New(fmt.Sprintf("%s order needs a price", instr.OrderType))
+		}
+	default:
+		return nil, errors.New(fmt.Sprintf("Order type %s not supported in paper trading", instr.OrderType))
+	}
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	id := strconv.Itoa(pb.nextId)
+	pb.nextId++
+	accountKey := instr.AccountKey
+	if accountKey == "" {
+		accountKey = pb.AccountKey
+	}
+	order := &SaxoOrder{
+		OrderId:       id,
+		AccountKey:    accountKey,
+		Amount:        instr.Amount,
+		AssetType:     instr.AssetType,
+		BuySell:       instr.BuySell,
+		OpenOrderType: instr.OrderType,
+		Price:         instr.OrderPrice,
+		OrderTime:     time.Now().UTC().Format(time.RFC3339),
+		Status:        "Working",
+		Uic:           instr.Uic,
+	}
+	order.Duration.DurationType = instr.OrderDuration.DurationType
+	pb.orders[id] = order
+	pb.logActivity(order, "Placed", 0)
+	if q, ok := pb.quotes[instrumentKey(order.Uic, order.AssetType)]; ok {
+		pb.match(order, q)
+	}
+	return []SaxoOrder{*order}, nil
+}
+
+func (pb *PaperBook) CancelOrder(orderId string) error {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	order, ok := pb.orders[orderId]
+	if !ok {
+		return errors.New(fmt.Sprintf("No working paper order %s", orderId))
+	}
+	delete(pb.orders, orderId)
+	order.Status = "Cancelled"
+	pb.logActivity(order, "Cancelled", 0)
+	return nil
+}
+
+func (pb *PaperBook) OrderList() []SaxoOrder {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	orders := make([]SaxoOrder, 0, len(pb.orders))
+	for _, o := range pb.orders {
+		orders = append(orders, *o)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		a, _ := strconv.Atoi(orders[i].OrderId)
+		b, _ := strconv.Atoi(orders[j].OrderId)
+		return a < b
+	})
+	return orders
+}
+
+func (pb *PaperBook) OrderDetails(orderId string) (*SaxoOrder, error) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	order, ok := pb.orders[orderId]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("No working paper order %s", orderId))
+	}
+	o := *order
+	return &o, nil
+}
+
+func (pb *PaperBook) OrderActivities(orderId string) []SaxoOrderActivity {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	return append([]SaxoOrderActivity(nil), pb.activities[orderId]...)
+}
+
+// UpdatePrice records the latest quote for an instrument and fills any
+// working orders the quote crosses.
+func (pb *PaperBook) UpdatePrice(price SaxoPrice) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	key := instrumentKey(price.Uic, price.AssetType)
+	pb.quotes[key] = price.Quote
+	delete(pb.taken, key)
+	for _, o := range pb.ordersFor(price.Uic, price.AssetType) {
+		pb.match(o, price.Quote)
+	}
+}
+
+// ordersFor must be called with pb.mu held
+func (pb *PaperBook) ordersFor(uic int, assetType string) []*SaxoOrder {
+	var orders []*SaxoOrder
+	for _, o := range pb.orders {
+		if o.Uic == uic && o.AssetType == assetType {
+			orders = append(orders, o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		a, _ := strconv.Atoi(orders[i].OrderId)
+		b, _ := strconv.Atoi(orders[j].OrderId)
+		return a < b
+	})
+	return orders
+}
+
+func (pb *PaperBook) NetPositions() []SaxoNetPosition {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	var keys []string
+	for k, p := range pb.positions {
+		if p.Amount != 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	netpositions := make([]SaxoNetPosition, 0, len(keys))
+	for _, k := range keys {
+		p := pb.positions[k]
+		current := pb.markPrice(k, p)
+		var np SaxoNetPosition
+		np.NetPositionId = k
+		np.DisplayAndFormat.Currency = pb.Currency
+		np.NetPositionBase.AccountKey = pb.AccountKey
+		np.NetPositionBase.Amount = p.Amount
+		np.NetPositionBase.AssetType = p.AssetType
+		np.NetPositionBase.CanBeClosed = true
+		np.NetPositionBase.IsMarketOpen = true
+		np.NetPositionBase.Uic = p.Uic
+		np.NetPositionBase.OpeningDirection = "Buy"
+		if p.Amount < 0 {
+			np.NetPositionBase.OpeningDirection = "Sell"
+		}
+		np.NetPositionBase.SinglePositionStatus = "Open"
+		np.NetPositionView.AverageOpenPrice = p.AveragePrice
+		np.NetPositionView.AverageOpenPriceIncludingCosts = p.AveragePrice
+		np.NetPositionView.CalculationReliability = "Ok"
+		np.NetPositionView.CurrentPrice = current
+		np.NetPositionView.CurrentPriceType = "Mid"
+		np.NetPositionView.Exposure = p.Amount * current
+		np.NetPositionView.ExposureCurrency = pb.Currency
+		np.NetPositionView.ExposureInBaseCurrency = p.Amount * current
+		np.NetPositionView.PositionCount = p.Fills
+		np.NetPositionView.ProfitLossOnTrade = p.Amount * (current - p.AveragePrice)
+		np.NetPositionView.Status = "Open"
+		netpositions = append(netpositions, np)
+	}
+	return netpositions
+}
+
+func (pb *PaperBook) Balance() SaxoBalance {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	var value, unrealized float64
+	count := 0
+	for k, p := range pb.positions {
+		if p.Amount == 0 {
+			continue
+		}
+		count++
+		current := pb.markPrice(k, p)
+		value += p.Amount * current
+		unrealized += p.Amount * (current - p.AveragePrice)
+	}
+	return SaxoBalance{
+		CalculationReliability:           "Ok",
+		CashAvailableForTrading:          pb.cash,
+		CashBalance:                      pb.cash,
+		Currency:                         pb.Currency,
+		CurrencyDecimals:                 2,
+		NetPositionsCount:                count,
+		OpenPositionsCount:               count,
+		OrdersCount:                      len(pb.orders),
+		TotalValue:                       pb.cash + value,
+		UnrealizedMarginClosedProfitLoss: pb.realized,
+		UnrealizedMarginOpenProfitLoss:   unrealized,
+		UnrealizedMarginProfitLoss:       unrealized,
+		UnrealizedPositionsValue:         value,
+	}
+}
+
+// RealizedProfitLoss is the profit or loss booked by closing fills.
+func (pb *PaperBook) RealizedProfitLoss() float64 {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	return pb.realized
+}
+
+// markPrice must be called with pb.mu held
+func (pb *PaperBook) markPrice(key string, p *paperPosition) float64 {
+	q, ok := pb.quotes[key]
+	if !ok {
+		return p.AveragePrice
+	}
+	if q.Mid != 0 {
+		return q.Mid
+	}
+	if q.AskPrice != 0 && q.BidPrice != 0 {
+		return (q.AskPrice + q.BidPrice) / 2
+	}
+	return p.AveragePrice
+}
+
+// match must be called with pb.mu held
+func (pb *PaperBook) match(o *SaxoOrder, q SaxoQuote) {
+	if q.MarketState == "Closed" {
+		return
+	}
+	var price float64
+	if o.BuySell == "Buy" {
+		if q.AskPrice <= 0 {
+			return
+		}
+		switch o.OpenOrderType {
+		case "Market":
+			price = q.AskPrice
+		case "Limit":
+			if q.AskPrice > o.Price {
+				return
+			}
+			price = q.AskPrice
+		case "Stop":
+			if q.AskPrice < o.Price {
+				return
+			}
+			price = q.AskPrice
+		}
+	} else {
+		if q.BidPrice <= 0 {
+			return
+		}
+		switch o.OpenOrderType {
+		case "Market":
+			price = q.BidPrice
+		case "Limit":
+			if q.BidPrice < o.Price {
+				return
+			}
+			price = q.BidPrice
+		case "Stop":
+			if q.BidPrice > o.Price {
+				return
+			}
+			price = q.BidPrice
+		}
+	}
+	if price == 0 {
+		return
+	}
+	key := instrumentKey(o.Uic, o.AssetType)
+	taken := pb.taken[key]
+	size, used := q.AskSize, &taken.Ask
+	if o.BuySell == "Sell" {
+		size, used = q.BidSize, &taken.Bid
+	}
+	fill := o.Amount - o.FilledAmount
+	// limit orders are capped by the displayed size left in this quote
+	// when there is one, so the same quote does not fill them twice
+	if o.OpenOrderType == "Limit" && size > 0 {
+		fill = math.Min(fill, size-*used)
+		if fill <= 0 {
+			return
+		}
+	}
+	*used += fill
+	pb.taken[key] = taken
+	pb.fill(o, fill, price)
+}
+
+// fill must be called with pb.mu held
+func (pb *PaperBook) fill(o *SaxoOrder, amount, price float64) {
+	signed := amount
+	if o.BuySell == "Sell" {
+		signed = -amount
+	}
+	key := instrumentKey(o.Uic, o.AssetType)
+	p, ok := pb.positions[key]
+	if !ok {
+		p = &paperPosition{Uic: o.Uic, AssetType: o.AssetType, Opened: time.Now()}
+		pb.positions[key] = p
+	}
+	if p.Amount == 0 || math.Signbit(p.Amount) == math.Signbit(signed) {
+		p.AveragePrice = (p.AveragePrice*math.Abs(p.Amount) + price*amount) / (math.Abs(p.Amount) + amount)
+		p.Amount += signed
+	} else {
+		closing := math.Min(math.Abs(p.Amount), amount)
+		pnl := closing * (price - p.AveragePrice)
+		if p.Amount < 0 {
+			pnl = -pnl
+		}
+		p.Realized += pnl
+		pb.realized += pnl
+		p.Amount += signed
+		if math.Abs(p.Amount) < 1e-12 {
+			p.Amount = 0
+			p.AveragePrice = 0
+		} else if math.Signbit(p.Amount) == math.Signbit(signed) {
+			// flipped through zero, the remainder opens at the fill price
+			p.AveragePrice = price
+		}
+	}
+	p.Fills++
+	pb.cash -= signed * price
+
+	prevFilled := o.FilledAmount
+	o.FilledAmount += amount
+	avg := (o.MarketPrice*prevFilled + price*amount) / o.FilledAmount
+	o.MarketPrice = avg
+	status := "Fill"
+	if o.FilledAmount >= o.Amount {
+		status = "FinalFill"
+		o.Status = "Filled"
+		delete(pb.orders, o.OrderId)
+	}
+	pb.logFill(o, status, price, avg)
+}
+
+// logActivity must be called with pb.mu held
+func (pb *PaperBook) logActivity(o *SaxoOrder, status string, price float64) {
+	pb.activities[o.OrderId] = append(pb.activities[o.OrderId], SaxoOrderActivity{
+		AccountKey:     o.AccountKey,
+		ActivityTime:   time.Now().UTC().Format(time.RFC3339Nano),
+		Amount:         o.Amount,
+		AssetType:      o.AssetType,
+		BuySell:        o.BuySell,
+		ExecutionPrice: price,
+		FilledAmount:   o.FilledAmount,
+		OrderId:        o.OrderId,
+		OrderType:      o.OpenOrderType,
+		Price:          o.Price,
+		Status:         status,
+		Uic:            o.Uic,
+	})
+}
+
+// logFill must be called with pb.mu held
+func (pb *PaperBook) logFill(o *SaxoOrder, status string, price, avg float64) {
+	pb.logActivity(o, status, price)
+	acts := pb.activities[o.OrderId]
+	acts[len(acts)-1].AveragePrice = avg
+}
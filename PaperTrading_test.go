@@ -0,0 +1,101 @@
+package saxotrader
+
+import (
+	"math"
+	"testing"
+)
+
+type paperTrade struct {
+	buysell string
+	amount  float64
+	price   float64
+}
+
+// tradeAt quotes the instrument at price and crosses it with a market order.
+func tradeAt(t *testing.T, pb *PaperBook, tr paperTrade) {
+	pb.UpdatePrice(SaxoPrice{Uic: 21, AssetType: "Stock", Quote: SaxoQuote{BidPrice: tr.price, AskPrice: tr.price, Mid: tr.price}})
+	orders, err := pb.PlaceOrder(SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: tr.buysell, Amount: tr.amount, OrderType: "Market"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acts := pb.OrderActivities(orders[0].OrderId); acts[len(acts)-1].Status != "FinalFill" {
+		t.Fatalf("%s %g at %g did not fill", tr.buysell, tr.amount, tr.price)
+	}
+}
+
+func TestPaperBookFills(t *testing.T) {
+	tests := []struct {
+		name     string
+		trades   []paperTrade
+		amount   float64
+		average  float64
+		realized float64
+	}{
+		{name: "average price", trades: []paperTrade{{"Buy", 10, 100}, {"Buy", 30, 120}}, amount: 40, average: 115},
+		{name: "partial close", trades: []paperTrade{{"Buy", 10, 100}, {"Sell", 4, 110}}, amount: 6, average: 100, realized: 40},
+		{name: "full close", trades: []paperTrade{{"Buy", 10, 100}, {"Sell", 10, 90}}, realized: -100},
+		{name: "short covered", trades: []paperTrade{{"Sell", 10, 100}, {"Buy", 10, 90}}, realized: 100},
+		{name: "flip long to short", trades: []paperTrade{{"Buy", 10, 100}, {"Sell", 15, 120}}, amount: -5, average: 120, realized: 200},
+		{name: "flip short to long", trades: []paperTrade{{"Sell", 10, 100}, {"Buy", 12, 105}}, amount: 2, average: 105, realized: -50},
+		{name: "adding to a short", trades: []paperTrade{{"Sell", 10, 100}, {"Sell", 10, 90}, {"Buy", 5, 80}}, amount: -15, average: 95, realized: 75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pb := NewPaperBook("EUR", 100000)
+			cash := 100000.0
+			for _, tr := range tt.trades {
+				tradeAt(t, pb, tr)
+				if tr.buysell == "Buy" {
+					cash -= tr.amount * tr.price
+				} else {
+					cash += tr.amount * tr.price
+				}
+			}
+			if got := pb.RealizedProfitLoss(); math.Abs(got-tt.realized) > 1e-9 {
+				t.Errorf("realized = %g, want %g", got, tt.realized)
+			}
+			if b := pb.Balance(); math.Abs(b.CashBalance-cash) > 1e-9 {
+				t.Errorf("cash = %g, want %g", b.CashBalance, cash)
+			}
+			positions := pb.NetPositions()
+			if tt.amount == 0 {
+				if len(positions) != 0 {
+					t.Errorf("closed position still listed: %+v", positions)
+				}
+				return
+			}
+			if len(positions) != 1 {
+				t.Fatalf("%d positions, want 1", len(positions))
+			}
+			np := positions[0]
+			if np.NetPositionBase.Amount != tt.amount || math.Abs(np.NetPositionView.AverageOpenPrice-tt.average) > 1e-9 {
+				t.Errorf("position %g at %g, want %g at %g", np.NetPositionBase.Amount, np.NetPositionView.AverageOpenPrice, tt.amount, tt.average)
+			}
+		})
+	}
+}
+
+func TestPaperBookLimitLiquidity(t *testing.T) {
+	pb := NewPaperBook("EUR", 100000)
+	quote := SaxoPrice{Uic: 21, AssetType: "Stock", Quote: SaxoQuote{BidPrice: 99, AskPrice: 100, AskSize: 5}}
+	pb.UpdatePrice(quote)
+	first, _ := pb.PlaceOrder(SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 8, OrderType: "Limit", OrderPrice: 101})
+	second, _ := pb.PlaceOrder(SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 3, OrderType: "Limit", OrderPrice: 101})
+	filled := func(id string) float64 {
+		acts := pb.OrderActivities(id)
+		return acts[len(acts)-1].FilledAmount
+	}
+	if filled(first[0].OrderId) != 5 || filled(second[0].OrderId) != 0 {
+		t.Fatalf("filled %g and %g from one quote of size 5, want 5 and 0", filled(first[0].OrderId), filled(second[0].OrderId))
+	}
+	// a new quote brings new size, taken in order placement order
+	pb.UpdatePrice(quote)
+	if filled(first[0].OrderId) != 8 || filled(second[0].OrderId) != 2 {
+		t.Errorf("filled %g and %g after a second quote, want 8 and 2", filled(first[0].OrderId), filled(second[0].OrderId))
+	}
+	// sells draw on the bid side, which is not capped without a size
+	sell, _ := pb.PlaceOrder(SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Sell", Amount: 4, OrderType: "Limit", OrderPrice: 98})
+	if filled(sell[0].OrderId) != 4 {
+		t.Errorf("sell filled %g, want 4", filled(sell[0].OrderId))
+	}
+}
@@ -0,0 +1,48 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Field groups understood by the info price endpoints.
+const (
+	FieldGroupQuote                  = "Quote"
+	FieldGroupDisplayAndFormat       = "DisplayAndFormat"
+	FieldGroupPriceInfo              = "PriceInfo"
+	FieldGroupPriceInfoDetails       = "PriceInfoDetails"
+	FieldGroupMarketDepth            = "MarketDepth"
+	FieldGroupGreeks                 = "Greeks"
+	FieldGroupInstrumentPriceDetails = "InstrumentPriceDetails"
+)
+
+// PriceList fetches prices for several instruments of one asset type in a
+// single call. Without field groups only the Quote is requested.
+func (api *SaxoAPI) PriceList(uics []int, assetType string, fieldGroups []string) ([]SaxoPrice, error) {
+	if len(uics) == 0 {
+		return nil, errors.New("No Uics given")
+	}
+	if len(fieldGroups) == 0 {
+		fieldGroups = []string{FieldGroupQuote}
+	}
+	return api.priceList(SaxoInstruction{Uics: uics, AssetTypes: []string{assetType}, FieldGroups: fieldGroups})
+}
+
+func (api *SaxoAPI) priceList(instr SaxoInstruction) ([]SaxoPrice, error) {
+	api.Params = instr.MakeParams("prices")
+	data, err := api.Call("prices")
+	if err != nil {
+		return nil, err
+	}
+	var prices SaxoData[SaxoPrice]
+	err = json.Unmarshal(data, &prices)
+	if err != nil {
+		return nil, err
+	}
+	if api.Paper != nil {
+		for _, p := range prices.Data {
+			api.Paper.UpdatePrice(p)
+		}
+	}
+	return prices.Data, nil
+}
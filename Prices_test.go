@@ -0,0 +1,74 @@
+package saxotrader
+
+import "testing"
+
+const testPriceList = `{"Data":[
+	{"Uic":21,"AssetType":"Stock","LastUpdated":"2024-03-04T15:00:00Z",
+	 "Quote":{"BidPrice":99,"AskPrice":101,"Mid":100},
+	 "PriceInfo":{"High":103,"Low":97,"NetChange":1.5},
+	 "PriceInfoDetails":{"LastTraded":100.5,"Volume":12000},
+	 "MarketDepth":{"Bid":[99,98.5],"BidSize":[300,500],"Ask":[101,101.5],"AskSize":[200,400],"NoOfBids":2,"NoOfOffers":2}},
+	{"Uic":22,"AssetType":"Stock","Quote":{"BidPrice":49,"AskPrice":51,"Mid":50}}]}`
+
+func TestPriceList(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET trade/v1/infoprices/list", testPriceList)
+
+	prices, err := api.PriceList([]int{21, 22}, "Stock", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prices) != 2 || prices[0].Uic != 21 || prices[1].Uic != 22 || prices[1].Quote.Mid != 50 {
+		t.Fatalf("prices = %+v", prices)
+	}
+	p := prices[0]
+	if p.PriceInfo.High != 103 || p.PriceInfoDetails.Volume != 12000 || len(p.MarketDepth.Bid) != 2 || p.MarketDepth.AskSize[1] != 400 {
+		t.Errorf("field groups of Uic 21 = %+v", p)
+	}
+
+	if _, err := api.PriceList([]int{21, 22}, "Stock", []string{FieldGroupQuote, FieldGroupMarketDepth}); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.calls("GET trade/v1/infoprices/list")
+	for i, want := range []string{"Quote", "Quote,MarketDepth"} {
+		q := calls[i].Query
+		if q.Get("Uics") != "21,22" || q.Get("AssetType") != "Stock" || q.Get("AssetTypes") != "" || q.Get("FieldGroups") != want {
+			t.Errorf("request %d = %v, want FieldGroups %s", i, q, want)
+		}
+	}
+
+	if _, err := api.PriceList(nil, "Stock", nil); err == nil {
+		t.Error("PriceList without Uics did not fail")
+	}
+}
+
+func TestPricesSingle(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET trade/v1/infoprices/list", testPriceList)
+	p, err := api.Prices(SaxoInstruction{Uic: 21, AssetTypes: []string{"Stock"}})
+	if err != nil || p.Uic != 21 || p.Quote.BidPrice != 99 {
+		t.Errorf("Prices = %+v, %v", p, err)
+	}
+	fake.reply("GET trade/v1/infoprices/list", `{"Data":[]}`)
+	if p, err := api.Prices(SaxoInstruction{Uic: 23, AssetTypes: []string{"Stock"}}); err == nil {
+		t.Errorf("Prices without data = %+v, want an error", p)
+	}
+}
+
+func TestPriceListUpdatesPaperBook(t *testing.T) {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET trade/v1/infoprices/list", testPriceList)
+	api.Paper = NewPaperBook("USD", 100000)
+	orders, err := api.Paper.PlaceOrder(SaxoOrderInstruction{Uic: 22, AssetType: "Stock", BuySell: "Buy", Amount: 10, OrderType: "Limit", OrderPrice: 52})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fetched quote crosses the working limit order
+	if _, err := api.PriceList([]int{21, 22}, "Stock", nil); err != nil {
+		t.Fatal(err)
+	}
+	acts := api.Paper.OrderActivities(orders[0].OrderId)
+	if last := acts[len(acts)-1]; last.Status != "FinalFill" || last.ExecutionPrice != 51 {
+		t.Errorf("last activity = %+v, want a fill at 51", last)
+	}
+}
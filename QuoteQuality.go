@@ -0,0 +1,141 @@
+package saxotrader
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type QuoteQuality string
+
+const (
+	QuoteRealtime   QuoteQuality = "Realtime"
+	QuoteDelayed    QuoteQuality = "Delayed"
+	QuoteIndicative QuoteQuality = "Indicative"
+	QuoteStale      QuoteQuality = "Stale"
+	QuoteNoMarket   QuoteQuality = "NoMarket"
+)
+
+// DefaultMaxQuoteAge is the age past which a quote counts as stale when no
+// policy says otherwise.
+const DefaultMaxQuoteAge = time.Minute
+
+// UpdatedAt parses LastUpdated.
+func (p SaxoPrice) UpdatedAt() (time.Time, error) {
+	return ParseSaxoDate(p.LastUpdated)
+}
+
+// Age is how old the price was at now, or -1 without a timestamp.
+func (p SaxoPrice) Age(now time.Time) time.Duration {
+	t, err := p.UpdatedAt()
+	if err != nil {
+		return -1
+	}
+	return now.Sub(t)
+}
+
+func priceTypeIs(q SaxoQuote, types ...string) bool {
+	for _, t := range types {
+		if strings.EqualFold(q.PriceTypeBid, t) || strings.EqualFold(q.PriceTypeAsk, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func marketStateIs(q SaxoQuote, states ...string) bool {
+	for _, s := range states {
+		if strings.EqualFold(q.MarketState, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quality classifies the quote at now. The checks run from worst to best:
+// no market (including a closed, suspended or halted market state),
+// indicative, delayed, then stale when older than maxAge
+// (DefaultMaxQuoteAge when zero). A price without a timestamp is stale.
+func (p SaxoPrice) Quality(now time.Time, maxAge time.Duration) QuoteQuality {
+	q := p.Quote
+	if maxAge <= 0 {
+		maxAge = DefaultMaxQuoteAge
+	}
+	switch {
+	case priceTypeIs(q, "NoMarket", "Closed") || strings.EqualFold(q.ErrorCode, "NoMarket"):
+		return QuoteNoMarket
+	case marketStateIs(q, "Closed", "Suspended", "Halted"):
+		return QuoteNoMarket
+	case q.BidPrice == 0 && q.AskPrice == 0 && q.Mid == 0:
+		return QuoteNoMarket
+	case priceTypeIs(q, "Indicative", "OldIndicative"):
+		return QuoteIndicative
+	case q.DelayedByMinutes > 0:
+		return QuoteDelayed
+	}
+	if age := p.Age(now); age < 0 || age > maxAge {
+		return QuoteStale
+	}
+	return QuoteRealtime
+}
+
+// QuotePolicy says which quotes order helpers may price from. Set it as
+// SaxoAPI.Quotes to enforce it.
+type QuotePolicy struct {
+	MaxAge          time.Duration
+	AllowDelayed    bool
+	AllowIndicative bool
+	AllowStale      bool
+}
+
+// QuoteError is returned when a quote fails the policy.
+type QuoteError struct {
+	Uic     int
+	Quality QuoteQuality
+	Age     time.Duration
+}
+
+func (e *QuoteError) Error() string {
+	return fmt.Sprintf("Refusing %s quote for Uic %d (age %s)", e.Quality, e.Uic, e.Age.Round(time.Second))
+}
+
+func (qp *QuotePolicy) Check(p SaxoPrice, now time.Time) error {
+	quality := p.Quality(now, qp.MaxAge)
+	ok := quality == QuoteRealtime ||
+		(quality == QuoteDelayed && qp.AllowDelayed) ||
+		(quality == QuoteIndicative && qp.AllowIndicative) ||
+		(quality == QuoteStale && qp.AllowStale)
+	if ok {
+		return nil
+	}
+	return &QuoteError{Uic: p.Uic, Quality: quality, Age: p.Age(now)}
+}
+
+func (api *SaxoAPI) checkQuote(p *SaxoPrice) error {
+	if api.Quotes == nil {
+		return nil
+	}
+	return api.Quotes.Check(*p, time.Now())
+}
+
+// QuotedOrder makes a limit order priced at the far side of the current
+// quote, the ask for a buy and the bid for a sell. The quote must pass
+// api.Quotes when it is set.
+func (api *SaxoAPI) QuotedOrder(uic int, assetType, buysell string, amount float64, duration string) (SaxoOrderInstruction, error) {
+	p, err := api.Prices(SaxoInstruction{Uic: uic, AssetTypes: []string{assetType}})
+	if err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	if err := api.checkQuote(p); err != nil {
+		return SaxoOrderInstruction{}, err
+	}
+	price := p.Quote.BidPrice
+	if buysell == "Buy" {
+		price = p.Quote.AskPrice
+	}
+	if price == 0 {
+		return SaxoOrderInstruction{}, errors.New(fmt.Sprintf("No %s side quoted for Uic %d", buysell, uic))
+	}
+	return api.MakeOrder(amount, price, uic, assetType, buysell, duration, "Limit")
+}
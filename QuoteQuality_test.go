@@ -0,0 +1,86 @@
+package saxotrader
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuotePolicyCheck(t *testing.T) {
+	now := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	price := func(age time.Duration, q SaxoQuote) SaxoPrice {
+		p := SaxoPrice{Uic: 21, Quote: q}
+		if age >= 0 {
+			p.LastUpdated = now.Add(-age).Format(time.RFC3339Nano)
+		}
+		return p
+	}
+	live := SaxoQuote{BidPrice: 1.0850, AskPrice: 1.0852, PriceTypeBid: "Tradable", PriceTypeAsk: "Tradable"}
+	delayed := live
+	delayed.DelayedByMinutes = 15
+	indicative := live
+	indicative.PriceTypeBid, indicative.PriceTypeAsk = "Indicative", "Indicative"
+	closed := live
+	closed.PriceTypeBid, closed.PriceTypeAsk = "NoMarket", "NoMarket"
+	tests := []struct {
+		name    string
+		policy  QuotePolicy
+		p       SaxoPrice
+		quality QuoteQuality
+		ok      bool
+	}{
+		{"realtime", QuotePolicy{}, price(time.Second, live), QuoteRealtime, true},
+		{"stale after the default age", QuotePolicy{}, price(2*time.Minute, live), QuoteStale, false},
+		{"within a longer max age", QuotePolicy{MaxAge: 5 * time.Minute}, price(2*time.Minute, live), QuoteRealtime, true},
+		{"stale allowed", QuotePolicy{AllowStale: true}, price(2*time.Minute, live), QuoteStale, true},
+		{"no timestamp is stale", QuotePolicy{}, price(-1, live), QuoteStale, false},
+		{"delayed refused", QuotePolicy{}, price(time.Second, delayed), QuoteDelayed, false},
+		{"delayed allowed", QuotePolicy{AllowDelayed: true}, price(time.Second, delayed), QuoteDelayed, true},
+		{"indicative refused", QuotePolicy{AllowDelayed: true}, price(time.Second, indicative), QuoteIndicative, false},
+		{"indicative allowed", QuotePolicy{AllowIndicative: true}, price(time.Second, indicative), QuoteIndicative, true},
+		{"no market", QuotePolicy{AllowDelayed: true, AllowIndicative: true, AllowStale: true}, price(time.Second, closed), QuoteNoMarket, false},
+		{"no prices", QuotePolicy{AllowStale: true}, price(time.Second, SaxoQuote{}), QuoteNoMarket, false},
+		{"market closed", QuotePolicy{AllowStale: true}, price(time.Second, SaxoQuote{BidPrice: 1, AskPrice: 2, MarketState: "Closed"}), QuoteNoMarket, false},
+		{"market suspended", QuotePolicy{}, price(time.Second, SaxoQuote{BidPrice: 1, AskPrice: 2, MarketState: "Suspended"}), QuoteNoMarket, false},
+		{"market open", QuotePolicy{}, price(time.Second, SaxoQuote{BidPrice: 1, AskPrice: 2, MarketState: "Open"}), QuoteRealtime, true},
+		{"no market error code", QuotePolicy{}, price(time.Second, SaxoQuote{BidPrice: 1, AskPrice: 2, ErrorCode: "NoMarket"}), QuoteNoMarket, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.p.Quality(now, tt.policy.MaxAge); got != tt.quality {
+				t.Errorf("Quality = %s, want %s", got, tt.quality)
+			}
+			err := tt.policy.Check(tt.p, now)
+			if tt.ok {
+				if err != nil {
+					t.Errorf("Check refused the quote: %v", err)
+				}
+				return
+			}
+			var qe *QuoteError
+			if !errors.As(err, &qe) {
+				t.Fatalf("Check = %v, want a QuoteError", err)
+			}
+			if qe.Quality != tt.quality || qe.Uic != 21 {
+				t.Errorf("QuoteError = %+v, want quality %s for Uic 21", qe, tt.quality)
+			}
+		})
+	}
+}
+
+func TestRiskGuardChecksQuote(t *testing.T) {
+	api := riskFake(t)
+	// the served quotes have no timestamp, so they are stale
+	api.Quotes = &QuotePolicy{}
+	g := NewRiskGuard(RiskLimits{MaxOrderNotional: 1e9}, nil)
+	g.FX = testConverter(time.Now())
+	err := g.Check(api, SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 1})
+	var qe *QuoteError
+	if !errors.As(err, &qe) || qe.Quality != QuoteStale {
+		t.Fatalf("err = %v, want a stale QuoteError", err)
+	}
+	api.Quotes.AllowStale = true
+	if err := g.Check(api, SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 1}); err != nil {
+		t.Errorf("allowed quote refused: %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+type RiskRule string
+
+const (
+	RiskMaxOrderNotional RiskRule = "MaxOrderNotional"
+	RiskMaxPosition      RiskRule = "MaxPositionPerUic"
+	RiskMaxGrossExposure RiskRule = "MaxGrossExposure"
+	RiskMaxOrderRate     RiskRule = "MaxOrdersPerMinute"
+	RiskAssetType        RiskRule = "AllowedAssetTypes"
+	RiskDailyLoss        RiskRule = "MaxDailyLoss"
+)
+
+// RiskLimits configures the RiskGuard. A zero value disables a limit.
+// Amounts are in the account currency, and order notionals include the
+// instrument's contract size. MaxGrossLeverage is a multiple of the
+// balance TotalValue and is only used when MaxGrossExposure is not set.
+// MaxDailyLoss is checked against the balance
+// UnrealizedMarginClosedProfitLoss: the profit and loss of margin
+// positions closed since Saxo last booked them, normally at the end of
+// the trading day. It does not include open positions or cash products
+// such as stocks, whose closed profit and loss is booked at once.
+type RiskLimits struct {
+	MaxOrderNotional   float64
+	MaxPositionPerUic  float64
+	MaxGrossExposure   float64
+	MaxGrossLeverage   float64
+	MaxOrdersPerMinute int
+	AllowedAssetTypes  []string
+	MaxDailyLoss       float64
+}
+
+type RiskViolation struct {
+	Rule    RiskRule
+	Uic     int
+	Limit   float64
+	Value   float64
+	Message string
+}
+
+func (rv *RiskViolation) Error() string {
+	return fmt.Sprintf("Risk check %s failed for Uic %d: %s (limit %g, value %g)", rv.Rule, rv.Uic, rv.Message, rv.Limit, rv.Value)
+}
+
+type RiskOverride struct {
+	By      string
+	Reason  string
+	Rules   []RiskRule
+	Expires time.Time
+}
+
+func (ro *RiskOverride) covers(rule RiskRule, now time.Time) bool {
+	if ro == nil || now.After(ro.Expires) {
+		return false
+	}
+	if len(ro.Rules) == 0 {
+		return true
+	}
+	for _, r := range ro.Rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+type RiskAuditRecord struct {
+	Time      time.Time
+	Event     string
+	Rule      RiskRule `json:",omitempty"`
+	By        string   `json:",omitempty"`
+	Reason    string   `json:",omitempty"`
+	Message   string   `json:",omitempty"`
+	Uic       int      `json:",omitempty"`
+	BuySell   string   `json:",omitempty"`
+	Amount    float64  `json:",omitempty"`
+	Price     float64  `json:",omitempty"`
+	AssetType string   `json:",omitempty"`
+}
+
+// RiskGuard checks orders against RiskLimits before they are sent. Set it
+// as SaxoAPI.Risk to have PlaceOrder run the checks. Blocks, overrides and
+// orders passed under an override are written to the audit writer as JSON
+// lines. Order notionals are converted to the account currency with FX,
+// which is created from the api on first use when not set.
+type RiskGuard struct {
+	Limits RiskLimits
+	Audit  io.Writer
+	FX     *FxConverter
+
+	mu         sync.Mutex
+	orderTimes []time.Time
+	override   *RiskOverride
+	now        func() time.Time
+}
+
+func NewRiskGuard(limits RiskLimits, audit io.Writer) *RiskGuard {
+	return &RiskGuard{Limits: limits, Audit: audit, now: time.Now}
+}
+
+// Override suspends the given rules (all rules when none are given) until
+// the duration has passed. by and reason are mandatory and are audited.
+func (g *RiskGuard) Override(by, reason string, d time.Duration, rules ...RiskRule) error {
+	if by == "" || reason == "" {
+		return errors.New("Risk override needs a user and a reason")
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := g.now()
+	g.override = &RiskOverride{By: by, Reason: reason, Rules: rules, Expires: now.Add(d)}
+	msg := "all rules"
+	if len(rules) > 0 {
+		msg = fmt.Sprint(rules)
+	}
+	g.audit(RiskAuditRecord{Time: now, Event: "OverrideSet", By: by, Reason: reason, Message: fmt.Sprintf("%s until %s", msg, g.override.Expires.Format(time.RFC3339))})
+	return nil
+}
+
+func (g *RiskGuard) ClearOverride(by string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.override == nil {
+		return
+	}
+	g.override = nil
+	g.audit(RiskAuditRecord{Time: g.now(), Event: "OverrideCleared", By: by})
+}
+
+// Check validates an order against the limits, using the api for current
+// net positions, balance and, for orders without a price, a quote, which
+// must pass api.Quotes when it is set. A passing order is counted towards
+// the order rate.
+func (g *RiskGuard) Check(api *SaxoAPI, instr SaxoOrderInstruction) (err error) {
+	g.mu.Lock()
+	now := g.now()
+	limits := g.Limits
+	override := g.override
+	// the order takes its slot in the rate window now, so concurrent
+	// checks count it, and gives it back if it is not sent
+	count := 0
+	for _, t := range g.orderTimes {
+		if now.Sub(t) < time.Minute {
+			count++
+		}
+	}
+	g.orderTimes = append(g.orderTimes, now)
+	g.mu.Unlock()
+	defer func() {
+		if err != nil {
+			g.mu.Lock()
+			g.release(now)
+			g.mu.Unlock()
+		}
+	}()
+
+	var violations []*RiskViolation
+	fail := func(rv *RiskViolation) {
+		rv.Uic = instr.Uic
+		violations = append(violations, rv)
+	}
+
+	if len(limits.AllowedAssetTypes) > 0 {
+		allowed := false
+		for _, at := range limits.AllowedAssetTypes {
+			if at == instr.AssetType {
+				allowed = true
+			}
+		}
+		if !allowed {
+			fail(&RiskViolation{Rule: RiskAssetType, Message: fmt.Sprintf("asset type %s not allowed", instr.AssetType)})
+		}
+	}
+
+	if limits.MaxOrdersPerMinute > 0 {
+		if count >= limits.MaxOrdersPerMinute {
+			fail(&RiskViolation{Rule: RiskMaxOrderRate, Limit: float64(limits.MaxOrdersPerMinute), Value: float64(count + 1), Message: "too many orders in the last minute"})
+		}
+	}
+
+	signed := instr.Amount
+	if instr.BuySell == "Sell" {
+		signed = -instr.Amount
+	}
+
+	var balance *SaxoBalance
+	needNotional := limits.MaxOrderNotional > 0 || limits.MaxGrossExposure > 0 || limits.MaxGrossLeverage > 0
+	if needNotional || limits.MaxDailyLoss > 0 {
+		balance, err = api.Balance()
+		if err != nil {
+			return err
+		}
+	}
+
+	if limits.MaxDailyLoss > 0 {
+		realized := balance.UnrealizedMarginClosedProfitLoss
+		if -realized >= limits.MaxDailyLoss {
+			fail(&RiskViolation{Rule: RiskDailyLoss, Limit: limits.MaxDailyLoss, Value: -realized, Message: "closed loss limit reached"})
+		}
+	}
+
+	// without a price the order cannot be valued, which fails whichever
+	// notional limits apply
+	var notional float64
+	priced := true
+	if needNotional {
+		currency, size, err := instrumentTerms(api, instr.Uic, instr.AssetType)
+		if err != nil {
+			return err
+		}
+		price := instr.OrderPrice
+		if price == 0 {
+			p, err := api.Prices(SaxoInstruction{Uic: instr.Uic, AssetTypes: []string{instr.AssetType}})
+			if err != nil {
+				return err
+			}
+			if err := api.checkQuote(p); err != nil {
+				return err
+			}
+			price = p.Quote.Mid
+			if instr.BuySell == "Buy" && p.Quote.AskPrice != 0 {
+				price = p.Quote.AskPrice
+			} else if instr.BuySell == "Sell" && p.Quote.BidPrice != 0 {
+				price = p.Quote.BidPrice
+			}
+		}
+		priced = price != 0
+		notional, err = g.convert(api, math.Abs(instr.Amount*price*size), currency, balance.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	if limits.MaxOrderNotional > 0 {
+		if !priced {
+			fail(&RiskViolation{Rule: RiskMaxOrderNotional, Limit: limits.MaxOrderNotional, Message: "no price available to value the order"})
+		} else if notional > limits.MaxOrderNotional {
+			fail(&RiskViolation{Rule: RiskMaxOrderNotional, Limit: limits.MaxOrderNotional, Value: notional, Message: "order notional too large"})
+		}
+	}
+
+	if limits.MaxPositionPerUic > 0 || limits.MaxGrossExposure > 0 || limits.MaxGrossLeverage > 0 {
+		positions, err := api.NetPositions(SaxoInstruction{})
+		if err != nil {
+			return err
+		}
+		var current, gross float64
+		for _, np := range positions {
+			if np.NetPositionBase.Uic == instr.Uic && np.NetPositionBase.AssetType == instr.AssetType {
+				current += np.NetPositionBase.Amount
+			}
+			if limits.MaxGrossExposure == 0 && limits.MaxGrossLeverage == 0 {
+				continue
+			}
+			currency := np.NetPositionView.ExposureCurrency
+			if currency == "" {
+				currency, _, err = instrumentTerms(api, np.NetPositionBase.Uic, np.NetPositionBase.AssetType)
+				if err != nil {
+					return err
+				}
+			}
+			exposure, err := g.convert(api, math.Abs(np.NetPositionView.Exposure), currency, balance.Currency)
+			if err != nil {
+				return err
+			}
+			gross += exposure
+		}
+		if limits.MaxPositionPerUic > 0 && math.Abs(current+signed) > limits.MaxPositionPerUic && math.Abs(current+signed) > math.Abs(current) {
+			fail(&RiskViolation{Rule: RiskMaxPosition, Limit: limits.MaxPositionPerUic, Value: math.Abs(current + signed), Message: "resulting position too large"})
+		}
+		maxGross := limits.MaxGrossExposure
+		if maxGross == 0 && limits.MaxGrossLeverage > 0 {
+			maxGross = limits.MaxGrossLeverage * balance.TotalValue
+		}
+		// orders reducing a position never add exposure
+		reducing := current != 0 && math.Signbit(current) != math.Signbit(signed) && math.Abs(signed) <= math.Abs(current)
+		if maxGross > 0 && !reducing {
+			if !priced {
+				fail(&RiskViolation{Rule: RiskMaxGrossExposure, Limit: maxGross, Value: gross, Message: "no price available to value the order"})
+			} else if gross+notional > maxGross {
+				fail(&RiskViolation{Rule: RiskMaxGrossExposure, Limit: maxGross, Value: gross + notional, Message: "gross exposure too large"})
+			}
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, rv := range violations {
+		if override.covers(rv.Rule, now) {
+			g.audit(RiskAuditRecord{Time: now, Event: "OverrideUsed", Rule: rv.Rule, By: override.By, Reason: override.Reason, Message: rv.Message,
+				Uic: instr.Uic, BuySell: instr.BuySell, Amount: instr.Amount, Price: instr.OrderPrice, AssetType: instr.AssetType})
+			continue
+		}
+		g.audit(RiskAuditRecord{Time: now, Event: "Blocked", Rule: rv.Rule, Message: rv.Message,
+			Uic: instr.Uic, BuySell: instr.BuySell, Amount: instr.Amount, Price: instr.OrderPrice, AssetType: instr.AssetType})
+		return rv
+	}
+	for len(g.orderTimes) > 0 && now.Sub(g.orderTimes[0]) >= time.Minute {
+		g.orderTimes = g.orderTimes[1:]
+	}
+	return nil
+}
+
+// release must be called with g.mu held. It drops the rate slot taken at t.
+func (g *RiskGuard) release(t time.Time) {
+	for i := len(g.orderTimes) - 1; i >= 0; i-- {
+		if g.orderTimes[i].Equal(t) {
+			g.orderTimes = append(g.orderTimes[:i], g.orderTimes[i+1:]...)
+			return
+		}
+	}
+}
+
+// instrumentTerms returns the currency an instrument is priced in and its
+// contract size, which is 1 when Saxo does not give one.
+func instrumentTerms(api *SaxoAPI, uic int, assetType string) (string, float64, error) {
+	details, err := api.InstrumentDetails(SaxoInstruction{Uic: uic, AssetTypes: []string{assetType}})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(details) == 0 || details[0].CurrencyCode == "" {
+		return "", 0, errors.New(fmt.Sprintf("No currency known for Uic %d", uic))
+	}
+	size := details[0].ContractSize
+	if size <= 0 {
+		size = 1
+	}
+	return details[0].CurrencyCode, size, nil
+}
+
+// convert changes an amount into the account currency.
+func (g *RiskGuard) convert(api *SaxoAPI, amount float64, from, to string) (float64, error) {
+	if amount == 0 || to == "" || from == to {
+		return amount, nil
+	}
+	g.mu.Lock()
+	if g.FX == nil {
+		g.FX = NewFxConverter(api)
+	}
+	fx := g.FX
+	g.mu.Unlock()
+	return fx.Convert(amount, from, to)
+}
+
+// audit must be called with g.mu held
+func (g *RiskGuard) audit(rec RiskAuditRecord) {
+	if g.Audit == nil {
+		return
+	}
+	ba, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	g.Audit.Write(append(ba, '\n'))
+}
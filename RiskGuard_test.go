@@ -0,0 +1,142 @@
+package saxotrader
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// riskFake serves an EUR account holding a USD stock (Uic 21) and an EUR
+// future with a contract size of 50 (Uic 30). Uic 22 has no quote.
+func riskFake(t *testing.T) *SaxoAPI {
+	api, fake := newFakeSaxo(t)
+	fake.reply("GET port/v1/balances", `{"Currency":"EUR","TotalValue":10000,"UnrealizedMarginClosedProfitLoss":-300}`)
+	details := map[string]string{
+		"21": `{"Data":[{"AssetType":"Stock","CurrencyCode":"USD"}]}`,
+		"22": `{"Data":[{"AssetType":"Stock","CurrencyCode":"USD"}]}`,
+		"30": `{"Data":[{"AssetType":"ContractFutures","CurrencyCode":"EUR","ContractSize":50}]}`,
+	}
+	fake.handle("GET ref/v1/instruments/details", func(r fakeRequest) (int, string) {
+		return http.StatusOK, details[r.Query.Get("Uics")]
+	})
+	prices := map[string]string{
+		"21": `{"Data":[{"Uic":21,"AssetType":"Stock","Quote":{"BidPrice":99,"AskPrice":101,"Mid":100}}]}`,
+		"22": `{"Data":[{"Uic":22,"AssetType":"Stock","Quote":{}}]}`,
+		"30": `{"Data":[{"Uic":30,"AssetType":"ContractFutures","Quote":{"BidPrice":29,"AskPrice":31,"Mid":30}}]}`,
+	}
+	fake.handle("GET trade/v1/infoprices/list", func(r fakeRequest) (int, string) {
+		return http.StatusOK, prices[r.Query.Get("Uics")]
+	})
+	// the future has no exposure currency and is valued in its own
+	fake.reply("GET port/v1/netpositions/me", `{"Data":[
+		{"NetPositionBase":{"Uic":21,"AssetType":"Stock","Amount":40},"NetPositionView":{"Exposure":4000,"ExposureCurrency":"USD"}},
+		{"NetPositionBase":{"Uic":30,"AssetType":"ContractFutures","Amount":-1},"NetPositionView":{"Exposure":-5000}}]}`)
+	return api
+}
+
+func TestRiskGuardLimits(t *testing.T) {
+	usd := 1 / 1.1001
+	gross := 4000*usd + 5000
+	order := func(uic int, assetType, buysell string, amount, price float64) SaxoOrderInstruction {
+		return SaxoOrderInstruction{Uic: uic, AssetType: assetType, BuySell: buysell, Amount: amount, OrderPrice: price}
+	}
+	tests := []struct {
+		name   string
+		limits RiskLimits
+		order  SaxoOrderInstruction
+		rule   RiskRule
+		limit  float64
+		value  float64
+	}{
+		{name: "notional within limit", limits: RiskLimits{MaxOrderNotional: 1000}, order: order(21, "Stock", "Buy", 10, 100)},
+		{name: "notional from the ask", limits: RiskLimits{MaxOrderNotional: 1000}, order: order(21, "Stock", "Buy", 20, 0), rule: RiskMaxOrderNotional, limit: 1000, value: 20 * 101 * usd},
+		{name: "notional from the bid", limits: RiskLimits{MaxOrderNotional: 1000}, order: order(21, "Stock", "Sell", 20, 0), rule: RiskMaxOrderNotional, limit: 1000, value: 20 * 99 * usd},
+		{name: "notional with contract size", limits: RiskLimits{MaxOrderNotional: 1000}, order: order(30, "ContractFutures", "Buy", 1, 30), rule: RiskMaxOrderNotional, limit: 1000, value: 1500},
+		{name: "no price with a notional limit", limits: RiskLimits{MaxOrderNotional: 1000, MaxGrossExposure: 100000}, order: order(22, "Stock", "Buy", 1, 0), rule: RiskMaxOrderNotional, limit: 1000},
+		{name: "no price with a gross limit", limits: RiskLimits{MaxGrossExposure: 100000}, order: order(22, "Stock", "Buy", 1, 0), rule: RiskMaxGrossExposure, limit: 100000, value: gross},
+		{name: "no price needed for a position limit", limits: RiskLimits{MaxPositionPerUic: 1000}, order: order(22, "Stock", "Buy", 1, 0)},
+		{name: "position too large", limits: RiskLimits{MaxPositionPerUic: 50}, order: order(21, "Stock", "Buy", 20, 100), rule: RiskMaxPosition, limit: 50, value: 60},
+		{name: "position reduced", limits: RiskLimits{MaxPositionPerUic: 30}, order: order(21, "Stock", "Sell", 5, 100)},
+		{name: "gross within limit", limits: RiskLimits{MaxGrossExposure: 9200}, order: order(21, "Stock", "Buy", 5, 100)},
+		{name: "gross too large", limits: RiskLimits{MaxGrossExposure: 9000}, order: order(21, "Stock", "Buy", 5, 100), rule: RiskMaxGrossExposure, limit: 9000, value: gross + 500*usd},
+		{name: "gross reduced", limits: RiskLimits{MaxGrossExposure: 1000}, order: order(30, "ContractFutures", "Buy", 1, 30)},
+		{name: "gross from leverage", limits: RiskLimits{MaxGrossLeverage: 0.5}, order: order(21, "Stock", "Buy", 1, 100), rule: RiskMaxGrossExposure, limit: 5000, value: gross + 100*usd},
+		{name: "asset type not allowed", limits: RiskLimits{AllowedAssetTypes: []string{"FxSpot"}}, order: order(21, "Stock", "Buy", 1, 100), rule: RiskAssetType},
+		{name: "asset type allowed", limits: RiskLimits{AllowedAssetTypes: []string{"FxSpot", "Stock"}}, order: order(21, "Stock", "Buy", 1, 100)},
+		{name: "closed loss reached", limits: RiskLimits{MaxDailyLoss: 200}, order: order(21, "Stock", "Buy", 1, 100), rule: RiskDailyLoss, limit: 200, value: 300},
+		{name: "closed loss within limit", limits: RiskLimits{MaxDailyLoss: 500}, order: order(21, "Stock", "Buy", 1, 100)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewRiskGuard(tt.limits, nil)
+			g.FX = testConverter(time.Now())
+			err := g.Check(riskFake(t), tt.order)
+			if tt.rule == "" {
+				if err != nil {
+					t.Fatalf("blocked: %v", err)
+				}
+				return
+			}
+			var rv *RiskViolation
+			if !errors.As(err, &rv) {
+				t.Fatalf("err = %v, want a %s violation", err, tt.rule)
+			}
+			if rv.Rule != tt.rule || rv.Limit != tt.limit || math.Abs(rv.Value-tt.value) > 1e-6 {
+				t.Errorf("violation %s limit %g value %g, want %s limit %g value %g", rv.Rule, rv.Limit, rv.Value, tt.rule, tt.limit, tt.value)
+			}
+		})
+	}
+}
+
+func TestRiskGuardOrderRate(t *testing.T) {
+	start := time.Date(2024, 3, 6, 12, 0, 0, 0, time.UTC)
+	var now time.Time
+	g := NewRiskGuard(RiskLimits{MaxOrdersPerMinute: 2}, nil)
+	g.now = func() time.Time { return now }
+	steps := []struct {
+		at      time.Duration
+		blocked bool
+	}{
+		{0, false},
+		{10 * time.Second, false},
+		{20 * time.Second, true},
+		// blocked orders do not take a slot
+		{30 * time.Second, true},
+		{61 * time.Second, false},
+		{65 * time.Second, true},
+		{71 * time.Second, false},
+	}
+	for _, s := range steps {
+		now = start.Add(s.at)
+		err := g.Check(nil, SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 1})
+		if blocked := err != nil; blocked != s.blocked {
+			t.Errorf("order at %s: err = %v, want blocked %v", s.at, err, s.blocked)
+		}
+	}
+}
+
+func TestRiskGuardOverride(t *testing.T) {
+	g := NewRiskGuard(RiskLimits{AllowedAssetTypes: []string{"FxSpot"}}, nil)
+	instr := SaxoOrderInstruction{Uic: 21, AssetType: "Stock", BuySell: "Buy", Amount: 1}
+	if err := g.Override("", "test", time.Minute); err == nil {
+		t.Error("override without a user accepted")
+	}
+	if err := g.Override("ops", "test", time.Minute, RiskMaxOrderRate); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(nil, instr); err == nil {
+		t.Error("override of another rule let the order pass")
+	}
+	if err := g.Override("ops", "test", time.Minute, RiskAssetType); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(nil, instr); err != nil {
+		t.Errorf("override did not apply: %v", err)
+	}
+	g.ClearOverride("ops")
+	if err := g.Check(nil, instr); err == nil {
+		t.Error("cleared override still applies")
+	}
+}
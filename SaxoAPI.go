@@ -21,6 +21,11 @@ type SaxoAPI struct {
 	LoginToken string
 	Body       []byte
 	BodyObject interface{}
+	Paper      *PaperBook
+	Risk       *RiskGuard
+	Journal    *OrderJournal
+	Quotes     *QuotePolicy
+	RefCache   *InstrumentCache
 }
 
 type RESTCall struct {
@@ -50,13 +55,31 @@ var SaxoEndpoints = map[string]RESTCall{
 	"positions":          {"GET", "port/v1/positions/me"},
 	"net_positions":      {"GET", "port/v1/netpositions/me"},
 	"order":              {"GET", "trade/v2/orders/"},
-	"cancel_order":       {"DELETE", "trade/v2/orders/"},
+	"cancel_order":       {"DELETE", "trade/v2/orders/{OrderIds}"},
 	"replace_order":      {"PUT", "trade/v2/orders/"},
 	"quotes":             {"GET", "trade/v1/infoprices/snapshot"},
 	"chart":              {"GET", "chart/v1/charts"},
 	"chart_data":         {"GET", "chart/v1/charts/"},
 	"chart_list":         {"GET", "chart/v1/charts/me"},
 	"chart_config":       {"GET", "chart/v1/configurations"},
+	"order_activities":   {"GET", "cs/v1/audit/orderactivities"},
+	"multileg_order":     {"POST", "trade/v2/orders/multileg"},
+	"exchanges":          {"GET", "ref/v1/exchanges"},
+	"exchange":           {"GET", "ref/v1/exchanges/{ExchangeId}"},
+	"option_space":       {"GET", "ref/v1/instruments/contractoptionspaces/{OptionRootId}"},
+	"futures_space":      {"GET", "ref/v1/instruments/futuresspaces/{ContinuousFuturesUic}"},
+
+	"price_subscribe":          {"POST", "trade/v1/infoprices/subscriptions"},
+	"price_unsubscribe":        {"DELETE", "trade/v1/infoprices/subscriptions/{ContextId}/{ReferenceId}"},
+	"order_subscribe":          {"POST", "port/v1/orders/subscriptions"},
+	"order_unsubscribe":        {"DELETE", "port/v1/orders/subscriptions/{ContextId}/{ReferenceId}"},
+	"position_subscribe":       {"POST", "port/v1/positions/subscriptions"},
+	"position_unsubscribe":     {"DELETE", "port/v1/positions/subscriptions/{ContextId}/{ReferenceId}"},
+	"net_position_subscribe":   {"POST", "port/v1/netpositions/subscriptions"},
+	"net_position_unsubscribe": {"DELETE", "port/v1/netpositions/subscriptions/{ContextId}/{ReferenceId}"},
+	"balance_subscribe":        {"POST", "port/v1/balances/subscriptions"},
+	"balance_unsubscribe":      {"DELETE", "port/v1/balances/subscriptions/{ContextId}/{ReferenceId}"},
+	"streaming_authorize":      {"PUT", "streamingws/authorize?contextid={ContextId}"},
 }
 
 type SaxoQuote struct {
@@ -75,13 +98,91 @@ type SaxoQuote struct {
 	PriceTypeBid     string
 }
 
+type SaxoInstrumentPriceDetails struct {
+	CfdBorrowingCost     float64
+	CfdHardToFinance     bool
+	CfdPriceAdjustment   bool
+	DividendYieldPercent float64
+	EstPriceBuy          float64
+	EstPriceSell         float64
+	ExpiryDate           string
+	ForwardDateFarLeg    string
+	ForwardDateNearLeg   string
+	IsMarketOpen         bool
+	LowerBarrier         float64
+	MidForwardPrice      float64
+	MidSpotPrice         float64
+	NoticeDate           string
+	OpenInterest         float64
+	PaidCfdInterest      float64
+	ReceivedCfdInterest  float64
+	ShortTradeDisabled   bool
+	SpotAsk              float64
+	SpotBid              float64
+	SpotDate             string
+	StrikePrice          float64
+	UpperBarrier         float64
+	ValueDate            string
+}
+
+type SaxoPriceInfo struct {
+	High          float64
+	Low           float64
+	NetChange     float64
+	PercentChange float64
+}
+
+type SaxoPriceInfoDetails struct {
+	AskSize        float64
+	BidSize        float64
+	LastClose      float64
+	LastTraded     float64
+	LastTradedSize float64
+	Open           float64
+	Volume         float64
+}
+
+type SaxoMarketDepth struct {
+	Ask         []float64
+	AskOrders   []int
+	AskSize     []float64
+	Bid         []float64
+	BidOrders   []int
+	BidSize     []float64
+	NoOfBids    int
+	NoOfOffers  int
+	UsingOrders bool
+}
+
+type SaxoGreeks struct {
+	AskVolatility    float64
+	BidVolatility    float64
+	Delta            float64
+	Gamma            float64
+	InstrumentDelta  float64
+	InstrumentGamma  float64
+	InstrumentTheta  float64
+	InstrumentVega   float64
+	MidVolatility    float64
+	Phi              float64
+	Rho              float64
+	TheoreticalPrice float64
+	Theta            float64
+	Vega             float64
+}
+
 type SaxoPrice struct {
-	AssetType        string
-	LastUpdated      string
-	PriceSource      string
-	Quote            SaxoQuote
-	DisplayAndFormat SaxoFormat
-	Uic              int
+	AssetType              string
+	LastUpdated            string
+	PriceSource            string
+	Quote                  SaxoQuote
+	DisplayAndFormat       SaxoFormat
+	Greeks                 SaxoGreeks
+	InstrumentPriceDetails SaxoInstrumentPriceDetails
+	MarketDepth            SaxoMarketDepth
+	PriceInfo              SaxoPriceInfo
+	PriceInfoDetails       SaxoPriceInfoDetails
+	Uic                    int
 }
 
 type SaxoFormat struct {
@@ -238,6 +339,7 @@ type SaxoAsset struct {
 	PrimaryListing int
 	SummaryType    string
 	IssuerCountry  string
+	Isin           string
 	Symbol         string
 	TradableAs     []string
 }
@@ -245,6 +347,7 @@ type SaxoAsset struct {
 type SaxoAssetDetails struct {
 	AssetType           string
 	AmountDecimals      int
+	ContractSize        float64
 	CurrencyCode        string
 	DefaultAmount       float64
 	DefaultSlippage     float64
@@ -334,6 +437,11 @@ type SaxoOrderInstruction struct {
 	}
 	ManualOrder bool
 	AccountKey  string
+	ToOpenClose string `json:",omitempty"`
+
+	ForwardDate        string `json:",omitempty"`
+	ForwardDateNearLeg string `json:",omitempty"`
+	ForwardDateFarLeg  string `json:",omitempty"`
 }
 
 type SaxoOrderPost struct {
@@ -364,6 +472,7 @@ type SaxoOrder struct {
 	CurrentPriceType         string
 	DisplayAndFormat         SaxoFormat
 	DistanceToMarket         float64
+	FilledAmount             float64
 	Duration                 struct {
 		DurationType string
 	}
@@ -393,6 +502,25 @@ type SaxoOrder struct {
 	Uic                    int
 }
 
+type SaxoOrderActivity struct {
+	AccountId      string
+	AccountKey     string
+	ActivityTime   string
+	Amount         float64
+	AssetType      string
+	AveragePrice   float64
+	BuySell        string
+	CorrelationKey string
+	ExecutionPrice float64
+	FilledAmount   float64
+	OrderId        string
+	OrderType      string
+	Price          float64
+	Status         string
+	SubStatus      string
+	Uic            int
+}
+
 type SaxoPosition struct {
 	DisplayAndFormat SaxoFormat
 	NetPositionId    string
@@ -475,6 +603,7 @@ type SaxoNetPosition struct {
 		CurrentPriceDelayMinutes        float64
 		CurrentPriceType                string
 		Exposure                        float64
+		ExposureCurrency                string
 		ExposureInBaseCurrency          float64
 		InstrumentPriceDayPercentChange float64
 		PositionCount                   int
@@ -500,14 +629,24 @@ type SaxoError struct {
 	ModelState map[string][]string
 }
 
+// instrumentKey identifies an instrument by Uic and asset type in maps
+// and cache files.
+func instrumentKey(uic int, assetType string) string {
+	return fmt.Sprintf("%d__%s", uic, assetType)
+}
+
 func (api *SaxoAPI) MakeOrder(amount, price float64, uic int, asset, buysell, duration, orderType string) (SaxoOrderInstruction, error) {
+	return makeOrder(api.AccountKey, amount, price, uic, asset, buysell, duration, orderType)
+}
+
+func makeOrder(accountKey string, amount, price float64, uic int, asset, buysell, duration, orderType string) (SaxoOrderInstruction, error) {
 	if duration == "" {
 		duration = "DayOrder"
 	}
 	if orderType == "" {
 		orderType = "Limit"
 	}
-	if api.AccountKey == "" {
+	if accountKey == "" {
 		return SaxoOrderInstruction{}, errors.New("No account key set")
 	}
 	return SaxoOrderInstruction{
@@ -517,7 +656,7 @@ func (api *SaxoAPI) MakeOrder(amount, price float64, uic int, asset, buysell, du
 		AssetType:   asset,
 		OrderPrice:  price,
 		OrderType:   orderType,
-		AccountKey:  api.AccountKey,
+		AccountKey:  accountKey,
 		ManualOrder: true,
 		OrderDuration: struct {
 			DurationType string
@@ -573,6 +712,21 @@ func (api *SaxoAPI) Call(call string) ([]byte, error) {
 	} else {
 		rdr = bytes.NewReader(api.Body)
 	}
+	// substitute path parameters such as {OrderId} before building the request
+	pathParams := make(map[string]bool)
+	paramrx := regexp.MustCompile(`\{([a-zA-Z0-9]+)\}`)
+	for _, p := range paramrx.FindAllString(uri, -1) {
+		name := strings.Trim(p, "{}")
+		val, ok := api.Params[name]
+		if !ok && name == "ClientKey" {
+			val = api.ClientKey
+		}
+		if !ok && name == "AccountKey" {
+			val = api.AccountKey
+		}
+		pathParams[name] = true
+		uri = strings.Replace(uri, p, val, 1)
+	}
 	req, err := http.NewRequest(SaxoEndpoints[call].Method, uri, rdr)
 	if err != nil {
 		return nil, err
@@ -587,18 +741,15 @@ func (api *SaxoAPI) Call(call string) ([]byte, error) {
 	if SaxoEndpoints[call].Method == "GET" || SaxoEndpoints[call].Method == "DELETE" {
 		q := req.URL.Query()
 		for k, v := range api.Params {
-			q.Add(k, v)
+			if !pathParams[k] {
+				q.Add(k, v)
+			}
 		}
-		if len(api.ClientKey) > 0 {
-			q.Add("ClientKey", api.ClientKey)
+		if len(api.ClientKey) > 0 && !pathParams["ClientKey"] {
+			q.Set("ClientKey", api.ClientKey)
 		}
-		if len(api.AccountKey) > 0 {
-			q.Add("AccountKey", api.AccountKey)
-		}
-
-		paramrx := regexp.MustCompile(`\{([a-zA-Z0-9]+)\}`)
-		for _, p := range paramrx.FindAllString(uri, -1) {
-			uri = strings.Replace(uri, p, api.Params[strings.Trim(p, "{}")], 1)
+		if len(api.AccountKey) > 0 && !pathParams["AccountKey"] {
+			q.Set("AccountKey", api.AccountKey)
 		}
 
 		req.URL.RawQuery = q.Encode()
@@ -610,7 +761,7 @@ func (api *SaxoAPI) Call(call string) ([]byte, error) {
 	}
 
 	ba, err := io.ReadAll(res.Body)
-	if res.StatusCode != 200 {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
 		//fmt.Println("Error, result body is ", string(ba))
 		return nil, errors.New(fmt.Sprintf("Error: %s %s", res.Status, string(ba)))
 	}
@@ -662,6 +813,11 @@ func (instr *SaxoInstruction) MakeParams(cmd string) map[string]string {
 	if len(instr.AssetTypes) > 0 {
 		params["AssetTypes"] = strings.Join(instr.AssetTypes, ",")
 	}
+	// info prices take a single AssetType
+	if cmd == "prices" && len(instr.AssetTypes) > 0 {
+		delete(params, "AssetTypes")
+		params["AssetType"] = instr.AssetTypes[0]
+	}
 	if len(instr.Class) > 0 {
 		params["Class"] = strings.Join(instr.Class, ",")
 	}
@@ -725,9 +881,14 @@ func (instr *SaxoInstruction) MakeParams(cmd string) map[string]string {
 }
 
 func (api *SaxoAPI) Balance() (*SaxoBalance, error) {
+	if api.Paper != nil {
+		balance := api.Paper.Balance()
+		return &balance, nil
+	}
 	if api.ClientKey == "" {
 		return nil, errors.New("No client key set")
 	}
+	api.Params = map[string]string{"ClientKey": api.ClientKey}
 	data, err := api.Call("balance")
 	if err != nil {
 		return nil, err
@@ -742,6 +903,21 @@ func (api *SaxoAPI) Balance() (*SaxoBalance, error) {
 }
 
 func (api *SaxoAPI) Instruments(instr SaxoInstruction) ([]SaxoAsset, error) {
+	if api.RefCache == nil {
+		return api.instruments(instr)
+	}
+	params := instr.MakeParams("instruments")
+	if cached, ok := api.RefCache.Search(params); ok {
+		return cached, nil
+	}
+	results, err := api.instruments(instr)
+	if err != nil {
+		return nil, err
+	}
+	return results, api.RefCache.PutSearch(params, results)
+}
+
+func (api *SaxoAPI) instruments(instr SaxoInstruction) ([]SaxoAsset, error) {
 	api.Params = instr.MakeParams("instruments")
 	api.Params["$top"] = "1000"
 	data, err := api.Call("instruments")
@@ -761,7 +937,35 @@ func (api *SaxoAPI) Instruments(instr SaxoInstruction) ([]SaxoAsset, error) {
 func (api *SaxoAPI) InstrumentDetails(instr SaxoInstruction) ([]SaxoAssetDetails, error) {
 	if instr.Uic > 0 {
 		instr.Uics = append(instr.Uics, instr.Uic)
+		instr.Uic = 0
+	}
+	// only plain lookups by Uic are served from the cache
+	if api.RefCache == nil || len(instr.Uics) == 0 || len(instr.AssetTypes) > 1 || len(instr.FieldGroups) > 0 {
+		return api.instrumentDetails(instr)
+	}
+	assetType := ""
+	if len(instr.AssetTypes) == 1 {
+		assetType = instr.AssetTypes[0]
+	}
+	var missing []int
+	for _, uic := range instr.Uics {
+		if _, ok := api.RefCache.Details(uic, assetType); !ok {
+			missing = append(missing, uic)
+		}
+	}
+	if err := api.fetchDetails(missing, assetType); err != nil {
+		return nil, err
+	}
+	var details []SaxoAssetDetails
+	for _, uic := range instr.Uics {
+		if list, ok := api.RefCache.Details(uic, assetType); ok {
+			details = append(details, list...)
+		}
 	}
+	return details, nil
+}
+
+func (api *SaxoAPI) instrumentDetails(instr SaxoInstruction) ([]SaxoAssetDetails, error) {
 	api.Params = instr.MakeParams("instrument_details")
 	data, err := api.Call("instrument_details")
 	if err != nil {
@@ -776,24 +980,24 @@ func (api *SaxoAPI) InstrumentDetails(instr SaxoInstruction) ([]SaxoAssetDetails
 }
 
 func (api *SaxoAPI) Prices(instr SaxoInstruction) (*SaxoPrice, error) {
-	api.Params = instr.MakeParams("prices")
-	data, err := api.Call("prices")
+	prices, err := api.priceList(instr)
 	if err != nil {
 		return nil, err
 	}
-	var prices SaxoPrice
-	err = json.Unmarshal(data, &prices)
-	if err != nil {
-		return nil, err
+	if len(prices) == 0 {
+		return nil, errors.New(fmt.Sprintf("No price returned for Uic %d", instr.Uic))
 	}
-	return &prices, nil
+	return &prices[0], nil
 }
 
 func (api *SaxoAPI) NetPositions(instr SaxoInstruction) ([]SaxoNetPosition, error) {
+	if api.Paper != nil {
+		return api.Paper.NetPositions(), nil
+	}
 	if api.ClientKey == "" {
 		return nil, errors.New("No client key set")
 	}
-	api.Params["ClientKey"] = api.ClientKey
+	api.Params = map[string]string{"ClientKey": api.ClientKey}
 	data, err := api.Call("net_positions")
 	if err != nil {
 		return nil, err
@@ -807,28 +1011,72 @@ func (api *SaxoAPI) NetPositions(instr SaxoInstruction) ([]SaxoNetPosition, erro
 }
 
 func (api *SaxoAPI) PlaceOrder(instr SaxoOrderInstruction) ([]SaxoOrder, error) {
+	if api.Journal == nil {
+		return api.placeOrder(instr)
+	}
+	seq, err := api.Journal.RecordIntent(instr)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := api.placeOrder(instr)
+	if jerr := api.Journal.RecordResult(seq, orders, err); jerr != nil && err == nil {
+		err = jerr
+	}
+	return orders, err
+}
+
+func (api *SaxoAPI) placeOrder(instr SaxoOrderInstruction) ([]SaxoOrder, error) {
+	if api.Risk != nil {
+		if err := api.Risk.Check(api, instr); err != nil {
+			return nil, err
+		}
+	}
+	if api.Paper != nil {
+		return api.Paper.PlaceOrder(instr)
+	}
 	if api.ClientKey == "" {
 		return nil, errors.New("No client key set")
 	}
 	api.BodyObject = instr
 	data, err := api.Call("make_order")
+	api.BodyObject = nil
 	if err != nil {
 		fmt.Println(data)
 		return nil, err
 	}
-	var orders SaxoData[SaxoOrder]
+	var orders struct {
+		SaxoData[SaxoOrder]
+		OrderId string
+	}
 	err = json.Unmarshal(data, &orders)
 	if err != nil {
 		return nil, err
 	}
+	// a single order placement only returns the new OrderId
+	if len(orders.Data) == 0 && orders.OrderId != "" {
+		orders.Data = append(orders.Data, SaxoOrder{
+			OrderId:       orders.OrderId,
+			AccountKey:    instr.AccountKey,
+			Amount:        instr.Amount,
+			AssetType:     instr.AssetType,
+			BuySell:       instr.BuySell,
+			Price:         instr.OrderPrice,
+			OpenOrderType: instr.OrderType,
+			Status:        "Working",
+			Uic:           instr.Uic,
+		})
+	}
 	return orders.Data, nil
 }
 
 func (api *SaxoAPI) OrderList() ([]SaxoOrder, error) {
+	if api.Paper != nil {
+		return api.Paper.OrderList(), nil
+	}
 	if api.ClientKey == "" {
 		return nil, errors.New("No client key set")
 	}
-	api.Params["ClientKey"] = api.ClientKey
+	api.Params = map[string]string{"ClientKey": api.ClientKey}
 	data, err := api.Call("order_list")
 	if err != nil {
 		return nil, err
@@ -841,6 +1089,68 @@ func (api *SaxoAPI) OrderList() ([]SaxoOrder, error) {
 	return orders.Data, nil
 }
 
+func (api *SaxoAPI) OrderDetails(orderId string) (*SaxoOrder, error) {
+	if api.Paper != nil {
+		return api.Paper.OrderDetails(orderId)
+	}
+	if api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	api.Params = map[string]string{"OrderId": orderId}
+	data, err := api.Call("order_details")
+	if err != nil {
+		return nil, err
+	}
+	var order SaxoOrder
+	err = json.Unmarshal(data, &order)
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (api *SaxoAPI) OrderActivities(orderId string) ([]SaxoOrderActivity, error) {
+	if api.Paper != nil {
+		return api.Paper.OrderActivities(orderId), nil
+	}
+	if api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	api.Params = map[string]string{"OrderId": orderId, "EntryType": "All"}
+	data, err := api.Call("order_activities")
+	if err != nil {
+		return nil, err
+	}
+	var activities SaxoData[SaxoOrderActivity]
+	err = json.Unmarshal(data, &activities)
+	if err != nil {
+		return nil, err
+	}
+	return activities.Data, nil
+}
+
+func (api *SaxoAPI) CancelOrder(orderId string) error {
+	err := api.cancelOrder(orderId)
+	if api.Journal != nil {
+		if jerr := api.Journal.RecordCancel(orderId, err); jerr != nil && err == nil {
+			err = jerr
+		}
+	}
+	return err
+}
+
+func (api *SaxoAPI) cancelOrder(orderId string) error {
+	if api.Paper != nil {
+		return api.Paper.CancelOrder(orderId)
+	}
+	if api.AccountKey == "" {
+		return errors.New("No account key set")
+	}
+	api.Params = map[string]string{"OrderIds": orderId}
+	_, err := api.Call("cancel_order")
+	return err
+}
+
 func NewSaxoAPICall(loginToken string) *SaxoAPI {
 	return &SaxoAPI{Endpoint: "https://gateway.saxobank.com/sim/openapi/", LoginToken: loginToken, Params: make(map[string]string)}
 }
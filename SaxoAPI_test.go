@@ -0,0 +1,103 @@
+package saxotrader
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type fakeRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   string
+}
+
+// fakeSaxo serves canned responses for the OpenAPI endpoints a test uses.
+// Routes are keyed by method and path, e.g. "GET port/v1/balances".
+type fakeSaxo struct {
+	mu       sync.Mutex
+	routes   map[string]func(r fakeRequest) (int, string)
+	requests []fakeRequest
+}
+
+func newFakeSaxo(t *testing.T) (*SaxoAPI, *fakeSaxo) {
+	f := &fakeSaxo{routes: make(map[string]func(r fakeRequest) (int, string))}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := fakeRequest{Method: r.Method, Path: strings.Trim(r.URL.Path, "/"), Query: r.URL.Query(), Body: string(body)}
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		route, ok := f.routes[req.Method+" "+req.Path]
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		status, resp := route(req)
+		w.WriteHeader(status)
+		io.WriteString(w, resp)
+	}))
+	t.Cleanup(srv.Close)
+	api := NewSaxoAPICall("token")
+	api.Endpoint = srv.URL + "/"
+	api.ClientKey = "client"
+	api.AccountKey = "account"
+	return api, f
+}
+
+func (f *fakeSaxo) handle(route string, fn func(r fakeRequest) (int, string)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[route] = fn
+}
+
+func (f *fakeSaxo) reply(route, body string) {
+	f.handle(route, func(fakeRequest) (int, string) { return http.StatusOK, body })
+}
+
+// calls returns the requests made to route.
+func (f *fakeSaxo) calls(route string) []fakeRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []fakeRequest
+	for _, r := range f.requests {
+		if r.Method+" "+r.Path == route {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func TestPortfolioCallsResetParams(t *testing.T) {
+	tests := []struct {
+		route string
+		call  func(api *SaxoAPI) error
+	}{
+		{"GET port/v1/netpositions/me", func(api *SaxoAPI) error { _, err := api.NetPositions(SaxoInstruction{}); return err }},
+		{"GET port/v1/orders/me", func(api *SaxoAPI) error { _, err := api.OrderList(); return err }},
+		{"GET port/v1/balances", func(api *SaxoAPI) error { _, err := api.Balance(); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			api, fake := newFakeSaxo(t)
+			fake.reply(tt.route, `{"Data":[]}`)
+			// left over from an earlier price request
+			api.Params = map[string]string{"Uics": "21,22", "FieldGroups": "Quote"}
+			if err := tt.call(api); err != nil {
+				t.Fatal(err)
+			}
+			q := fake.calls(tt.route)[0].Query
+			if q.Has("Uics") || q.Has("FieldGroups") {
+				t.Errorf("stale params sent: %v", q)
+			}
+			if q.Get("ClientKey") != "client" {
+				t.Errorf("ClientKey = %q", q.Get("ClientKey"))
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+package saxotrader
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type StateChange[T any] struct {
+	Key     string
+	Value   T
+	Deleted bool
+	Time    time.Time
+}
+
+// StreamState keeps the current value of every entity of a subscription.
+// The snapshot sets the state, and each delta is merged field by field into
+// the stored JSON, nested objects included, so fields missing from a delta
+// keep their last value. Entries marked __meta_deleted are removed.
+//
+// Changes are sent to the Changes channel, which drops its oldest change
+// when the reader falls behind; Dropped counts those. Consumers which must
+// see every change, deletes in particular, set OnChange before the first
+// update instead. It is called in order on the goroutine applying updates,
+// nothing is dropped and Changes is not used.
+type StreamState[T any] struct {
+	Changes  chan StateChange[T]
+	OnChange func(StateChange[T])
+
+	keyFields []string
+	mu        sync.RWMutex
+	raw       map[string]map[string]interface{}
+	values    map[string]T
+	dropped   int
+}
+
+// NewStreamState builds a state keyed by the given top level fields. With no
+// key fields the state holds a single entity, as for balances.
+func NewStreamState[T any](keyFields ...string) *StreamState[T] {
+	return &StreamState[T]{
+		Changes:   make(chan StateChange[T], 1000),
+		keyFields: keyFields,
+		raw:       make(map[string]map[string]interface{}),
+		values:    make(map[string]T),
+	}
+}
+
+func NewPriceState() *StreamState[SaxoPrice] {
+	return NewStreamState[SaxoPrice]("Uic")
+}
+
+func NewOrderState() *StreamState[SaxoOrder] {
+	return NewStreamState[SaxoOrder]("OrderId")
+}
+
+func NewPositionState() *StreamState[SaxoPosition] {
+	return NewStreamState[SaxoPosition]("PositionId")
+}
+
+func NewNetPositionState() *StreamState[SaxoNetPosition] {
+	return NewStreamState[SaxoNetPosition]("NetPositionId")
+}
+
+func NewBalanceState() *StreamState[SaxoBalance] {
+	return NewStreamState[SaxoBalance]()
+}
+
+func decodeRawItems(payload []byte) ([]map[string]interface{}, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var list []interface{}
+	switch x := v.(type) {
+	case []interface{}:
+		list = x
+	case map[string]interface{}:
+		if data, ok := x["Data"].([]interface{}); ok {
+			list = data
+		} else {
+			return []map[string]interface{}{x}, nil
+		}
+	default:
+		return nil, errors.New("Unexpected stream payload")
+	}
+	items := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("Unexpected stream item")
+		}
+		items = append(items, m)
+	}
+	return items, nil
+}
+
+func (st *StreamState[T]) key(item map[string]interface{}) (string, error) {
+	if len(st.keyFields) == 0 {
+		return "", nil
+	}
+	parts := make([]string, 0, len(st.keyFields))
+	for _, f := range st.keyFields {
+		v, ok := item[f]
+		if !ok {
+			return "", errors.New(fmt.Sprintf("Stream item has no %s", f))
+		}
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, "__"), nil
+}
+
+// mergeJSON merges delta into base, recursing into nested objects
+func mergeJSON(base, delta map[string]interface{}) {
+	for k, v := range delta {
+		if dm, ok := v.(map[string]interface{}); ok {
+			if bm, ok := base[k].(map[string]interface{}); ok {
+				mergeJSON(bm, dm)
+				continue
+			}
+			copied := make(map[string]interface{})
+			mergeJSON(copied, dm)
+			base[k] = copied
+			continue
+		}
+		base[k] = v
+	}
+}
+
+func decodeValue[T any](m map[string]interface{}) (T, error) {
+	var v T
+	ba, err := json.Marshal(m)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(ba, &v)
+	return v, err
+}
+
+// ApplySnapshot replaces the whole state. Entities missing from the
+// snapshot are reported as deleted.
+func (st *StreamState[T]) ApplySnapshot(payload []byte) error {
+	items, err := decodeRawItems(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	st.mu.Lock()
+	raw := make(map[string]map[string]interface{})
+	values := make(map[string]T)
+	var changes []StateChange[T]
+	for _, item := range items {
+		k, err := st.key(item)
+		if err != nil {
+			st.mu.Unlock()
+			return err
+		}
+		v, err := decodeValue[T](item)
+		if err != nil {
+			st.mu.Unlock()
+			return err
+		}
+		raw[k] = item
+		values[k] = v
+		changes = append(changes, StateChange[T]{Key: k, Value: v, Time: now})
+	}
+	for k, v := range st.values {
+		if _, ok := values[k]; !ok {
+			changes = append(changes, StateChange[T]{Key: k, Value: v, Deleted: true, Time: now})
+		}
+	}
+	st.raw = raw
+	st.values = values
+	st.mu.Unlock()
+	st.notify(changes)
+	return nil
+}
+
+// ApplyDelta merges a partial update into the state.
+func (st *StreamState[T]) ApplyDelta(payload []byte) error {
+	items, err := decodeRawItems(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	st.mu.Lock()
+	var changes []StateChange[T]
+	for _, item := range items {
+		k, err := st.key(item)
+		if err != nil {
+			st.mu.Unlock()
+			return err
+		}
+		if deleted, _ := item["__meta_deleted"].(bool); deleted {
+			if old, ok := st.values[k]; ok {
+				delete(st.raw, k)
+				delete(st.values, k)
+				changes = append(changes, StateChange[T]{Key: k, Value: old, Deleted: true, Time: now})
+			}
+			continue
+		}
+		base, ok := st.raw[k]
+		if !ok {
+			base = make(map[string]interface{})
+			st.raw[k] = base
+		}
+		mergeJSON(base, item)
+		v, err := decodeValue[T](base)
+		if err != nil {
+			st.mu.Unlock()
+			return err
+		}
+		st.values[k] = v
+		changes = append(changes, StateChange[T]{Key: k, Value: v, Time: now})
+	}
+	st.mu.Unlock()
+	st.notify(changes)
+	return nil
+}
+
+func (st *StreamState[T]) Apply(update StreamUpdate[T]) error {
+	if update.Snapshot {
+		return st.ApplySnapshot(update.Raw)
+	}
+	return st.ApplyDelta(update.Raw)
+}
+
+// Follow applies every update of the subscription until it is closed, and
+// then closes Changes. It returns Changes, which readers should range over
+// instead of the field, as the field is cleared under the lock on close.
+// Merge errors and dropped changes are reported to errs when it is not nil.
+func (st *StreamState[T]) Follow(sub *Subscription[T], errs chan<- error) <-chan StateChange[T] {
+	st.mu.RLock()
+	changes := st.Changes
+	st.mu.RUnlock()
+	report := func(err error) {
+		if errs == nil {
+			return
+		}
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+	go func() {
+		for update := range sub.Updates {
+			dropped := st.Dropped()
+			if err := st.Apply(update); err != nil {
+				report(err)
+			}
+			if n := st.Dropped() - dropped; n > 0 {
+				report(errors.New(fmt.Sprintf("Stream state dropped %d changes for a slow reader", n)))
+			}
+		}
+		st.mu.Lock()
+		ch := st.Changes
+		st.Changes = nil
+		st.mu.Unlock()
+		if ch != nil {
+			close(ch)
+		}
+	}()
+	return changes
+}
+
+func (st *StreamState[T]) Get(key string) (T, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	v, ok := st.values[key]
+	return v, ok
+}
+
+// Snapshot returns a consistent copy of the whole state.
+func (st *StreamState[T]) Snapshot() map[string]T {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	snap := make(map[string]T, len(st.values))
+	for k, v := range st.values {
+		snap[k] = v
+	}
+	return snap
+}
+
+func (st *StreamState[T]) Keys() []string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	keys := make([]string, 0, len(st.values))
+	for k := range st.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Dropped is the number of changes lost because Changes was full.
+func (st *StreamState[T]) Dropped() int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.dropped
+}
+
+func (st *StreamState[T]) notify(changes []StateChange[T]) {
+	if st.OnChange != nil {
+		for _, c := range changes {
+			st.OnChange(c)
+		}
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.Changes == nil {
+		return
+	}
+	for _, c := range changes {
+		select {
+		case st.Changes <- c:
+			continue
+		default:
+		}
+		// make room by dropping the oldest change
+		select {
+		case <-st.Changes:
+			st.dropped++
+		default:
+		}
+		select {
+		case st.Changes <- c:
+		default:
+			st.dropped++
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package saxotrader
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func priceDelta(raw string) StreamUpdate[SaxoPrice] {
+	return StreamUpdate[SaxoPrice]{Raw: []byte(raw)}
+}
+
+func TestStreamStateMerge(t *testing.T) {
+	snapshot := `{"Data":[{"Uic":21,"AssetType":"FxSpot","Quote":{"BidPrice":1.1,"AskPrice":1.2,"MarketState":"Open"}},{"Uic":22,"AssetType":"FxSpot","Quote":{"Mid":5}}]}`
+	tests := []struct {
+		name    string
+		updates []StreamUpdate[SaxoPrice]
+		want    map[string]SaxoQuote
+		deleted []string
+	}{
+		{
+			name: "snapshot only",
+			want: map[string]SaxoQuote{"21": {BidPrice: 1.1, AskPrice: 1.2, MarketState: "Open"}, "22": {Mid: 5}},
+		},
+		{
+			name:    "nested fields missing from a delta are kept",
+			updates: []StreamUpdate[SaxoPrice]{priceDelta(`[{"Uic":21,"Quote":{"BidPrice":1.15}}]`)},
+			want:    map[string]SaxoQuote{"21": {BidPrice: 1.15, AskPrice: 1.2, MarketState: "Open"}, "22": {Mid: 5}},
+		},
+		{
+			name:    "deltas apply in order",
+			updates: []StreamUpdate[SaxoPrice]{priceDelta(`[{"Uic":21,"Quote":{"AskPrice":1.3}}]`), priceDelta(`[{"Uic":21,"Quote":{"AskPrice":1.25,"MarketState":"Closed"}}]`)},
+			want:    map[string]SaxoQuote{"21": {BidPrice: 1.1, AskPrice: 1.25, MarketState: "Closed"}, "22": {Mid: 5}},
+		},
+		{
+			name:    "new entity from a delta",
+			updates: []StreamUpdate[SaxoPrice]{priceDelta(`[{"Uic":23,"Quote":{"Mid":7}}]`)},
+			want:    map[string]SaxoQuote{"21": {BidPrice: 1.1, AskPrice: 1.2, MarketState: "Open"}, "22": {Mid: 5}, "23": {Mid: 7}},
+		},
+		{
+			name:    "deleted entity",
+			updates: []StreamUpdate[SaxoPrice]{priceDelta(`[{"Uic":22,"__meta_deleted":true}]`)},
+			want:    map[string]SaxoQuote{"21": {BidPrice: 1.1, AskPrice: 1.2, MarketState: "Open"}},
+			deleted: []string{"22"},
+		},
+		{
+			name:    "snapshot drops missing entities",
+			updates: []StreamUpdate[SaxoPrice]{{Snapshot: true, Raw: []byte(`[{"Uic":22,"Quote":{"Mid":6}}]`)}},
+			want:    map[string]SaxoQuote{"22": {Mid: 6}},
+			deleted: []string{"21"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewPriceState()
+			if err := st.ApplySnapshot([]byte(snapshot)); err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range tt.updates {
+				if err := st.Apply(u); err != nil {
+					t.Fatal(err)
+				}
+			}
+			snap := st.Snapshot()
+			if len(snap) != len(tt.want) {
+				t.Fatalf("state has keys %v, want %d entries", st.Keys(), len(tt.want))
+			}
+			for k, q := range tt.want {
+				p, ok := st.Get(k)
+				if !ok {
+					t.Fatalf("no entry %s", k)
+				}
+				if p.Quote != q {
+					t.Errorf("entry %s quote = %+v, want %+v", k, p.Quote, q)
+				}
+			}
+			var deleted []string
+			for len(st.Changes) > 0 {
+				if c := <-st.Changes; c.Deleted {
+					deleted = append(deleted, c.Key)
+				}
+			}
+			if len(deleted) != len(tt.deleted) || (len(deleted) > 0 && deleted[0] != tt.deleted[0]) {
+				t.Errorf("deleted %v, want %v", deleted, tt.deleted)
+			}
+		})
+	}
+}
+
+func TestStreamStateSingleEntity(t *testing.T) {
+	st := NewBalanceState()
+	if err := st.ApplySnapshot([]byte(`{"CashBalance":100,"Currency":"EUR"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.ApplyDelta([]byte(`{"CashBalance":90}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, ok := st.Get("")
+	if !ok || b.CashBalance != 90 || b.Currency != "EUR" {
+		t.Errorf("balance = %+v, want 90 EUR", b)
+	}
+}
+
+func TestStreamStateErrors(t *testing.T) {
+	st := NewPriceState()
+	tests := []string{`[{"AssetType":"FxSpot"}]`, `"text"`, `[1]`, `{`}
+	for _, payload := range tests {
+		if err := st.ApplyDelta([]byte(payload)); err == nil {
+			t.Errorf("ApplyDelta(%s) did not fail", payload)
+		}
+	}
+}
+
+func TestStreamStateFollow(t *testing.T) {
+	st := NewPriceState()
+	sub := &Subscription[SaxoPrice]{Updates: make(chan StreamUpdate[SaxoPrice], 2)}
+	changes := st.Follow(sub, nil)
+	sub.Updates <- StreamUpdate[SaxoPrice]{Snapshot: true, Raw: []byte(`[{"Uic":21,"Quote":{"Mid":1}}]`)}
+	sub.Updates <- StreamUpdate[SaxoPrice]{Raw: []byte(`[{"Uic":21,"Quote":{"Mid":2}}]`)}
+	close(sub.Updates)
+	var mids []float64
+	for c := range changes {
+		mids = append(mids, c.Value.Quote.Mid)
+	}
+	if len(mids) != 2 || mids[0] != 1 || mids[1] != 2 {
+		t.Errorf("changes %v, want [1 2]", mids)
+	}
+}
+
+func TestStreamStateOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		updates  int
+		keys     []string
+		dropped  int
+	}{
+		{name: "room for every change", capacity: 4, updates: 3, keys: []string{"1", "2", "3"}},
+		{name: "oldest changes are dropped", capacity: 2, updates: 5, keys: []string{"4", "5"}, dropped: 3},
+		{name: "no channel", updates: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewPriceState()
+			st.Changes = nil
+			if tt.capacity > 0 {
+				st.Changes = make(chan StateChange[SaxoPrice], tt.capacity)
+			}
+			for i := 1; i <= tt.updates; i++ {
+				if err := st.ApplyDelta([]byte(fmt.Sprintf(`[{"Uic":%d}]`, i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var keys []string
+			for len(st.Changes) > 0 {
+				keys = append(keys, (<-st.Changes).Key)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(tt.keys) {
+				t.Errorf("changes %v, want %v", keys, tt.keys)
+			}
+			if st.Dropped() != tt.dropped {
+				t.Errorf("Dropped = %d, want %d", st.Dropped(), tt.dropped)
+			}
+		})
+	}
+}
+
+func TestStreamStateFollowReportsDrops(t *testing.T) {
+	st := NewPriceState()
+	st.Changes = make(chan StateChange[SaxoPrice], 1)
+	sub := &Subscription[SaxoPrice]{Updates: make(chan StreamUpdate[SaxoPrice], 1)}
+	errs := make(chan error, 1)
+	changes := st.Follow(sub, errs)
+	sub.Updates <- priceDelta(`[{"Uic":21},{"Uic":22}]`)
+	close(sub.Updates)
+	// nothing reads changes until the drop is reported
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "dropped 1 changes") {
+			t.Errorf("reported %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("dropped change was not reported")
+	}
+	if c := <-changes; c.Key != "22" {
+		t.Errorf("kept change %s, want the newest", c.Key)
+	}
+}
+
+func TestStreamStateOnChangeIsLossless(t *testing.T) {
+	st := NewPriceState()
+	var got []StateChange[SaxoPrice]
+	st.OnChange = func(c StateChange[SaxoPrice]) { got = append(got, c) }
+	sub := &Subscription[SaxoPrice]{Updates: make(chan StreamUpdate[SaxoPrice], 2001)}
+	for i := 1; i <= 2000; i++ {
+		sub.Updates <- priceDelta(fmt.Sprintf(`[{"Uic":%d}]`, i))
+	}
+	sub.Updates <- priceDelta(`[{"Uic":1,"__meta_deleted":true}]`)
+	close(sub.Updates)
+	for range st.Follow(sub, nil) {
+		t.Error("change sent to the channel as well as OnChange")
+	}
+	if len(got) != 2001 || !got[2000].Deleted || got[2000].Key != "1" {
+		t.Fatalf("got %d changes, last %+v", len(got), got[len(got)-1])
+	}
+	if st.Dropped() != 0 {
+		t.Errorf("Dropped = %d", st.Dropped())
+	}
+}
@@ -0,0 +1,693 @@
+package saxotrader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const DefaultStreamingURL = "wss://streaming.saxobank.com/sim/openapi/streamingws/connect"
+
+// StreamMessage is one decoded message from the streaming connection.
+type StreamMessage struct {
+	MessageId     uint64
+	ReferenceId   string
+	PayloadFormat byte
+	Payload       []byte
+}
+
+// ParseStreamMessages splits a binary websocket frame into the Saxo
+// messages it carries.
+func ParseStreamMessages(frame []byte) ([]StreamMessage, error) {
+	var messages []StreamMessage
+	pos := 0
+	for pos < len(frame) {
+		if len(frame)-pos < 11 {
+			return messages, errors.New("Truncated stream message header")
+		}
+		msg := StreamMessage{MessageId: binary.LittleEndian.Uint64(frame[pos:])}
+		pos += 10 // message id and two reserved bytes
+		refLen := int(frame[pos])
+		pos++
+		if len(frame)-pos < refLen+5 {
+			return messages, errors.New("Truncated stream message reference")
+		}
+		msg.ReferenceId = string(frame[pos : pos+refLen])
+		pos += refLen
+		msg.PayloadFormat = frame[pos]
+		pos++
+		size := int(binary.LittleEndian.Uint32(frame[pos:]))
+		pos += 4
+		if len(frame)-pos < size {
+			return messages, errors.New("Truncated stream message payload")
+		}
+		msg.Payload = frame[pos : pos+size]
+		pos += size
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// StreamUpdate carries either the snapshot returned when a subscription is
+// created (Snapshot set) or a delta from the stream. Deltas only hold the
+// fields that changed; Raw keeps the payload for merging.
+type StreamUpdate[T any] struct {
+	ReferenceId string
+	MessageId   uint64
+	Snapshot    bool
+	Data        []T
+	Raw         json.RawMessage
+	Time        time.Time
+}
+
+type streamSubscription interface {
+	referenceId() string
+	create(s *Streamer) error
+	remove(s *Streamer) error
+	deliver(msg StreamMessage) error
+	heartbeat(reason string)
+	closeUpdates()
+}
+
+// Subscription is a live Saxo subscription delivering typed updates.
+type Subscription[T any] struct {
+	Updates chan StreamUpdate[T]
+
+	subscribeCall   string
+	unsubscribeCall string
+	arguments       map[string]interface{}
+	refreshRate     int
+	streamer        *Streamer
+
+	mu            sync.Mutex
+	reference     string
+	lastHeartbeat time.Time
+	lastReason    string
+	closed        bool
+}
+
+func (sub *Subscription[T]) ReferenceId() string {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.reference
+}
+
+func (sub *Subscription[T]) referenceId() string {
+	return sub.ReferenceId()
+}
+
+// LastHeartbeat reports when the server last said there was no new data,
+// and why.
+func (sub *Subscription[T]) LastHeartbeat() (time.Time, string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.lastHeartbeat, sub.lastReason
+}
+
+func (sub *Subscription[T]) Unsubscribe() error {
+	return sub.streamer.unsubscribe(sub)
+}
+
+// create registers the subscription under a fresh reference id before
+// asking Saxo for it, so no early delta is dropped.
+func (sub *Subscription[T]) create(s *Streamer) error {
+	ref := s.newReferenceId()
+	sub.mu.Lock()
+	sub.reference = ref
+	sub.mu.Unlock()
+	if !s.register(ref, sub) {
+		return errors.New("Streamer is closed")
+	}
+	body := map[string]interface{}{
+		"ContextId":   s.ContextId,
+		"ReferenceId": ref,
+		"Arguments":   sub.arguments,
+	}
+	if sub.refreshRate > 0 {
+		body["RefreshRate"] = sub.refreshRate
+	}
+	data, err := s.call(sub.subscribeCall, nil, body)
+	if err != nil {
+		s.unregister(ref)
+		return err
+	}
+	var resp struct {
+		ReferenceId string
+		Snapshot    json.RawMessage
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return sub.abandon(s, err)
+	}
+
+	update := StreamUpdate[T]{ReferenceId: ref, Snapshot: true, Raw: resp.Snapshot, Time: time.Now()}
+	update.Data, err = decodeStreamData[T](resp.Snapshot)
+	if err != nil {
+		return sub.abandon(s, err)
+	}
+	sub.send(update)
+	return nil
+}
+
+// abandon drops a subscription whose snapshot could not be read, so no
+// later delta reaches it, and asks Saxo to remove it. err is returned.
+func (sub *Subscription[T]) abandon(s *Streamer, err error) error {
+	s.unregister(sub.ReferenceId())
+	sub.remove(s)
+	return err
+}
+
+func (sub *Subscription[T]) remove(s *Streamer) error {
+	ref := sub.ReferenceId()
+	if ref == "" {
+		return nil
+	}
+	_, err := s.call(sub.unsubscribeCall, map[string]string{"ContextId": s.ContextId, "ReferenceId": ref}, nil)
+	return err
+}
+
+func (sub *Subscription[T]) deliver(msg StreamMessage) error {
+	if msg.PayloadFormat != 0 {
+		return errors.New(fmt.Sprintf("Unsupported payload format %d on %s", msg.PayloadFormat, msg.ReferenceId))
+	}
+	data, err := decodeStreamData[T](msg.Payload)
+	if err != nil {
+		return err
+	}
+	raw := make(json.RawMessage, len(msg.Payload))
+	copy(raw, msg.Payload)
+	sub.send(StreamUpdate[T]{ReferenceId: msg.ReferenceId, MessageId: msg.MessageId, Data: data, Raw: raw, Time: time.Now()})
+	return nil
+}
+
+func (sub *Subscription[T]) heartbeat(reason string) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.lastHeartbeat = time.Now()
+	sub.lastReason = reason
+}
+
+func (sub *Subscription[T]) send(update StreamUpdate[T]) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	select {
+	case sub.Updates <- update:
+	default:
+		// a slow reader loses the oldest update rather than stalling the stream
+		select {
+		case <-sub.Updates:
+		default:
+		}
+		sub.Updates <- update
+	}
+}
+
+func (sub *Subscription[T]) closeUpdates() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if !sub.closed {
+		sub.closed = true
+		close(sub.Updates)
+	}
+}
+
+// decodeStreamData accepts a list snapshot ({"Data":[...]}), an array of
+// deltas or a single object.
+func decodeStreamData[T any](payload []byte) ([]T, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		return nil, nil
+	}
+	if payload[0] == '[' {
+		var list []T
+		err := json.Unmarshal(payload, &list)
+		return list, err
+	}
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, err
+	}
+	if data, ok := probe["Data"]; ok {
+		var list []T
+		err := json.Unmarshal(data, &list)
+		return list, err
+	}
+	var one T
+	if err := json.Unmarshal(payload, &one); err != nil {
+		return nil, err
+	}
+	return []T{one}, nil
+}
+
+// Streamer holds a websocket connection to the Saxo streaming service and
+// the subscriptions delivered over it. Lost connections are re-established
+// and every subscription is created again.
+type Streamer struct {
+	URL       string
+	ContextId string
+	Errors    chan error
+
+	// ReadTimeout bounds the wait for any message, heartbeats, pings and
+	// pongs included, before the connection is treated as lost. The
+	// connection is pinged well within it so an idle one stays open.
+	ReadTimeout  time.Duration
+	MaxReconnect time.Duration
+
+	api      *SaxoAPI
+	apiMu    sync.Mutex
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	subs     map[string]streamSubscription
+	lastId   uint64
+	nextRef  int
+	closed   bool
+	done     chan struct{}
+	stopping chan struct{}
+}
+
+// NewStreamer prepares a streamer using the token and keys of api. The
+// streamer works on its own copy of api so subscription calls do not
+// interfere with other requests.
+func NewStreamer(api *SaxoAPI) *Streamer {
+	clone := *api
+	clone.Params = make(map[string]string)
+	clone.BodyObject = nil
+	clone.Body = nil
+	return &Streamer{
+		URL:          DefaultStreamingURL,
+		ContextId:    fmt.Sprintf("ctx%d%04d", time.Now().Unix(), rand.Intn(10000)),
+		Errors:       make(chan error, 10),
+		ReadTimeout:  30 * time.Second,
+		MaxReconnect: 30 * time.Second,
+		api:          &clone,
+		subs:         make(map[string]streamSubscription),
+	}
+}
+
+func (s *Streamer) newReferenceId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextRef++
+	return "ref" + strconv.Itoa(s.nextRef)
+}
+
+func (s *Streamer) call(name string, params map[string]string, body interface{}) ([]byte, error) {
+	s.apiMu.Lock()
+	defer s.apiMu.Unlock()
+	s.api.Params = params
+	if s.api.Params == nil {
+		s.api.Params = make(map[string]string)
+	}
+	s.api.BodyObject = body
+	data, err := s.api.Call(name)
+	s.api.BodyObject = nil
+	return data, err
+}
+
+func (s *Streamer) dial() (*websocket.Conn, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("contextId", s.ContextId)
+	s.mu.Lock()
+	if s.lastId > 0 {
+		q.Set("messageid", strconv.FormatUint(s.lastId, 10))
+	}
+	s.mu.Unlock()
+	u.RawQuery = q.Encode()
+	header := http.Header{}
+	s.apiMu.Lock()
+	header.Add("Authorization", fmt.Sprintf("Bearer %s", s.api.LoginToken))
+	s.apiMu.Unlock()
+	conn, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+	return conn, err
+}
+
+// Connect opens the websocket and starts reading messages.
+func (s *Streamer) Connect() error {
+	conn, err := s.dial()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.conn = conn
+	s.closed = false
+	s.done = make(chan struct{})
+	s.stopping = make(chan struct{})
+	done, stopping := s.done, s.stopping
+	s.mu.Unlock()
+	go s.run(conn, done, stopping)
+	return nil
+}
+
+// Close removes all subscriptions and closes the connection.
+func (s *Streamer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	subs := s.subs
+	s.subs = make(map[string]streamSubscription)
+	conn, done, stopping := s.conn, s.done, s.stopping
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, sub := range subs {
+		if err := sub.remove(s); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		sub.closeUpdates()
+	}
+	if stopping != nil {
+		close(stopping)
+	}
+	if conn != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		conn.Close()
+	}
+	if done != nil {
+		<-done
+	}
+	return firstErr
+}
+
+// UpdateToken re-authorizes the streaming connection after the login token
+// has been refreshed.
+func (s *Streamer) UpdateToken(token string) error {
+	s.apiMu.Lock()
+	s.api.LoginToken = token
+	s.apiMu.Unlock()
+	_, err := s.call("streaming_authorize", map[string]string{"ContextId": s.ContextId}, nil)
+	return err
+}
+
+func (s *Streamer) reportError(err error) {
+	select {
+	case s.Errors <- err:
+	default:
+	}
+}
+
+func (s *Streamer) run(conn *websocket.Conn, done, stopping chan struct{}) {
+	defer close(done)
+	backoff := time.Second
+	for {
+		err := s.read(conn)
+		select {
+		case <-stopping:
+			return
+		default:
+		}
+		s.reportError(err)
+		conn.Close()
+		for {
+			select {
+			case <-stopping:
+				return
+			case <-time.After(backoff):
+			}
+			conn, err = s.dial()
+			if err == nil {
+				break
+			}
+			s.reportError(err)
+			backoff *= 2
+			if backoff > s.MaxReconnect {
+				backoff = s.MaxReconnect
+			}
+		}
+		backoff = time.Second
+		s.mu.Lock()
+		s.conn = conn
+		s.mu.Unlock()
+		s.resubscribe(nil)
+	}
+}
+
+func (s *Streamer) read(conn *websocket.Conn) error {
+	if s.ReadTimeout > 0 {
+		extend := func() {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		conn.SetPongHandler(func(string) error {
+			extend()
+			return nil
+		})
+		conn.SetPingHandler(func(data string) error {
+			extend()
+			err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+			if err == websocket.ErrCloseSent {
+				return nil
+			}
+			return err
+		})
+		stop := make(chan struct{})
+		defer close(stop)
+		go keepAlive(conn, s.ReadTimeout/3, stop)
+	}
+	for {
+		// data frames, heartbeats among them, extend the deadline here
+		if s.ReadTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+		kind, frame, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		messages, err := ParseStreamMessages(frame)
+		if err != nil {
+			s.reportError(err)
+		}
+		for _, msg := range messages {
+			if err := s.dispatch(msg); err != nil {
+				if errors.Is(err, errStreamDisconnect) {
+					return err
+				}
+				s.reportError(err)
+			}
+		}
+	}
+}
+
+// keepAlive pings the server until stop is closed. Write errors are left
+// for the reader to notice.
+func keepAlive(conn *websocket.Conn, interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(interval))
+		}
+	}
+}
+
+var errStreamDisconnect = errors.New("Streaming server requested disconnect")
+
+func (s *Streamer) dispatch(msg StreamMessage) error {
+	s.mu.Lock()
+	if msg.MessageId > s.lastId {
+		s.lastId = msg.MessageId
+	}
+	sub := s.subs[msg.ReferenceId]
+	s.mu.Unlock()
+
+	switch msg.ReferenceId {
+	case "_heartbeat":
+		var beats []struct {
+			Heartbeats []struct {
+				OriginatingReferenceId string
+				Reason                 string
+			}
+		}
+		if err := json.Unmarshal(msg.Payload, &beats); err != nil {
+			return err
+		}
+		for _, b := range beats {
+			for _, h := range b.Heartbeats {
+				s.mu.Lock()
+				target := s.subs[h.OriginatingReferenceId]
+				s.mu.Unlock()
+				if target != nil {
+					target.heartbeat(h.Reason)
+				}
+			}
+		}
+		return nil
+	case "_resetsubscriptions":
+		var reset struct {
+			TargetReferenceIds []string
+		}
+		if err := json.Unmarshal(msg.Payload, &reset); err != nil {
+			return err
+		}
+		go s.resubscribe(reset.TargetReferenceIds)
+		return nil
+	case "_disconnect":
+		return errStreamDisconnect
+	}
+	if sub == nil {
+		return nil
+	}
+	return sub.deliver(msg)
+}
+
+// resubscribe removes and recreates the given subscriptions, or all of them
+// when refs is empty.
+func (s *Streamer) resubscribe(refs []string) {
+	s.mu.Lock()
+	var targets []streamSubscription
+	if len(refs) == 0 {
+		for ref, sub := range s.subs {
+			targets = append(targets, sub)
+			delete(s.subs, ref)
+		}
+	} else {
+		for _, ref := range refs {
+			if sub, ok := s.subs[ref]; ok {
+				targets = append(targets, sub)
+				delete(s.subs, ref)
+			}
+		}
+	}
+	s.mu.Unlock()
+	for _, sub := range targets {
+		sub.remove(s)
+		if err := sub.create(s); err != nil {
+			// keep it registered so the next reset or reconnect retries it
+			s.register(sub.referenceId(), sub)
+			s.reportError(err)
+		}
+	}
+}
+
+func (s *Streamer) register(ref string, sub streamSubscription) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.subs[ref] = sub
+	return true
+}
+
+func (s *Streamer) unregister(ref string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, ref)
+}
+
+func (s *Streamer) add(sub streamSubscription) error {
+	return sub.create(s)
+}
+
+func (s *Streamer) unsubscribe(sub streamSubscription) error {
+	s.mu.Lock()
+	ref := sub.referenceId()
+	_, ok := s.subs[ref]
+	delete(s.subs, ref)
+	s.mu.Unlock()
+	if !ok {
+		return errors.New(fmt.Sprintf("No subscription %s", ref))
+	}
+	err := sub.remove(s)
+	sub.closeUpdates()
+	return err
+}
+
+func newSubscription[T any](s *Streamer, subscribe, unsubscribe string, args map[string]interface{}, refreshRate int) *Subscription[T] {
+	return &Subscription[T]{
+		Updates:         make(chan StreamUpdate[T], 1000),
+		subscribeCall:   subscribe,
+		unsubscribeCall: unsubscribe,
+		arguments:       args,
+		refreshRate:     refreshRate,
+		streamer:        s,
+	}
+}
+
+func (s *Streamer) portfolioArguments(fieldGroups []string) map[string]interface{} {
+	args := map[string]interface{}{"ClientKey": s.api.ClientKey}
+	if s.api.AccountKey != "" {
+		args["AccountKey"] = s.api.AccountKey
+	}
+	if len(fieldGroups) > 0 {
+		args["FieldGroups"] = fieldGroups
+	}
+	return args
+}
+
+func (s *Streamer) SubscribePrices(uics []int, assetType string, fieldGroups []string, refreshRate int) (*Subscription[SaxoPrice], error) {
+	var strs []string
+	for _, u := range uics {
+		strs = append(strs, strconv.Itoa(u))
+	}
+	if len(fieldGroups) == 0 {
+		fieldGroups = []string{"Quote", "DisplayAndFormat"}
+	}
+	args := map[string]interface{}{
+		"Uics":        strings.Join(strs, ","),
+		"AssetType":   assetType,
+		"FieldGroups": fieldGroups,
+	}
+	sub := newSubscription[SaxoPrice](s, "price_subscribe", "price_unsubscribe", args, refreshRate)
+	return sub, s.add(sub)
+}
+
+func (s *Streamer) SubscribeOrders(refreshRate int) (*Subscription[SaxoOrder], error) {
+	if s.api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	args := s.portfolioArguments([]string{"DisplayAndFormat", "ExchangeInfo"})
+	sub := newSubscription[SaxoOrder](s, "order_subscribe", "order_unsubscribe", args, refreshRate)
+	return sub, s.add(sub)
+}
+
+func (s *Streamer) SubscribePositions(refreshRate int) (*Subscription[SaxoPosition], error) {
+	if s.api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	args := s.portfolioArguments([]string{"PositionBase", "PositionView", "DisplayAndFormat"})
+	sub := newSubscription[SaxoPosition](s, "position_subscribe", "position_unsubscribe", args, refreshRate)
+	return sub, s.add(sub)
+}
+
+func (s *Streamer) SubscribeNetPositions(refreshRate int) (*Subscription[SaxoNetPosition], error) {
+	if s.api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	args := s.portfolioArguments([]string{"NetPositionBase", "NetPositionView", "DisplayAndFormat"})
+	sub := newSubscription[SaxoNetPosition](s, "net_position_subscribe", "net_position_unsubscribe", args, refreshRate)
+	return sub, s.add(sub)
+}
+
+func (s *Streamer) SubscribeBalance(refreshRate int) (*Subscription[SaxoBalance], error) {
+	if s.api.ClientKey == "" {
+		return nil, errors.New("No client key set")
+	}
+	args := s.portfolioArguments(nil)
+	sub := newSubscription[SaxoBalance](s, "balance_subscribe", "balance_unsubscribe", args, refreshRate)
+	return sub, s.add(sub)
+}
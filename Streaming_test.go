@@ -0,0 +1,112 @@
+package saxotrader
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// encodeStreamMessage builds one message in the Saxo binary frame layout.
+func encodeStreamMessage(id uint64, ref string, format byte, payload string) []byte {
+	ba := make([]byte, 10, 16+len(ref)+len(payload))
+	binary.LittleEndian.PutUint64(ba, id)
+	ba = append(ba, byte(len(ref)))
+	ba = append(ba, ref...)
+	ba = append(ba, format)
+	ba = binary.LittleEndian.AppendUint32(ba, uint32(len(payload)))
+	return append(ba, payload...)
+}
+
+func TestParseStreamMessages(t *testing.T) {
+	first := encodeStreamMessage(1, "prices", 0, `[{"Uic":21,"Quote":{"Mid":1.1}}]`)
+	second := encodeStreamMessage(258, "_heartbeat", 0, `[{"ReferenceId":"_heartbeat"}]`)
+	tests := []struct {
+		name    string
+		frame   []byte
+		want    []StreamMessage
+		wantErr bool
+	}{
+		{name: "empty frame"},
+		{
+			name:  "one message",
+			frame: first,
+			want:  []StreamMessage{{MessageId: 1, ReferenceId: "prices", Payload: []byte(`[{"Uic":21,"Quote":{"Mid":1.1}}]`)}},
+		},
+		{
+			name:  "two messages",
+			frame: append(append([]byte{}, first...), second...),
+			want: []StreamMessage{
+				{MessageId: 1, ReferenceId: "prices", Payload: []byte(`[{"Uic":21,"Quote":{"Mid":1.1}}]`)},
+				{MessageId: 258, ReferenceId: "_heartbeat", Payload: []byte(`[{"ReferenceId":"_heartbeat"}]`)},
+			},
+		},
+		{
+			name:  "empty payload and protobuf format",
+			frame: encodeStreamMessage(7, "r", 1, ""),
+			want:  []StreamMessage{{MessageId: 7, ReferenceId: "r", PayloadFormat: 1, Payload: []byte{}}},
+		},
+		{
+			name:    "truncated header",
+			frame:   first[:9],
+			wantErr: true,
+		},
+		{
+			name:    "truncated reference",
+			frame:   first[:14],
+			wantErr: true,
+		},
+		{
+			name:    "truncated payload keeps the messages before it",
+			frame:   append(append([]byte{}, first...), second[:len(second)-1]...),
+			want:    []StreamMessage{{MessageId: 1, ReferenceId: "prices", Payload: []byte(`[{"Uic":21,"Quote":{"Mid":1.1}}]`)}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStreamMessages(tt.frame)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d messages, want %d", len(got), len(tt.want))
+			}
+			for i, m := range got {
+				w := tt.want[i]
+				if m.MessageId != w.MessageId || m.ReferenceId != w.ReferenceId || m.PayloadFormat != w.PayloadFormat || string(m.Payload) != string(w.Payload) {
+					t.Errorf("message %d = %+v, want %+v", i, m, w)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscribeBadSnapshotUnregisters(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"bad response", `not json`},
+		{"bad snapshot", `{"ReferenceId":"x","Snapshot":{"Data":"none"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, fake := newFakeSaxo(t)
+			fake.reply("POST trade/v1/infoprices/subscriptions", tt.body)
+			fake.reply("DELETE trade/v1/infoprices/subscriptions/ctx/ref1", ``)
+			s := NewStreamer(api)
+			s.ContextId = "ctx"
+			if _, err := s.SubscribePrices([]int{21}, "FxSpot", nil, 0); err == nil {
+				t.Fatal("SubscribePrices with a bad snapshot did not fail")
+			}
+			s.mu.Lock()
+			n := len(s.subs)
+			s.mu.Unlock()
+			if n != 0 {
+				t.Errorf("%d subscriptions still registered", n)
+			}
+			if got := fake.calls("DELETE trade/v1/infoprices/subscriptions/ctx/ref1"); len(got) != 1 {
+				t.Errorf("%d removals, want 1", len(got))
+			}
+		})
+	}
+}
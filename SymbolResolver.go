@@ -0,0 +1,176 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// AmbiguousSymbolError is returned when a query matches several
+// instruments and none is clearly the primary listing.
+type AmbiguousSymbolError struct {
+	Query      string
+	AssetType  string
+	Candidates []SaxoAsset
+}
+
+func (e *AmbiguousSymbolError) Error() string {
+	list := make([]string, len(e.Candidates))
+	for i, c := range e.Candidates {
+		list[i] = fmt.Sprintf("%s (Uic %d, %s, %s)", c.Symbol, c.Identifier, c.AssetType, c.ExchangeId)
+	}
+	return fmt.Sprintf("Symbol %s is ambiguous: %s", e.Query, strings.Join(list, ", "))
+}
+
+var isinrx = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+
+// SymbolResolver turns a ticker with exchange (AAPL:xnas), a bare ticker,
+// an ISIN or an FX pair (EURUSD) into a single instrument. Resolutions are
+// remembered, and kept in the file at Path when it is set.
+type SymbolResolver struct {
+	Path string
+
+	api      *SaxoAPI
+	mu       sync.Mutex
+	resolved map[string]SaxoAsset
+}
+
+func NewSymbolResolver(api *SaxoAPI, path string) (*SymbolResolver, error) {
+	r := &SymbolResolver{Path: path, api: api, resolved: make(map[string]SaxoAsset)}
+	if path == "" {
+		return r, nil
+	}
+	ba, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(ba, &r.resolved); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func resolverKey(query, assetType string) string {
+	return strings.ToUpper(query) + "|" + assetType
+}
+
+// Resolve returns the instrument for query. assetType may be empty to
+// search all asset types.
+func (r *SymbolResolver) Resolve(query, assetType string) (SaxoAsset, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return SaxoAsset{}, errors.New("Empty symbol")
+	}
+	key := resolverKey(query, assetType)
+	r.mu.Lock()
+	if a, ok := r.resolved[key]; ok {
+		r.mu.Unlock()
+		return a, nil
+	}
+	r.mu.Unlock()
+
+	instr := SaxoInstruction{Keywords: query}
+	if assetType != "" {
+		instr.AssetTypes = []string{assetType}
+	}
+	if i := strings.Index(query, ":"); i >= 0 {
+		// Saxo searches better on the bare ticker
+		instr.Keywords = query[:i]
+	}
+	results, err := r.api.Instruments(instr)
+	if err != nil {
+		return SaxoAsset{}, err
+	}
+	var candidates []SaxoAsset
+	switch {
+	case isinrx.MatchString(strings.ToUpper(query)):
+		// the keyword search also matches on text, so keep only the
+		// listings of that ISIN
+		for _, a := range results {
+			if strings.EqualFold(a.Isin, query) {
+				candidates = append(candidates, a)
+			}
+		}
+	case strings.Contains(query, ":"):
+		for _, a := range results {
+			if strings.EqualFold(a.Symbol, query) {
+				candidates = append(candidates, a)
+			}
+		}
+	default:
+		for _, a := range results {
+			bare := strings.SplitN(a.Symbol, ":", 2)[0]
+			if strings.EqualFold(a.Symbol, query) || strings.EqualFold(bare, query) {
+				candidates = append(candidates, a)
+			}
+		}
+	}
+	chosen, err := pickListing(query, assetType, candidates)
+	if err != nil {
+		return SaxoAsset{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolved[key] = chosen
+	return chosen, r.save()
+}
+
+// pickListing prefers a single candidate, then the one primary listing.
+func pickListing(query, assetType string, candidates []SaxoAsset) (SaxoAsset, error) {
+	switch len(candidates) {
+	case 0:
+		return SaxoAsset{}, errors.New(fmt.Sprintf("No instrument found for %s", query))
+	case 1:
+		return candidates[0], nil
+	}
+	var primary []SaxoAsset
+	for _, a := range candidates {
+		if a.PrimaryListing != 0 && a.PrimaryListing == a.Identifier {
+			primary = append(primary, a)
+		}
+	}
+	if len(primary) == 1 {
+		return primary[0], nil
+	}
+	return SaxoAsset{}, &AmbiguousSymbolError{Query: query, AssetType: assetType, Candidates: candidates}
+}
+
+func (r *SymbolResolver) ResolveUic(query, assetType string) (int, error) {
+	a, err := r.Resolve(query, assetType)
+	return a.Identifier, err
+}
+
+// Remember pins a resolution, for example after picking from an
+// AmbiguousSymbolError.
+func (r *SymbolResolver) Remember(query, assetType string, asset SaxoAsset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolved[resolverKey(query, assetType)] = asset
+	return r.save()
+}
+
+func (r *SymbolResolver) Forget(query, assetType string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.resolved, resolverKey(query, assetType))
+	return r.save()
+}
+
+// save must be called with r.mu held
+func (r *SymbolResolver) save() error {
+	if r.Path == "" {
+		return nil
+	}
+	ba, err := json.Marshal(r.resolved)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.Path, ba)
+}
@@ -0,0 +1,116 @@
+package saxotrader
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// resolverFake answers every instrument search with the same listings.
+func resolverFake(t *testing.T, results []SaxoAsset) (*SymbolResolver, *fakeSaxo) {
+	api, fake := newFakeSaxo(t)
+	ba, err := json.Marshal(SaxoAssetSet{Data: results})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.handle("GET ref/v1/instruments", func(r fakeRequest) (int, string) { return http.StatusOK, string(ba) })
+	r, err := NewSymbolResolver(api, filepath.Join(t.TempDir(), "symbols.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, fake
+}
+
+func TestSymbolResolver(t *testing.T) {
+	listings := []SaxoAsset{
+		{Identifier: 211, Symbol: "AAPL:xnas", AssetType: "Stock", ExchangeId: "NASDAQ", Isin: "US0378331005", PrimaryListing: 211},
+		{Identifier: 212, Symbol: "AAPL:xetr", AssetType: "Stock", ExchangeId: "FSE", Isin: "US0378331005", PrimaryListing: 211},
+		{Identifier: 300, Symbol: "AAPLX:xnas", AssetType: "Stock", ExchangeId: "NASDAQ", Isin: "US0000000001"},
+		{Identifier: 401, Symbol: "DUAL:xams", AssetType: "Stock", ExchangeId: "AMS"},
+		{Identifier: 402, Symbol: "DUAL:xlon", AssetType: "Stock", ExchangeId: "LSE"},
+		{Identifier: 21, Symbol: "EURUSD", AssetType: "FxSpot"},
+	}
+	tests := []struct {
+		name      string
+		query     string
+		uic       int
+		ambiguous []int
+		fails     bool
+	}{
+		{"ticker with exchange", "aapl:XETR", 212, nil, false},
+		{"bare ticker picks the primary listing", "AAPL", 211, nil, false},
+		{"isin picks the primary listing", "US0378331005", 211, nil, false},
+		{"fx pair", "eurusd", 21, nil, false},
+		{"bare ticker without a primary listing", "DUAL", 0, []int{401, 402}, false},
+		{"ticker on an exchange that does not list it", "AAPL:xlon", 0, nil, true},
+		{"unknown ticker", "MSFT", 0, nil, true},
+		{"empty query", "  ", 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := resolverFake(t, listings)
+			a, err := r.Resolve(tt.query, "")
+			var amb *AmbiguousSymbolError
+			switch {
+			case tt.ambiguous != nil:
+				if !errors.As(err, &amb) {
+					t.Fatalf("Resolve = %+v, %v, want an ambiguity", a, err)
+				}
+				if len(amb.Candidates) != len(tt.ambiguous) {
+					t.Fatalf("candidates = %+v", amb.Candidates)
+				}
+				for i, c := range amb.Candidates {
+					if c.Identifier != tt.ambiguous[i] {
+						t.Errorf("candidate %d = %d, want %d", i, c.Identifier, tt.ambiguous[i])
+					}
+				}
+			case tt.fails:
+				if err == nil || errors.As(err, &amb) {
+					t.Errorf("Resolve = %+v, %v, want a lookup error", a, err)
+				}
+			default:
+				if err != nil || a.Identifier != tt.uic {
+					t.Errorf("Resolve = %d, %v, want %d", a.Identifier, err, tt.uic)
+				}
+			}
+		})
+	}
+}
+
+func TestSymbolResolverRemembers(t *testing.T) {
+	listings := []SaxoAsset{
+		{Identifier: 401, Symbol: "DUAL:xams", AssetType: "Stock"},
+		{Identifier: 402, Symbol: "DUAL:xlon", AssetType: "Stock"},
+	}
+	r, fake := resolverFake(t, listings)
+	var amb *AmbiguousSymbolError
+	if _, err := r.Resolve("DUAL", "Stock"); !errors.As(err, &amb) {
+		t.Fatalf("Resolve = %v, want an ambiguity", err)
+	}
+	// pinning a candidate settles the query, also after reopening
+	if err := r.Remember("dual", "Stock", amb.Candidates[1]); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewSymbolResolver(r.api, r.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uic, err := reopened.ResolveUic("DUAL", "Stock"); err != nil || uic != 402 {
+		t.Errorf("ResolveUic after Remember = %d, %v", uic, err)
+	}
+	if n := len(fake.calls("GET ref/v1/instruments")); n != 1 {
+		t.Errorf("%d searches, want 1", n)
+	}
+	// the pin is per asset type
+	if _, err := reopened.Resolve("DUAL", ""); !errors.As(err, &amb) {
+		t.Errorf("Resolve for all asset types = %v, want an ambiguity", err)
+	}
+	if err := reopened.Forget("DUAL", "Stock"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Resolve("DUAL", "Stock"); !errors.As(err, &amb) {
+		t.Errorf("Resolve after Forget = %v, want an ambiguity", err)
+	}
+}
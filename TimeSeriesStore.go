@@ -0,0 +1,488 @@
+package saxotrader
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SeriesKey names one stored series. A zero Horizon is the quote series of
+// the instrument.
+type SeriesKey struct {
+	Uic       int
+	AssetType string
+	Horizon   ChartHorizon
+}
+
+func (k SeriesKey) String() string {
+	if k.Horizon == 0 {
+		return fmt.Sprintf("%d_%s_quotes", k.Uic, k.AssetType)
+	}
+	return fmt.Sprintf("%d_%s_%d", k.Uic, k.AssetType, int(k.Horizon))
+}
+
+func parseSeriesKey(name string) (SeriesKey, error) {
+	parts := strings.Split(name, "_")
+	if len(parts) != 3 {
+		return SeriesKey{}, errors.New(fmt.Sprintf("Bad series name %s", name))
+	}
+	uic, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return SeriesKey{}, err
+	}
+	key := SeriesKey{Uic: uic, AssetType: parts[1]}
+	if parts[2] != "quotes" {
+		h, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return SeriesKey{}, err
+		}
+		key.Horizon = ChartHorizon(h)
+	}
+	return key, nil
+}
+
+// QuoteSnapshot is a stored top of book quote.
+type QuoteSnapshot struct {
+	Time    time.Time
+	Bid     float64
+	Ask     float64
+	Mid     float64
+	BidSize float64
+	AskSize float64
+}
+
+func QuoteFromPrice(p SaxoPrice) (QuoteSnapshot, error) {
+	t, err := ParseSaxoDate(p.LastUpdated)
+	if err != nil {
+		return QuoteSnapshot{}, err
+	}
+	mid := p.Quote.Mid
+	if mid == 0 && p.Quote.BidPrice != 0 && p.Quote.AskPrice != 0 {
+		mid = (p.Quote.BidPrice + p.Quote.AskPrice) / 2
+	}
+	return QuoteSnapshot{Time: t, Bid: p.Quote.BidPrice, Ask: p.Quote.AskPrice, Mid: mid, BidSize: p.Quote.BidSize, AskSize: p.Quote.AskSize}, nil
+}
+
+// tsRecord is the on-disk record shared by bars and quotes: a unix
+// nanosecond timestamp followed by five values.
+type tsRecord struct {
+	T int64
+	V [5]float64
+}
+
+const tsRecordSize = 48
+
+func (r tsRecord) encode(buf []byte) {
+	binary.LittleEndian.PutUint64(buf, uint64(r.T))
+	for i, v := range r.V {
+		binary.LittleEndian.PutUint64(buf[8+8*i:], math.Float64bits(v))
+	}
+}
+
+func decodeRecord(buf []byte) tsRecord {
+	r := tsRecord{T: int64(binary.LittleEndian.Uint64(buf))}
+	for i := range r.V {
+		r.V[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[8+8*i:]))
+	}
+	return r
+}
+
+type tsSegment struct {
+	Name  string
+	Min   int64
+	Max   int64
+	Count int
+}
+
+type tsIndex struct {
+	Segments []tsSegment
+	Next     int
+}
+
+// TimeSeriesStore keeps bars and quote snapshots in append-only segment
+// files, one directory per series with an index of segment time ranges.
+// A record for a timestamp already stored replaces it, so a complete bar
+// downloaded later wins over a partial one, while identical records are
+// skipped. Compact rewrites a series into sorted, duplicate free segments.
+// SegmentSize defaults to 100000 records when not positive.
+type TimeSeriesStore struct {
+	Dir         string
+	SegmentSize int
+
+	mu sync.Mutex
+}
+
+func OpenTimeSeriesStore(dir string) (*TimeSeriesStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &TimeSeriesStore{Dir: dir, SegmentSize: defaultSegmentSize}, nil
+}
+
+const defaultSegmentSize = 100000
+
+func (s *TimeSeriesStore) segmentSize() int {
+	if s.SegmentSize <= 0 {
+		return defaultSegmentSize
+	}
+	return s.SegmentSize
+}
+
+func (s *TimeSeriesStore) seriesDir(key SeriesKey) string {
+	return filepath.Join(s.Dir, key.String())
+}
+
+func (s *TimeSeriesStore) readIndex(key SeriesKey) (tsIndex, error) {
+	var idx tsIndex
+	ba, err := os.ReadFile(filepath.Join(s.seriesDir(key), "index.json"))
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return idx, err
+	}
+	err = json.Unmarshal(ba, &idx)
+	return idx, err
+}
+
+func (s *TimeSeriesStore) writeIndex(key SeriesKey, idx tsIndex) error {
+	ba, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.seriesDir(key), "index.json"), ba)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partly written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *TimeSeriesStore) readSegment(key SeriesKey, seg tsSegment) ([]tsRecord, error) {
+	f, err := os.Open(filepath.Join(s.seriesDir(key), seg.Name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// only the records listed in the index count; a torn write past them is ignored
+	buf := make([]byte, seg.Count*tsRecordSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, err
+	}
+	records := make([]tsRecord, seg.Count)
+	for i := range records {
+		records[i] = decodeRecord(buf[i*tsRecordSize:])
+	}
+	return records, nil
+}
+
+// query must be called with s.mu held. Later segments win on duplicate
+// timestamps.
+func (s *TimeSeriesStore) query(key SeriesKey, idx tsIndex, from, to int64) ([]tsRecord, error) {
+	byTime := make(map[int64]tsRecord)
+	for _, seg := range idx.Segments {
+		if seg.Count == 0 || seg.Max < from || seg.Min > to {
+			continue
+		}
+		records, err := s.readSegment(key, seg)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if r.T >= from && r.T <= to {
+				byTime[r.T] = r
+			}
+		}
+	}
+	records := make([]tsRecord, 0, len(byTime))
+	for _, r := range byTime {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].T < records[j].T })
+	return records, nil
+}
+
+func (s *TimeSeriesStore) append(key SeriesKey, records []tsRecord) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(s.seriesDir(key), 0755); err != nil {
+		return 0, err
+	}
+	idx, err := s.readIndex(key)
+	if err != nil {
+		return 0, err
+	}
+	// the last record of a timestamp in the batch wins
+	byTime := make(map[int64]tsRecord, len(records))
+	for _, r := range records {
+		byTime[r.T] = r
+	}
+	fresh := make([]tsRecord, 0, len(byTime))
+	for _, r := range byTime {
+		fresh = append(fresh, r)
+	}
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].T < fresh[j].T })
+	min, max := fresh[0].T, fresh[len(fresh)-1].T
+
+	// only a batch reaching back into stored data is compared with it, so
+	// appending at the end of a series reads nothing
+	stored := int64(math.MinInt64)
+	for _, seg := range idx.Segments {
+		if seg.Count > 0 && seg.Max > stored {
+			stored = seg.Max
+		}
+	}
+	if min <= stored {
+		existing, err := s.query(key, idx, min, max)
+		if err != nil {
+			return 0, err
+		}
+		same := make(map[int64]tsRecord, len(existing))
+		for _, r := range existing {
+			same[r.T] = r
+		}
+		changed := fresh[:0]
+		for _, r := range fresh {
+			if old, ok := same[r.T]; !ok || old != r {
+				changed = append(changed, r)
+			}
+		}
+		fresh = changed
+	}
+	if len(fresh) == 0 {
+		return 0, nil
+	}
+	written := len(fresh)
+	size := s.segmentSize()
+
+	for len(fresh) > 0 {
+		if len(idx.Segments) == 0 || idx.Segments[len(idx.Segments)-1].Count >= size {
+			idx.Next++
+			idx.Segments = append(idx.Segments, tsSegment{Name: fmt.Sprintf("seg-%06d.dat", idx.Next), Min: math.MaxInt64, Max: math.MinInt64})
+		}
+		seg := &idx.Segments[len(idx.Segments)-1]
+		n := size - seg.Count
+		if n > len(fresh) {
+			n = len(fresh)
+		}
+		buf := make([]byte, n*tsRecordSize)
+		for i, r := range fresh[:n] {
+			r.encode(buf[i*tsRecordSize:])
+			if r.T < seg.Min {
+				seg.Min = r.T
+			}
+			if r.T > seg.Max {
+				seg.Max = r.T
+			}
+		}
+		path := filepath.Join(s.seriesDir(key), seg.Name)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, err
+		}
+		_, err = f.WriteAt(buf, int64(seg.Count*tsRecordSize))
+		if err == nil {
+			err = f.Sync()
+		}
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		seg.Count += n
+		fresh = fresh[n:]
+	}
+	return written, s.writeIndex(key, idx)
+}
+
+func (s *TimeSeriesStore) read(key SeriesKey, from, to time.Time) ([]tsRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, err := s.readIndex(key)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	if !from.IsZero() {
+		lo = from.UnixNano()
+	}
+	if !to.IsZero() {
+		hi = to.UnixNano()
+	}
+	return s.query(key, idx, lo, hi)
+}
+
+// AppendBars stores bars for the series and returns how many were new or
+// changed.
+func (s *TimeSeriesStore) AppendBars(key SeriesKey, bars []Bar) (int, error) {
+	if key.Horizon == 0 {
+		return 0, errors.New("Bar series need a horizon")
+	}
+	records := make([]tsRecord, len(bars))
+	for i, b := range bars {
+		records[i] = tsRecord{T: b.Time.UnixNano(), V: [5]float64{b.Open, b.High, b.Low, b.Close, b.Volume}}
+	}
+	return s.append(key, records)
+}
+
+// Bars returns the stored bars between from and to inclusive. Zero times
+// leave the range open.
+func (s *TimeSeriesStore) Bars(key SeriesKey, from, to time.Time) ([]Bar, error) {
+	records, err := s.read(key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	bars := make([]Bar, len(records))
+	for i, r := range records {
+		bars[i] = Bar{Time: time.Unix(0, r.T).UTC(), Open: r.V[0], High: r.V[1], Low: r.V[2], Close: r.V[3], Volume: r.V[4]}
+	}
+	return bars, nil
+}
+
+func (s *TimeSeriesStore) AppendQuotes(uic int, assetType string, quotes []QuoteSnapshot) (int, error) {
+	records := make([]tsRecord, len(quotes))
+	for i, q := range quotes {
+		records[i] = tsRecord{T: q.Time.UnixNano(), V: [5]float64{q.Bid, q.Ask, q.Mid, q.BidSize, q.AskSize}}
+	}
+	return s.append(SeriesKey{Uic: uic, AssetType: assetType}, records)
+}
+
+// AppendPrices stores the quotes of prices fetched with Prices or PriceList.
+func (s *TimeSeriesStore) AppendPrices(prices []SaxoPrice) (int, error) {
+	byKey := make(map[SeriesKey][]QuoteSnapshot)
+	for _, p := range prices {
+		q, err := QuoteFromPrice(p)
+		if err != nil {
+			return 0, err
+		}
+		key := SeriesKey{Uic: p.Uic, AssetType: p.AssetType}
+		byKey[key] = append(byKey[key], q)
+	}
+	total := 0
+	for key, quotes := range byKey {
+		n, err := s.AppendQuotes(key.Uic, key.AssetType, quotes)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (s *TimeSeriesStore) Quotes(uic int, assetType string, from, to time.Time) ([]QuoteSnapshot, error) {
+	records, err := s.read(SeriesKey{Uic: uic, AssetType: assetType}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	quotes := make([]QuoteSnapshot, len(records))
+	for i, r := range records {
+		quotes[i] = QuoteSnapshot{Time: time.Unix(0, r.T).UTC(), Bid: r.V[0], Ask: r.V[1], Mid: r.V[2], BidSize: r.V[3], AskSize: r.V[4]}
+	}
+	return quotes, nil
+}
+
+// Range reports the first and last stored timestamps of a series.
+func (s *TimeSeriesStore) Range(key SeriesKey) (time.Time, time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, err := s.readIndex(key)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, err
+	}
+	min, max := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, seg := range idx.Segments {
+		if seg.Count == 0 {
+			continue
+		}
+		if seg.Min < min {
+			min = seg.Min
+		}
+		if seg.Max > max {
+			max = seg.Max
+		}
+	}
+	if min > max {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	return time.Unix(0, min).UTC(), time.Unix(0, max).UTC(), true, nil
+}
+
+func (s *TimeSeriesStore) Series() ([]SeriesKey, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []SeriesKey
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if key, err := parseSeriesKey(e.Name()); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Compact rewrites a series into sorted, duplicate free segments and
+// removes the old segment files.
+func (s *TimeSeriesStore) Compact(key SeriesKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx, err := s.readIndex(key)
+	if err != nil {
+		return err
+	}
+	if len(idx.Segments) == 0 {
+		return nil
+	}
+	records, err := s.query(key, idx, math.MinInt64, math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	old := idx.Segments
+	compacted := tsIndex{Next: idx.Next}
+	size := s.segmentSize()
+	for len(records) > 0 {
+		n := size
+		if n > len(records) {
+			n = len(records)
+		}
+		compacted.Next++
+		seg := tsSegment{Name: fmt.Sprintf("seg-%06d.dat", compacted.Next), Min: records[0].T, Max: records[n-1].T, Count: n}
+		buf := make([]byte, n*tsRecordSize)
+		for i, r := range records[:n] {
+			r.encode(buf[i*tsRecordSize:])
+		}
+		if err := os.WriteFile(filepath.Join(s.seriesDir(key), seg.Name), buf, 0644); err != nil {
+			return err
+		}
+		compacted.Segments = append(compacted.Segments, seg)
+		records = records[n:]
+	}
+	// the new index only goes live once every new segment is written
+	if err := s.writeIndex(key, compacted); err != nil {
+		return err
+	}
+	for _, seg := range old {
+		os.Remove(filepath.Join(s.seriesDir(key), seg.Name))
+	}
+	return nil
+}
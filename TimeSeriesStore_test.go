@@ -0,0 +1,176 @@
+package saxotrader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testSeries = SeriesKey{Uic: 21, AssetType: "FxSpot", Horizon: 1}
+
+// minuteBars returns n one minute bars from start, closing at close+i.
+func minuteBars(start time.Time, n int, close float64) []Bar {
+	bars := make([]Bar, n)
+	for i := range bars {
+		c := close + float64(i)
+		bars[i] = Bar{Time: start.Add(time.Duration(i) * time.Minute), Open: c, High: c + 1, Low: c - 1, Close: c, Volume: 10}
+	}
+	return bars
+}
+
+func storedCloses(t *testing.T, s *TimeSeriesStore) []float64 {
+	bars, err := s.Bars(testSeries, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closes := make([]float64, len(bars))
+	for i, b := range bars {
+		closes[i] = b.Close
+		if i > 0 && !bars[i-1].Time.Before(b.Time) {
+			t.Errorf("bars out of order at %d: %v then %v", i, bars[i-1].Time, b.Time)
+		}
+	}
+	return closes
+}
+
+func TestTimeSeriesStoreDedup(t *testing.T) {
+	s, err := OpenTimeSeriesStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	if n, err := s.AppendBars(testSeries, minuteBars(start, 5, 100)); err != nil || n != 5 {
+		t.Fatalf("first append = %d, %v", n, err)
+	}
+	// the same bars again are skipped
+	if n, err := s.AppendBars(testSeries, minuteBars(start, 5, 100)); err != nil || n != 0 {
+		t.Errorf("repeated append = %d, %v, want 0", n, err)
+	}
+	// an overlapping batch only writes the bars that are new
+	if n, err := s.AppendBars(testSeries, minuteBars(start.Add(3*time.Minute), 4, 103)); err != nil || n != 2 {
+		t.Errorf("overlapping append = %d, %v, want 2", n, err)
+	}
+	if got := storedCloses(t, s); !sameValues(got, []float64{100, 101, 102, 103, 104, 105, 106}) {
+		t.Errorf("closes = %v", got)
+	}
+	first, last, ok, err := s.Range(testSeries)
+	if err != nil || !ok || !first.Equal(start) || !last.Equal(start.Add(6*time.Minute)) {
+		t.Errorf("Range = %v, %v, %v, %v", first, last, ok, err)
+	}
+}
+
+func TestTimeSeriesStoreLaterWriteWins(t *testing.T) {
+	s, err := OpenTimeSeriesStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := s.AppendBars(testSeries, minuteBars(start, 3, 100)); err != nil {
+		t.Fatal(err)
+	}
+	// a completed bar replaces the partial one stored for the same minute
+	if n, err := s.AppendBars(testSeries, minuteBars(start.Add(2*time.Minute), 1, 200)); err != nil || n != 1 {
+		t.Fatalf("replacing append = %d, %v", n, err)
+	}
+	if got := storedCloses(t, s); !sameValues(got, []float64{100, 101, 200}) {
+		t.Errorf("closes = %v", got)
+	}
+	// within one batch the last bar of a timestamp wins
+	batch := append(minuteBars(start, 1, 300), minuteBars(start, 1, 400)...)
+	if n, err := s.AppendBars(testSeries, batch); err != nil || n != 1 {
+		t.Fatalf("batch append = %d, %v", n, err)
+	}
+	if got := storedCloses(t, s); !sameValues(got, []float64{400, 101, 200}) {
+		t.Errorf("closes = %v", got)
+	}
+}
+
+func TestTimeSeriesStoreIgnoresTornRecords(t *testing.T) {
+	s, err := OpenTimeSeriesStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	if _, err := s.AppendBars(testSeries, minuteBars(start, 3, 100)); err != nil {
+		t.Fatal(err)
+	}
+	// a crash after writing records but before the index leaves a tail the
+	// index does not list
+	seg := filepath.Join(s.Dir, testSeries.String(), "seg-000001.dat")
+	f, err := os.OpenFile(seg, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn := make([]byte, tsRecordSize+tsRecordSize/2)
+	tsRecord{T: start.Add(3 * time.Minute).UnixNano(), V: [5]float64{999, 999, 999, 999, 999}}.encode(torn)
+	if _, err := f.Write(torn); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if got := storedCloses(t, s); !sameValues(got, []float64{100, 101, 102}) {
+		t.Errorf("closes with a torn tail = %v", got)
+	}
+	// the next append overwrites the tail
+	if n, err := s.AppendBars(testSeries, minuteBars(start.Add(3*time.Minute), 1, 103)); err != nil || n != 1 {
+		t.Fatalf("append after torn tail = %d, %v", n, err)
+	}
+	if got := storedCloses(t, s); !sameValues(got, []float64{100, 101, 102, 103}) {
+		t.Errorf("closes after append = %v", got)
+	}
+}
+
+func TestTimeSeriesStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenTimeSeriesStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SegmentSize = 3
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	// out of order batches with a replaced bar spread over several segments
+	for _, batch := range [][]Bar{
+		minuteBars(start.Add(4*time.Minute), 4, 104),
+		minuteBars(start, 4, 100),
+		minuteBars(start.Add(2*time.Minute), 1, 202),
+	} {
+		if _, err := s.AppendBars(testSeries, batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []float64{100, 101, 202, 103, 104, 105, 106, 107}
+	if got := storedCloses(t, s); !sameValues(got, want) {
+		t.Fatalf("closes before compacting = %v", got)
+	}
+	before, _ := filepath.Glob(filepath.Join(dir, testSeries.String(), "seg-*.dat"))
+
+	if err := s.Compact(testSeries); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedCloses(t, s); !sameValues(got, want) {
+		t.Errorf("closes after compacting = %v", got)
+	}
+	idx, err := s.readIndex(testSeries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Segments) != 3 {
+		t.Errorf("compacted into %d segments, want 3", len(idx.Segments))
+	}
+	for i, seg := range idx.Segments {
+		if i > 0 && seg.Min <= idx.Segments[i-1].Max {
+			t.Errorf("segment %d overlaps the one before it", i)
+		}
+	}
+	after, _ := filepath.Glob(filepath.Join(dir, testSeries.String(), "seg-*.dat"))
+	if len(after) != len(idx.Segments) {
+		t.Errorf("%d segment files after compacting, want %d", len(after), len(idx.Segments))
+	}
+	for _, old := range before {
+		for _, seg := range idx.Segments {
+			if filepath.Base(old) == seg.Name {
+				t.Errorf("compacted segment reuses the old name %s", seg.Name)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/suffus/saxotrader"
 )
@@ -14,6 +15,7 @@ func main() {
 	assetType := flag.String("assetType", "", "Asset Type for SaxoTrader API")
 	amount := flag.Float64("amount", 0, "Amount for SaxoTrader API")
 	price := flag.Float64("price", 0, "Price for SaxoTrader API")
+	cache := flag.String("cache", "", "Instrument cache file, e.g. instruments.json; no caching when empty")
 
 	flag.Parse()
 	if *token == "" {
@@ -21,6 +23,14 @@ func main() {
 		return
 	}
 	port := saxotrader.NewSaxoAPICall(*token)
+	if *cache != "" {
+		refCache, err := saxotrader.OpenInstrumentCache(*cache, 24*time.Hour)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		port.RefCache = refCache
+	}
 	u, err := port.User()
 	if err != nil {
 		fmt.Println(err)
@@ -88,8 +98,22 @@ func main() {
 	}
 	fmt.Println(len(instr))
 	if *amount != 0 {
-		fmt.Println("placing order")
-		orderInstruction, err := port.MakeOrder(*amount, *price, instr[0].Identifier, *assetType, "Buy", "DayOrder", "Limit")
+		resolver, err := saxotrader.NewSymbolResolver(port, "symbols.json")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		query := *symbol
+		if *exchange != "" {
+			query = *symbol + ":" + *exchange
+		}
+		target, err := resolver.Resolve(query, *assetType)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("placing order for", target.Symbol, target.Identifier)
+		orderInstruction, err := port.MakeOrder(*amount, *price, target.Identifier, *assetType, "Buy", "DayOrder", "Limit")
 		if err != nil {
 			fmt.Println(err)
 			return
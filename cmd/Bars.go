@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/suffus/saxotrader"
+)
+
+type target struct {
+	Name      string
+	Uic       int
+	AssetType string
+}
+
+func main() {
+	token := flag.String("token", "", "Token for SaxoTrader API")
+	symbols := flag.String("symbols", "", "Comma separated symbols to download, e.g. AAPL:xnas,EURUSD")
+	uics := flag.String("uics", "", "Comma separated Uics to download")
+	assetType := flag.String("assetType", "Stock", "Asset Type of the instruments")
+	horizonFlag := flag.String("horizon", "1d", "Bar horizon in minutes or as 1m, 5m, 1h, 1d, 1w, 1mo")
+	fromFlag := flag.String("from", "", "Start date (YYYY-MM-DD)")
+	toFlag := flag.String("to", "", "End date (YYYY-MM-DD), inclusive, defaults to now")
+	format := flag.String("format", "csv", "Output format, csv or jsonl")
+	side := flag.String("side", "Mid", "Price side for two sided instruments: Mid, Bid or Ask")
+	out := flag.String("out", ".", "Output directory")
+	rate := flag.Int("rate", 60, "Maximum chart requests per minute")
+	flag.Parse()
+
+	if *token == "" {
+		fmt.Println("Please provide a token")
+		return
+	}
+	if *format != "csv" && *format != "jsonl" {
+		fmt.Println("Format must be csv or jsonl")
+		return
+	}
+	horizon, err := saxotrader.ParseChartHorizon(*horizonFlag)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	from, err := time.Parse("2006-01-02", *fromFlag)
+	if err != nil {
+		fmt.Println("Please provide a valid from date:", err)
+		return
+	}
+	to := time.Now().UTC()
+	if *toFlag != "" {
+		to, err = time.Parse("2006-01-02", *toFlag)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		// include the bars of the end day
+		to = to.AddDate(0, 0, 1)
+	}
+	if *rate <= 0 {
+		*rate = 60
+	}
+	delay := time.Minute / time.Duration(*rate)
+
+	port := saxotrader.NewSaxoAPICall(*token)
+	var targets []target
+	for _, u := range splitList(*uics) {
+		uic, err := strconv.Atoi(u)
+		if err != nil {
+			fmt.Println("Bad Uic", u)
+			return
+		}
+		targets = append(targets, target{Name: u, Uic: uic, AssetType: *assetType})
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		fmt.Println(err)
+		return
+	}
+	resolver, err := saxotrader.NewSymbolResolver(port, filepath.Join(*out, "symbols.json"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, sym := range splitList(*symbols) {
+		chosen, err := resolver.Resolve(sym, *assetType)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		targets = append(targets, target{Name: chosen.Symbol, Uic: chosen.Identifier, AssetType: chosen.AssetType})
+		time.Sleep(delay)
+	}
+	if len(targets) == 0 {
+		fmt.Println("Please provide symbols or uics")
+		return
+	}
+
+	for _, t := range targets {
+		path := filepath.Join(*out, fmt.Sprintf("%d_%s_%s.%s", t.Uic, t.AssetType, horizon, *format))
+		n, err := download(port, t, horizon, saxotrader.PriceSide(*side), from, to, path, *format, delay)
+		if err != nil {
+			fmt.Println(t.Name, "failed after", n, "bars:", err)
+			continue
+		}
+		fmt.Println(t.Name, t.Uic, "wrote", n, "bars to", path)
+	}
+}
+
+func splitList(val string) []string {
+	var list []string
+	for _, v := range strings.Split(val, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// trimPartial cuts an unterminated last line, left by an interrupted
+// write, so the export resumes from the last complete bar.
+func trimPartial(path string) error {
+	ba, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if len(ba) == 0 || ba[len(ba)-1] == '\n' {
+		return nil
+	}
+	return os.Truncate(path, int64(strings.LastIndexByte(string(ba), '\n')+1))
+}
+
+// lastStored returns the time of the last bar in an existing export
+func lastStored(path, format string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	last := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	if last == "" || strings.HasPrefix(last, "time,") {
+		return time.Time{}, nil
+	}
+	if format == "jsonl" {
+		var b saxotrader.Bar
+		if err := json.Unmarshal([]byte(last), &b); err != nil {
+			return time.Time{}, err
+		}
+		return b.Time, nil
+	}
+	return time.Parse(time.RFC3339, strings.SplitN(last, ",", 2)[0])
+}
+
+func download(port *saxotrader.SaxoAPI, t target, horizon saxotrader.ChartHorizon, side saxotrader.PriceSide, from, to time.Time, path, format string, delay time.Duration) (int, error) {
+	start := from
+	if err := trimPartial(path); err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	last, err := lastStored(path, format)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	if !last.IsZero() {
+		start = last.Add(time.Second)
+		fmt.Println(t.Name, "resuming after", last.Format(time.RFC3339))
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if format == "csv" && last.IsZero() {
+		if st, err := f.Stat(); err == nil && st.Size() == 0 {
+			w.Write([]string{"time", "open", "high", "low", "close", "volume"})
+			w.Flush()
+		}
+	}
+
+	n := 0
+	for start.Before(to) {
+		chart, err := port.Chart(t.Uic, t.AssetType, horizon, 1200, start, saxotrader.ChartModeFrom)
+		if err != nil {
+			return n, err
+		}
+		bars, err := saxotrader.SamplesToBars(chart.Data, side)
+		if err != nil {
+			return n, err
+		}
+		next := start
+		for _, b := range bars {
+			if b.Time.Before(start) || !b.Time.Before(to) || (!last.IsZero() && !b.Time.After(last)) {
+				continue
+			}
+			if format == "jsonl" {
+				ba, err := json.Marshal(b)
+				if err != nil {
+					return n, err
+				}
+				if _, err := f.Write(append(ba, '\n')); err != nil {
+					return n, err
+				}
+			} else {
+				w.Write([]string{
+					b.Time.UTC().Format(time.RFC3339),
+					strconv.FormatFloat(b.Open, 'f', -1, 64),
+					strconv.FormatFloat(b.High, 'f', -1, 64),
+					strconv.FormatFloat(b.Low, 'f', -1, 64),
+					strconv.FormatFloat(b.Close, 'f', -1, 64),
+					strconv.FormatFloat(b.Volume, 'f', -1, 64),
+				})
+			}
+			last = b.Time
+			n++
+			if b.Time.After(next) {
+				next = b.Time
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return n, err
+		}
+		if !next.After(start) {
+			break
+		}
+		start = next.Add(time.Second)
+		time.Sleep(delay)
+	}
+	return n, nil
+}
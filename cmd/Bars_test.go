@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suffus/saxotrader"
+)
+
+var barsStart = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+
+// chartServer serves 3000 one minute FX samples, up to 1200 per request
+// from the requested Time on.
+func chartServer(t *testing.T) *saxotrader.SaxoAPI {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from, _ := time.Parse(time.RFC3339, r.URL.Query().Get("Time"))
+		var page []saxotrader.SaxoChartSample
+		for i := 0; i < 3000 && len(page) < 1200; i++ {
+			ts := barsStart.Add(time.Duration(i) * time.Minute)
+			if ts.Before(from) {
+				continue
+			}
+			p := float64(i)
+			page = append(page, saxotrader.SaxoChartSample{Time: ts.Format(time.RFC3339),
+				OpenBid: p, OpenAsk: p + 2, HighBid: p, HighAsk: p + 2, LowBid: p, LowAsk: p + 2, CloseBid: p, CloseAsk: p + 2})
+		}
+		ba, _ := json.Marshal(saxotrader.SaxoChart{Data: page})
+		io.WriteString(w, string(ba))
+	}))
+	t.Cleanup(srv.Close)
+	api := saxotrader.NewSaxoAPICall("token")
+	api.Endpoint = srv.URL + "/"
+	return api
+}
+
+func readLines(t *testing.T, path string) []string {
+	ba, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(ba), "\n"), "\n")
+}
+
+func TestDownloadCSV(t *testing.T) {
+	api := chartServer(t)
+	path := filepath.Join(t.TempDir(), "bars.csv")
+	tgt := target{Name: "EURUSD", Uic: 21, AssetType: "FxSpot"}
+	to := barsStart.Add(2500 * time.Minute)
+
+	n, err := download(api, tgt, saxotrader.Horizon1Minute, saxotrader.PriceMid, barsStart, to, path, "csv", 0)
+	if err != nil || n != 2500 {
+		t.Fatalf("download = %d, %v, want 2500 bars", n, err)
+	}
+	lines := readLines(t, path)
+	if len(lines) != 2501 || lines[0] != "time,open,high,low,close,volume" {
+		t.Fatalf("%d lines, header %q", len(lines), lines[0])
+	}
+	// two sided samples are written at the requested side
+	if lines[1] != "2024-03-04T00:00:00Z,1,1,1,1,0" || !strings.HasPrefix(lines[2500], "2024-03-05T17:39:00Z,2500,") {
+		t.Errorf("first and last rows %q, %q", lines[1], lines[2500])
+	}
+
+	// an interrupted write leaves half a row, which is dropped on resume
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("2024-03-05T17:40:00Z,25")
+	f.Close()
+	n, err = download(api, tgt, saxotrader.Horizon1Minute, saxotrader.PriceMid, barsStart, barsStart.Add(2600*time.Minute), path, "csv", 0)
+	if err != nil || n != 100 {
+		t.Fatalf("resumed download = %d, %v, want 100 bars", n, err)
+	}
+	lines = readLines(t, path)
+	if len(lines) != 2601 || strings.Count(strings.Join(lines, "\n"), "time,") != 1 {
+		t.Fatalf("%d lines after resuming", len(lines))
+	}
+	for i, line := range lines[1:] {
+		want := barsStart.Add(time.Duration(i) * time.Minute).Format(time.RFC3339)
+		if !strings.HasPrefix(line, want+",") {
+			t.Fatalf("row %d = %q, want time %s", i+1, line, want)
+		}
+	}
+}
+
+func TestDownloadJSONL(t *testing.T) {
+	api := chartServer(t)
+	path := filepath.Join(t.TempDir(), "bars.jsonl")
+	tgt := target{Name: "EURUSD", Uic: 21, AssetType: "FxSpot"}
+	if _, err := download(api, tgt, saxotrader.Horizon1Minute, saxotrader.PriceAsk, barsStart, barsStart.Add(10*time.Minute), path, "jsonl", 0); err != nil {
+		t.Fatal(err)
+	}
+	last, err := lastStored(path, "jsonl")
+	if err != nil || !last.Equal(barsStart.Add(9*time.Minute)) {
+		t.Errorf("lastStored = %v, %v", last, err)
+	}
+	lines := readLines(t, path)
+	var b saxotrader.Bar
+	if err := json.Unmarshal([]byte(lines[0]), &b); err != nil || b.Close != 2 || len(lines) != 10 {
+		t.Errorf("%d lines, first bar %+v, %v", len(lines), b, err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/suffus/saxotrader"
+)
+
+func main() {
+	file := flag.String("file", "orders.journal", "Order journal file")
+	verify := flag.Bool("verify", false, "Verify the hash chain of the journal")
+	from := flag.String("from", "", "Only show records on or after this date (YYYY-MM-DD)")
+	to := flag.String("to", "", "Only show records before this date (YYYY-MM-DD)")
+	uic := flag.Int("uic", 0, "Only show records for this Uic")
+	orderId := flag.String("order", "", "Only show records for this order ID")
+	flag.Parse()
+
+	if *verify {
+		n, err := saxotrader.VerifyJournal(*file)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("journal ok,", n, "records")
+		return
+	}
+
+	q := saxotrader.JournalQuery{Uic: *uic, OrderId: *orderId}
+	if *from != "" {
+		t, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		q.From = t
+	}
+	if *to != "" {
+		t, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		q.To = t
+	}
+	records, err := saxotrader.QueryJournal(*file, q)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, r := range records {
+		fmt.Println(r.Seq, r.Time.Format(time.RFC3339), r.Kind, r.OrderId, r.Uic, r.AssetType, r.BuySell, r.Amount, r.Price, r.Status, r.Error)
+		if len(r.Request) > 0 {
+			fmt.Println("    request: ", string(r.Request))
+		}
+		if len(r.Response) > 0 {
+			fmt.Println("    response:", string(r.Response))
+		}
+	}
+	fmt.Println("there are ", len(records), " records")
+}